@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	sc "github.com/sebastianring/simgameserver/simconfig"
+	"github.com/sebastianring/simgameserver/stats"
+	sg "github.com/sebastianring/simulationgame"
+)
+
+// minAdaptiveRuns are the runs made before the precision is checked, the
+// variance of fewer runs says little.
+const minAdaptiveRuns = 5
+
+// adaptiveOptions are the options of the adaptive mode of the multi sim
+// endpoint: runs are added until the confidence interval of the mean of the
+// metric is within ±precision for every creature type, or maxRuns is reached.
+type adaptiveOptions struct {
+	precision     float64
+	confidence    float64
+	maxRuns       int
+	metricName    string
+	metric        func(*simulationRun, sg.BoardObjectType) float64
+	creatureTypes []sg.BoardObjectType
+	intervals     map[string]sc.Interval
+}
+
+// adaptiveResult holds the runs made, why no more were made, precision,
+// max_runs, time_limit or cancelled, and the most runs that could be made.
+type adaptiveResult struct {
+	runs       []*simulationRun
+	failed     int
+	halfWidths map[sg.BoardObjectType]float64
+	reached    bool
+	stopped    string
+	maxRuns    int
+}
+
+// getAdaptiveOptions function    Reads precision, confidence (default 0.95),
+// metric (default final_population) and creature_type (default both), the
+// iterations of the route are the most runs made.
+func getAdaptiveOptions(r *http.Request, iterations uint) (*adaptiveOptions, error) {
+	query := r.URL.Query()
+	options := adaptiveOptions{
+		confidence:    0.95,
+		maxRuns:       int(iterations),
+		metricName:    "final_population",
+		creatureTypes: creatureTypes,
+	}
+
+	precision, err := strconv.ParseFloat(query.Get("precision"), 64)
+
+	if err != nil || precision <= 0 {
+		return nil, errors.New("Invalid precision, should be a number above 0.")
+	}
+
+	options.precision = precision
+
+	if value := query.Get("confidence"); value != "" {
+		confidence, err := strconv.ParseFloat(value, 64)
+
+		if err != nil || confidence < 0.5 || confidence >= 1 {
+			return nil, errors.New("Invalid confidence, should be at least 0.5 and below 1.")
+		}
+
+		options.confidence = confidence
+	}
+
+	if value := query.Get("metric"); value != "" {
+		options.metricName = value
+	}
+
+	// The metric is looked up with either creature type when both are used.
+	creatureType := query.Get("creature_type")
+
+	if creatureType == "" {
+		creatureType = "creature1"
+	}
+
+	metric, t, err := getRunMetric(options.metricName, creatureType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	options.metric = metric
+
+	if query.Get("creature_type") != "" {
+		options.creatureTypes = []sg.BoardObjectType{t}
+	}
+
+	if options.maxRuns < minAdaptiveRuns {
+		return nil, errors.New("Too few iterations for the adaptive mode, at least " + strconv.Itoa(minAdaptiveRuns) + " runs are needed.")
+	}
+
+	return &options, nil
+}
+
+// getHalfWidth function    Returns the half width of the confidence interval
+// of the mean of the values, using Student's t.
+func getHalfWidth(values *stats.Running, confidence float64) float64 {
+	if values.N() < 2 {
+		return 0
+	}
+
+	return stats.StudentTCritical(1-confidence, float64(values.N()-1)) * values.StdErr()
+}
+
+// runAdaptiveSimulations function    Runs random simulations in batches of as
+// many runs as there are cpus until the precision is reached. Failed runs
+// count towards the most runs made so that it always ends. No batch is
+// started when ctx is done, or when another batch as long as the last one
+// would not end well before the deadline of ctx, so the runs made so far can
+// still be sent.
+func (s *APIServer) runAdaptiveSimulations(ctx context.Context, options *adaptiveOptions) *adaptiveResult {
+	result := adaptiveResult{halfWidths: map[sg.BoardObjectType]float64{}, stopped: "max_runs", maxRuns: options.maxRuns}
+	values := make(map[sg.BoardObjectType]*stats.Running, len(options.creatureTypes))
+
+	for _, t := range options.creatureTypes {
+		values[t] = &stats.Running{}
+	}
+
+	attempts := 0
+	var batchDuration time.Duration
+
+	for attempts < options.maxRuns {
+		if ctx.Err() != nil {
+			result.stopped = "cancelled"
+			break
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < 2*batchDuration {
+			result.stopped = "time_limit"
+			break
+		}
+
+		batch := max(runtime.NumCPU(), minAdaptiveRuns-len(result.runs))
+		batch = min(batch, options.maxRuns-attempts)
+		attempts += batch
+		started := time.Now()
+
+		for run := range s.startRandomSimulations(ctx, uint(batch), options.intervals) {
+			result.runs = append(result.runs, run)
+
+			for t, v := range values {
+				v.Add(options.metric(run, t))
+			}
+		}
+
+		batchDuration = time.Since(started)
+		result.failed = attempts - len(result.runs)
+
+		if len(result.runs) < minAdaptiveRuns {
+			continue
+		}
+
+		result.reached = true
+
+		for t, v := range values {
+			result.halfWidths[t] = getHalfWidth(v, options.confidence)
+			result.reached = result.reached && result.halfWidths[t] <= options.precision
+		}
+
+		if result.reached {
+			result.stopped = "precision"
+			break
+		}
+	}
+
+	return &result
+}
+
+// setHeaders function    Reports the runs used and the precision reached in
+// headers, so the body keeps the same format as without the adaptive mode.
+func (result *adaptiveResult) setHeaders(w http.ResponseWriter) {
+	halfWidths := []string{}
+
+	for _, t := range creatureTypes {
+		if hw, ok := result.halfWidths[t]; ok {
+			halfWidths = append(halfWidths, creatureTypeNames[t]+"="+strconv.FormatFloat(hw, 'f', 3, 64))
+		}
+	}
+
+	w.Header().Set("X-Adaptive-Runs", strconv.Itoa(len(result.runs)))
+	w.Header().Set("X-Adaptive-Failed", strconv.Itoa(result.failed))
+	w.Header().Set("X-Adaptive-Precision-Reached", strconv.FormatBool(result.reached))
+	w.Header().Set("X-Adaptive-Half-Width", strings.Join(halfWidths, ","))
+	w.Header().Set("X-Adaptive-Max-Runs", strconv.Itoa(result.maxRuns))
+	w.Header().Set("X-Adaptive-Stopped", result.stopped)
+}
@@ -0,0 +1,88 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastianring/simgameserver/api"
+)
+
+func TestAPIServer_AdaptiveMultipleSimulations(t *testing.T) {
+	fmt.Println("Running simulations until a loose precision is reached")
+	req := httptest.NewRequest("GET", "/api/new_multiple_sim/50?precision=1000", nil)
+	req = mux.SetURLVars(req, map[string]string{"iterations": "50"})
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+
+	if err := s.HandleMultipleRandomSimulationsConcurrent(rr, req); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if rr.Header().Get("X-Adaptive-Precision-Reached") != "true" {
+		t.Error("Expected the precision to be reached")
+	}
+
+	runs, _ := strconv.Atoi(rr.Header().Get("X-Adaptive-Runs"))
+	body := []any{}
+
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal("Issue decoding response: ", err.Error())
+	}
+
+	if runs < 5 || runs >= 50 || len(body) != runs {
+		t.Error("Expected between 5 and 50 runs in header and body, got: ", runs, len(body))
+	}
+}
+
+func TestAPIServer_AdaptiveMultipleSimulationsCap(t *testing.T) {
+	fmt.Println("Running simulations until the cap with a precision out of reach")
+	req := httptest.NewRequest("GET", "/api/new_multiple_sim/8?precision=0.0001&metric=area_under_curve&creature_type=creature2", nil)
+	req = mux.SetURLVars(req, map[string]string{"iterations": "8"})
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+
+	if err := s.HandleMultipleRandomSimulationsConcurrent(rr, req); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if rr.Header().Get("X-Adaptive-Precision-Reached") != "false" {
+		t.Error("Expected the precision not to be reached")
+	}
+
+	runs, _ := strconv.Atoi(rr.Header().Get("X-Adaptive-Runs"))
+	failed, _ := strconv.Atoi(rr.Header().Get("X-Adaptive-Failed"))
+
+	if runs+failed != 8 {
+		t.Error("Expected 8 runs, got: ", runs, failed)
+	}
+
+	if rr.Header().Get("X-Adaptive-Max-Runs") != "8" || rr.Header().Get("X-Adaptive-Stopped") != "max_runs" {
+		t.Error("Expected the cap of 8 runs to be reported, got: ", rr.Header().Get("X-Adaptive-Max-Runs"), rr.Header().Get("X-Adaptive-Stopped"))
+	}
+}
+
+func TestAPIServer_AdaptiveMultipleSimulationsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req := httptest.NewRequest("GET", "/api/new_multiple_sim/100?precision=0.0001", nil).WithContext(ctx)
+	req = mux.SetURLVars(req, map[string]string{"iterations": "100"})
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+
+	if err := s.HandleMultipleRandomSimulationsConcurrent(rr, req); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if rr.Header().Get("X-Adaptive-Stopped") != "cancelled" || rr.Header().Get("X-Adaptive-Runs") != "0" {
+		t.Error("Expected no runs after the request was cancelled, got: ", rr.Header().Get("X-Adaptive-Stopped"), rr.Header().Get("X-Adaptive-Runs"))
+	}
+}
@@ -5,28 +5,115 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
+	ldb "github.com/sebastianring/simgameserver/db"
+	"github.com/sebastianring/simgameserver/redact"
 	sc "github.com/sebastianring/simgameserver/simconfig"
-	"log"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
-func (s *APIServer) Run() {
+// NewRouter function    Returns the router with every route, an error if the
+// auth or limit config of the environment is invalid.
+func (s *APIServer) NewRouter() (*mux.Router, error) {
+	auth, err := getAuthConfig()
+
+	if err != nil {
+		return nil, err
+	}
+
+	limits, err := getLimitConfig()
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.auth = auth
+	s.limits = newRateLimiter(limits)
 	router := mux.NewRouter()
+	router.Use(s.WithRequestID)
+	router.Use(s.WithTracing)
+	router.Use(s.WithMetrics)
+	router.Use(s.WithJWTAuth)
+	router.Use(s.WithWorkspace)
+	router.Use(s.WithRateLimit)
 	router.HandleFunc("/api/new_single_sim", makeHTTPHandleFunc(s.HandleSingleSimulation))
 	router.HandleFunc("/api/new_multiple_sim/{iterations:[1-9][0-9]*}", makeHTTPHandleFunc(s.HandleMultipleRandomSimulationsConcurrent))
+	router.HandleFunc("/api/stream/multiple_sim/{iterations:[1-9][0-9]*}", makeStreamHandleFunc(s.HandleMultipleRandomSimulationsStream))
+	router.HandleFunc("/api/ws/replay", makeStreamHandleFunc(s.HandleReplay))
 	router.HandleFunc("/api/new_random_sim", makeHTTPHandleFunc(s.HandleSingleRandomSimulation))
+	router.HandleFunc("/api/chart/new_single_sim", makeHTTPHandleFunc(s.HandleSingleSimulationChart))
+	router.HandleFunc("/api/chart/new_multiple_sim/{iterations:[1-9][0-9]*}", makeHTTPHandleFunc(s.HandleMultipleSimulationsChart))
+	router.HandleFunc("/api/chart/sim/{id:[0-9a-fA-F-]+}", makeHTTPHandleFunc(s.HandleStoredRunChart))
+	router.HandleFunc("/api/gif/new_single_sim", makeHTTPHandleFunc(s.HandleSimulationGIF))
 	router.HandleFunc("/new_sim_form", makeHTTPHandleFunc(s.HandleSimForm))
+	router.Handle("/", http.RedirectHandler("/ui/", http.StatusFound))
+	router.HandleFunc("/ui/", makeHTTPHandleFunc(s.HandleUIIndex))
+	router.HandleFunc("/ui/run", makeHTTPHandleFunc(s.HandleUIRun))
+	router.HandleFunc("/ui/sim/{id:[0-9a-fA-F-]+}", makeHTTPHandleFunc(s.HandleUIStoredRun))
+	router.HandleFunc("/ui/history", makeHTTPHandleFunc(s.HandleUIHistory))
+	router.HandleFunc("/ui/compare", makeHTTPHandleFunc(s.HandleUICompare))
+	router.HandleFunc("/api/compare", makeStreamHandleFunc(s.HandleCompare))
+	router.HandleFunc("/api/experiment", makeStreamHandleFunc(s.HandleExperiment))
+	router.HandleFunc("/api/sensitivity", makeStreamHandleFunc(s.HandleSensitivity))
+	router.HandleFunc("/api/search", makeStreamHandleFunc(s.HandleSearch))
+	router.HandleFunc("/api/batch", makeStreamHandleFunc(s.HandleBatch))
+	router.HandleFunc("/api/presets", makeHTTPHandleFunc(s.HandlePresets))
+	router.HandleFunc("/api/presets/{name}", makeHTTPHandleFunc(s.HandlePreset))
+	router.HandleFunc("/api/presets/{name}/versions", makeHTTPHandleFunc(s.HandlePresetVersions))
 	router.HandleFunc("/api/sim/{id:[0-9a-fA-F-]+}", makeHTTPHandleFunc(s.HandleSims))
+	router.HandleFunc("/api/sim/{id:[0-9a-fA-F-]+}/rounds", makeHTTPHandleFunc(s.HandleSimRounds))
+	router.HandleFunc("/api/token", makeHTTPHandleFunc(s.HandleToken))
+	router.HandleFunc("/api/keys", makeHTTPHandleFunc(s.HandleAPIKeys))
+	router.HandleFunc("/api/keys/{id}", makeHTTPHandleFunc(s.HandleAPIKey))
+	router.HandleFunc("/api/workspaces", makeHTTPHandleFunc(s.HandleWorkspaces))
+	router.HandleFunc("/api/audit", makeHTTPHandleFunc(s.HandleAudit))
+	router.HandleFunc("/.well-known/jwks.json", makeHTTPHandleFunc(s.HandleJWKS))
+	router.Handle("/metrics", getMetricsHandler())
+
+	return router, nil
+}
+
+func (s *APIServer) Run() {
+	router, err := s.NewRouter()
+
+	if err != nil {
+		slog.Error("Invalid server config", "error", err)
+		os.Exit(1)
+	}
 
-	log.Println("API server started running on port", s.listenAddr)
-	err := http.ListenAndServe(s.listenAddr, router)
+	if s.auth.enabled && !ldb.IsConfigured() {
+		slog.Error("Auth needs a db for the audit log", "error", errNoAuditDB)
+		os.Exit(1)
+	}
+
+	if s.auth.enabled {
+		slog.Info("Auth is enabled", "issuer", s.auth.issuer, "audience", s.auth.audience)
+	}
+
+	if s.auth.keys != nil {
+		go s.auth.keys.Rotate(time.Minute)
+	}
+
+	shutdownTracing, err := setupTracing(context.Background())
 
 	if err != nil {
-		log.Println(err)
+		slog.Error("Invalid tracing config", "error", err)
+		os.Exit(1)
+	}
+
+	defer shutdownTracing(context.Background())
+
+	slog.Info("API server started", "addr", s.listenAddr)
+	err = http.ListenAndServe(s.listenAddr, router)
+
+	if err != nil {
+		slog.Error("API server stopped", "error", err)
 	}
 }
 
@@ -46,6 +133,22 @@ func (s *APIServer) HandleMultipleRandomSimulationsConcurrent(w http.ResponseWri
 	return fmt.Errorf("Method not allowed, %s", r.Method)
 }
 
+func (s *APIServer) HandleMultipleRandomSimulationsStream(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.streamMultipleRandomSimulations(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandleReplay(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.replaySimulation(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
 func (s *APIServer) HandleSingleRandomSimulation(w http.ResponseWriter, r *http.Request) error {
 	if r.Method == "GET" {
 		return s.newRandomSimulation(w, r)
@@ -54,9 +157,44 @@ func (s *APIServer) HandleSingleRandomSimulation(w http.ResponseWriter, r *http.
 	return fmt.Errorf("Method not allowed, %s", r.Method)
 }
 
+func (s *APIServer) HandleSingleSimulationChart(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getSingleSimulationChart(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandleMultipleSimulationsChart(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getMultipleSimulationsChart(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandleStoredRunChart(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getStoredRunChart(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandleSimulationGIF(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getSimulationGIF(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+// HandleSimForm function    The form has moved to /ui/, posting to it still
+// runs a simulation and returns json.
 func (s *APIServer) HandleSimForm(w http.ResponseWriter, r *http.Request) error {
 	if r.Method == "GET" {
-		return s.getSimulationForm(w, r)
+		http.Redirect(w, r, "/ui/", http.StatusMovedPermanently)
+		return nil
 	} else if r.Method == "POST" {
 		return s.newSingleSimulation(w, r)
 	}
@@ -64,6 +202,170 @@ func (s *APIServer) HandleSimForm(w http.ResponseWriter, r *http.Request) error
 	return fmt.Errorf("Method not allowed, %s", r.Method)
 }
 
+func (s *APIServer) HandleUIIndex(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getUIIndex(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandleUIRun(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getUIRun(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandleUIStoredRun(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getUIStoredRun(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandleUIHistory(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getUIHistory(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandleUICompare(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getUICompare(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+// HandleCompare function    GET compares stored runs, POST simulates the
+// configs of the body before comparing them.
+func (s *APIServer) HandleCompare(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getStoredComparison(w, r)
+	} else if r.Method == "POST" {
+		return s.newComparison(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandleExperiment(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "POST" {
+		return s.newExperiment(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandleSensitivity(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getSensitivityAnalysis(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandleSearch(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "POST" {
+		return s.newSearch(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandleBatch(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "POST" {
+		return s.newBatch(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandlePresets(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getPresets(w, r)
+	} else if r.Method == "POST" {
+		return s.newPreset(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandlePreset(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getNamedPreset(w, r)
+	} else if r.Method == "PUT" {
+		return s.replacePreset(w, r)
+	} else if r.Method == "DELETE" {
+		return s.deletePreset(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandlePresetVersions(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getPresetVersions(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandleToken(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "POST" {
+		return s.newToken(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandleWorkspaces(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getWorkspaces(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandleAudit(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getAuditEntries(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandleJWKS(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getJWKS(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandleAPIKeys(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getAPIKeys(w, r)
+	} else if r.Method == "POST" {
+		return s.newAPIKey(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
+func (s *APIServer) HandleAPIKey(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "DELETE" {
+		return s.revokeAPIKey(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
 func (s *APIServer) HandleSims(w http.ResponseWriter, r *http.Request) error {
 	if r.Method == "GET" {
 		return s.getBoardFromDb(w, r)
@@ -74,8 +376,18 @@ func (s *APIServer) HandleSims(w http.ResponseWriter, r *http.Request) error {
 	return fmt.Errorf("Method not allowed, %s", r.Method)
 }
 
+func (s *APIServer) HandleSimRounds(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == "GET" {
+		return s.getRoundsFromDb(w, r)
+	}
+
+	return fmt.Errorf("Method not allowed, %s", r.Method)
+}
+
 type APIServer struct {
 	listenAddr string
+	auth       *authConfig
+	limits     *rateLimiter
 }
 
 func WriteJSON(w http.ResponseWriter, status int, v any) error {
@@ -90,61 +402,156 @@ type ApiError struct {
 
 type apiFunc func(w http.ResponseWriter, r *http.Request) error
 
-func makeHTTPHandleFunc(f apiFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		ctx, cancel := context.WithTimeout(context.Background(), 10000*time.Millisecond)
-		defer cancel()
+// handlerTimeout is how long makeHTTPHandleFunc waits for a handler.
+const handlerTimeout = 10 * time.Second
+
+// timeoutWriter is the response writer of a handler with a timeout, it keeps
+// the headers of the handler until it writes and drops every write after the
+// timeout, so the handler goroutine never touches the response once the
+// timeout response is sent.
+type timeoutWriter struct {
+	w           http.ResponseWriter
+	header      http.Header
+	mu          sync.Mutex
+	timedOut    bool
+	wroteHeader bool
+}
 
-		done := make(chan bool)
-		err := errors.New("")
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
 
-		go func() {
-			err = f(w, r)
-			close(done)
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
 
-			if err != nil {
-				WriteJSON(w, http.StatusBadRequest, ApiError{Error: err.Error()})
-			}
-		}()
+	tw.writeHeader(status)
+}
 
-		select {
-		case <-ctx.Done():
-			close(done)
+func (tw *timeoutWriter) writeHeader(status int) {
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
 
-			WriteJSON(w, http.StatusGatewayTimeout, ApiError{Error: "Operation timed out."})
+	for key, values := range tw.header {
+		tw.w.Header()[key] = values
+	}
 
-		case <-done:
+	tw.wroteHeader = true
+	tw.w.WriteHeader(status)
+}
 
-		}
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
 	}
+
+	tw.writeHeader(http.StatusOK)
+
+	return tw.w.Write(b)
 }
 
-func validateJWT(tokenString string) (*jwt.Token, error) {
-	secret := os.Getenv("JWT_SECRET")
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if f, ok := tw.w.(http.Flusher); ok && !tw.timedOut {
+		f.Flush()
+	}
+}
+
+// writeTrailers function    Copies the trailers declared in the Trailer
+// header, the handler sets them after writing its response.
+func (tw *timeoutWriter) writeTrailers() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || !tw.wroteHeader {
+		return
+	}
+
+	for _, declared := range tw.header.Values("Trailer") {
+		for _, key := range strings.Split(declared, ",") {
+			key = http.CanonicalHeaderKey(strings.TrimSpace(key))
 
-	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v ", token.Header["alg"])
+			if values, ok := tw.header[key]; ok {
+				tw.w.Header()[key] = values
+			}
 		}
+	}
+}
+
+// timeout function    Sends the timeout response unless the handler has
+// started its own, every later write of the handler is dropped.
+func (tw *timeoutWriter) timeout() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if !tw.wroteHeader {
+		WriteJSON(tw.w, http.StatusGatewayTimeout, ApiError{Error: "Operation timed out."})
+	}
 
-		return []byte(secret), nil
-	})
+	tw.timedOut = true
 }
 
-func WithJWTAuth(handlerFunc http.HandlerFunc) http.HandlerFunc {
+// writeError function    Sends the error of a handler as json with status
+// 400, or 429 with Retry-After when a run did not fit in the quota.
+func writeError(w http.ResponseWriter, err error) {
+	var quotaErr *quotaExceededError
+
+	if errors.As(err, &quotaErr) {
+		writeTooManyRequests(w, quotaErr.reset, quotaErr.Error())
+		return
+	}
+
+	WriteJSON(w, http.StatusBadRequest, ApiError{Error: redact.String(err.Error())})
+}
+
+// makeHTTPHandleFunc function    Wraps a handler, an error it returns is sent
+// by writeError. The handler gets handlerTimeout, then its context
+// is cancelled and 504 is sent, it can keep running but its writes are
+// dropped.
+func makeHTTPHandleFunc(f apiFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		log.Println("Calling middleware JWT Auth.")
+		ctx, cancel := context.WithTimeout(r.Context(), handlerTimeout)
+		defer cancel()
 
-		tokenString := r.Header.Get("x-jwt-token")
+		tw := timeoutWriter{w: w, header: http.Header{}}
+		done := make(chan struct{})
 
-		_, err := validateJWT(tokenString)
+		go func() {
+			defer close(done)
 
-		if err != nil {
-			WriteJSON(w, http.StatusForbidden, ApiError{Error: "Issue validating JWT: " + err.Error()})
-			return
+			if err := f(&tw, r.WithContext(ctx)); err != nil {
+				trace.SpanFromContext(ctx).RecordError(err)
+				writeError(&tw, err)
+			}
+		}()
+
+		select {
+		case <-done:
+			tw.writeTrailers()
+		case <-ctx.Done():
+			tw.timeout()
 		}
+	}
+}
 
-		handlerFunc(w, r)
+// makeStreamHandleFunc function    Same as makeHTTPHandleFunc but without the
+// timeout, for handlers streaming their response for as long as the client
+// is connected or running more simulations than fit in the timeout. Errors
+// can only be returned before the stream has started.
+func makeStreamHandleFunc(f apiFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := f(w, r)
+
+		if err != nil {
+			trace.SpanFromContext(r.Context()).RecordError(err)
+			writeError(w, err)
+		}
 	}
 }
 
@@ -153,5 +560,6 @@ func NewAPIServer(listenAddr string) *APIServer {
 	sc.InitRules()
 	return &APIServer{
 		listenAddr: listenAddr,
+		auth:       &authConfig{},
 	}
 }
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	sg "github.com/sebastianring/simulationgame"
+)
+
+const maxBatchRuns = 200
+
+// batchItem is one config of POST /api/batch. A seeded item runs repetition i
+// with seed+i, since runs with the same seed are identical.
+type batchItem struct {
+	Label       string                 `json:"label"`
+	Config      map[string]json.Number `json:"config"`
+	Repetitions int                    `json:"repetitions"`
+	Seed        *int64                 `json:"seed"`
+}
+
+type batchRun struct {
+	RunID        string             `json:"run_id"`
+	Seed         *int64             `json:"seed,omitempty"`
+	RoundsPlayed int                `json:"rounds_played"`
+	Rounds       []*simpleRoundData `json:"rounds"`
+}
+
+// batchItemResult is the outcome of one item, status is ok when every run
+// finished, partial when some of them failed and failed when none finished or
+// the config was invalid.
+type batchItemResult struct {
+	Status string               `json:"status"`
+	Config *sg.SimulationConfig `json:"config,omitempty"`
+	Runs   []batchRun           `json:"runs"`
+	Errors []string             `json:"errors,omitempty"`
+}
+
+type batchResult struct {
+	Runs    int                         `json:"runs"`
+	Failed  int                         `json:"failed"`
+	Results map[string]*batchItemResult `json:"results"`
+}
+
+// getBatchItems function    Decodes the body, gives items without a label
+// their position as label and checks the number of runs.
+func getBatchItems(r *http.Request) ([]batchItem, error) {
+	items := []batchItem{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&items); err != nil {
+		return nil, errors.New("Invalid request body, should be an array of configs: " + err.Error())
+	}
+
+	if len(items) == 0 {
+		return nil, errors.New("At least one config is needed.")
+	}
+
+	labels := map[string]bool{}
+	runs := 0
+
+	for i := range items {
+		if items[i].Label == "" {
+			items[i].Label = strconv.Itoa(i + 1)
+		}
+
+		if labels[items[i].Label] {
+			return nil, errors.New("Label " + items[i].Label + " is given twice.")
+		}
+
+		labels[items[i].Label] = true
+
+		if items[i].Repetitions == 0 {
+			items[i].Repetitions = 1
+		}
+
+		if items[i].Repetitions < 1 {
+			return nil, errors.New("Invalid repetitions of " + items[i].Label + ", should be at least 1.")
+		}
+
+		runs += items[i].Repetitions
+	}
+
+	if runs > maxBatchRuns {
+		return nil, errors.New("Too many runs, the repetitions of all configs should be at most " + strconv.Itoa(maxBatchRuns) + ".")
+	}
+
+	return items, nil
+}
+
+// runBatch function    Runs every repetition of every item on the shared
+// simulation pool. An invalid config or a failed run is reported on its item
+// and does not fail the batch.
+func runBatch(ctx context.Context, items []batchItem, base url.Values) *batchResult {
+	result := batchResult{Results: map[string]*batchItemResult{}}
+	jobs := []simulationJob{}
+	owners := []*batchItemResult{}
+
+	for _, item := range items {
+		itemResult := batchItemResult{Runs: []batchRun{}}
+		result.Results[item.Label] = &itemResult
+		config, err := getBodyConfig(base, item.Config)
+
+		if err != nil {
+			itemResult.Status = "failed"
+			itemResult.Errors = append(itemResult.Errors, "Invalid config: "+err.Error())
+			continue
+		}
+
+		itemResult.Config = config
+
+		for rep := 0; rep < item.Repetitions; rep++ {
+			job := simulationJob{config: config}
+
+			if item.Seed != nil {
+				seed := *item.Seed + int64(rep)
+				job.seed = &seed
+			}
+
+			jobs = append(jobs, job)
+			owners = append(owners, &itemResult)
+		}
+	}
+
+	for i, outcome := range runJobs(ctx, jobs) {
+		result.Runs++
+		owner := owners[i]
+
+		if outcome.err != nil {
+			result.Failed++
+			owner.Errors = append(owner.Errors, outcome.err.Error())
+			continue
+		}
+
+		owner.Runs = append(owner.Runs, batchRun{
+			RunID:        outcome.run.RunID,
+			Seed:         jobs[i].seed,
+			RoundsPlayed: outcome.run.roundsPlayed(),
+			Rounds:       outcome.run.Rounds,
+		})
+	}
+
+	for _, itemResult := range result.Results {
+		if itemResult.Status != "" {
+			continue
+		}
+
+		switch {
+		case len(itemResult.Errors) == 0:
+			itemResult.Status = "ok"
+		case len(itemResult.Runs) == 0:
+			itemResult.Status = "failed"
+		default:
+			itemResult.Status = "partial"
+		}
+	}
+
+	return &result
+}
+
+func (s *APIServer) newBatch(w http.ResponseWriter, r *http.Request) error {
+	items, err := getBatchItems(r)
+
+	if err != nil {
+		return err
+	}
+
+	base, err := getPresetValues(r.Context(), r.URL.Query())
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, runBatch(r.Context(), items, base))
+}
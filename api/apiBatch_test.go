@@ -0,0 +1,103 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sebastianring/simgameserver/api"
+	sc "github.com/sebastianring/simgameserver/simconfig"
+)
+
+func TestAPIServer_Batch(t *testing.T) {
+	fmt.Println("Running a batch with a seeded, a repeated and an invalid config")
+	sc.InitRules()
+
+	body := `[
+		{"label": "seeded", "config": {"creature1": 5}, "repetitions": 2, "seed": 7},
+		{"label": "repeated", "config": {"foods": 40}, "repetitions": 3},
+		{"label": "invalid", "config": {"rows": 1000}}
+	]`
+	req := httptest.NewRequest("POST", "/api/batch", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+
+	if err := s.HandleBatch(rr, req); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	result := struct {
+		Runs    int `json:"runs"`
+		Results map[string]struct {
+			Status string `json:"status"`
+			Runs   []struct {
+				Seed *int64 `json:"seed"`
+			} `json:"runs"`
+			Errors []string `json:"errors"`
+		} `json:"results"`
+	}{}
+
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatal("Issue decoding response: ", err.Error())
+	}
+
+	if result.Runs != 5 {
+		t.Error("Expected 5 runs, got: ", result.Runs)
+	}
+
+	seeded := result.Results["seeded"]
+
+	if seeded.Status != "ok" || len(seeded.Runs) != 2 || seeded.Runs[0].Seed == nil || seeded.Runs[1].Seed == nil || *seeded.Runs[0].Seed == *seeded.Runs[1].Seed {
+		t.Error("Expected two runs with their own seeds, got: ", seeded)
+	}
+
+	if result.Results["repeated"].Status != "ok" || len(result.Results["repeated"].Runs) != 3 {
+		t.Error("Expected three runs of the repeated config, got: ", result.Results["repeated"])
+	}
+
+	if result.Results["invalid"].Status != "failed" || len(result.Results["invalid"].Errors) != 1 {
+		t.Error("Expected the invalid config to fail on its own, got: ", result.Results["invalid"])
+	}
+}
+
+func TestAPIServer_BatchInvalid(t *testing.T) {
+	for _, body := range []string{`[]`, `{"label": "a"}`, `[{"label": "a"}, {"label": "a"}]`, `[{"repetitions": 201}]`} {
+		req := httptest.NewRequest("POST", "/api/batch", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		s := api.NewAPIServer(":8080")
+
+		if err := s.HandleBatch(rr, req); err == nil {
+			t.Error("Expected an error for body: ", body)
+		}
+	}
+}
+
+func TestAPIServer_BatchStoresRuns(t *testing.T) {
+	router := getDBRouter(t)
+	headers := map[string]string{"Authorization": "Bearer " + getTestToken(t, getTestClaims("admin"))}
+
+	rr := serveAuthRequest(router, "POST", "/api/batch", `[{"label": "stored", "repetitions": 3}]`, headers)
+
+	result := struct {
+		Results map[string]struct {
+			Runs []struct {
+				RunID string `json:"run_id"`
+			} `json:"runs"`
+		} `json:"results"`
+	}{}
+
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil || len(result.Results["stored"].Runs) == 0 {
+		t.Fatal("Expected runs, got: ", rr.Code, err)
+	}
+
+	// The runs of a batch are stored together before the response is sent.
+	for _, run := range result.Results["stored"].Runs {
+		if rr := serveAuthRequest(router, "GET", "/api/sim/"+run.RunID+"/rounds", "", headers); rr.Code != http.StatusOK {
+			t.Error("Expected the run to be stored, got: ", run.RunID, rr.Code, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastianring/simgameserver/chart"
+	"github.com/sebastianring/simgameserver/stats"
+	sg "github.com/sebastianring/simulationgame"
+)
+
+// z value of a 95% confidence interval, used for the bands of aggregates.
+const confidenceZ = 1.96
+
+type chartOptions struct {
+	format string
+	series []sg.BoardObjectType
+	width  int
+	height int
+	theme  chart.Theme
+}
+
+func getIntOption(r *http.Request, key string, standard int, min int, max int) (int, error) {
+	value := r.URL.Query().Get(key)
+
+	if value == "" {
+		return standard, nil
+	}
+
+	v, err := strconv.Atoi(value)
+
+	if err != nil || v < min || v > max {
+		return 0, errors.New("Invalid value for " + key + ", should be between " + strconv.Itoa(min) + "-" + strconv.Itoa(max) + ".")
+	}
+
+	return v, nil
+}
+
+// getChartOptions function    Reads the chart options from the request: format
+// (svg or png, also from the Accept header), series, width, height and theme.
+func getChartOptions(r *http.Request) (*chartOptions, error) {
+	options := chartOptions{format: "svg"}
+	query := r.URL.Query()
+
+	if format := query.Get("format"); format != "" {
+		options.format = strings.ToLower(format)
+	} else {
+		for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+			mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accepted))
+
+			if mediaType == "image/png" {
+				options.format = "png"
+				break
+			} else if mediaType == "image/svg+xml" {
+				break
+			}
+		}
+	}
+
+	if options.format != "svg" && options.format != "png" {
+		return nil, errors.New("Unsupported chart format: " + options.format + ", should be svg or png.")
+	}
+
+	if series := query.Get("series"); series != "" {
+		for _, name := range strings.Split(series, ",") {
+			found := false
+
+			for _, t := range creatureTypes {
+				if creatureTypeNames[t] == name {
+					options.series = append(options.series, t)
+					found = true
+				}
+			}
+
+			if !found {
+				return nil, errors.New("Unknown series: " + name + ", should be creature1 and/or creature2.")
+			}
+		}
+	} else {
+		options.series = creatureTypes
+	}
+
+	var err error
+
+	if options.width, err = getIntOption(r, "width", 800, 200, 2000); err != nil {
+		return nil, err
+	}
+
+	if options.height, err = getIntOption(r, "height", 400, 200, 1500); err != nil {
+		return nil, err
+	}
+
+	themeName := query.Get("theme")
+
+	if themeName == "" {
+		themeName = "light"
+	}
+
+	theme, ok := chart.Themes[themeName]
+
+	if !ok {
+		return nil, errors.New("Unknown theme: " + themeName + ", should be light or dark.")
+	}
+
+	options.theme = theme
+
+	return &options, nil
+}
+
+func newPopulationChart(title string, options *chartOptions) *chart.LineChart {
+	return &chart.LineChart{
+		Title:  title,
+		XLabel: "Round",
+		YLabel: "Creatures alive at end of round",
+		Width:  options.width,
+		Height: options.height,
+		Theme:  options.theme,
+	}
+}
+
+// getRunChart function    Returns a population chart of a single run.
+func getRunChart(run *simulationRun, options *chartOptions) *chart.LineChart {
+	c := newPopulationChart("Population over time, run "+run.RunID, options)
+
+	for _, t := range options.series {
+		c.Series = append(c.Series, chart.Series{
+			Name:   creatureTypeNames[t],
+			Values: run.populationSeries(t, run.roundsPlayed()),
+		})
+	}
+
+	return c
+}
+
+// getAggregateChart function    Returns a chart of the mean population over
+// several runs, with a band of the 95% confidence interval of the mean.
+func getAggregateChart(runs []*simulationRun, options *chartOptions) *chart.LineChart {
+	c := newPopulationChart("Mean population over time, "+strconv.Itoa(len(runs))+" runs", options)
+	length := 0
+
+	for _, run := range runs {
+		if run.roundsPlayed() > length {
+			length = run.roundsPlayed()
+		}
+	}
+
+	for _, t := range options.series {
+		perRound := make([]stats.Running, length)
+
+		for _, run := range runs {
+			for i, v := range run.populationSeries(t, length) {
+				perRound[i].Add(v)
+			}
+		}
+
+		series := chart.Series{
+			Name:   creatureTypeNames[t],
+			Values: make([]float64, length),
+			Lower:  make([]float64, length),
+			Upper:  make([]float64, length),
+		}
+
+		for i := range perRound {
+			mean := perRound[i].Mean()
+			margin := confidenceZ * perRound[i].StdErr()
+			series.Values[i] = mean
+			series.Lower[i] = mean - margin
+			series.Upper[i] = mean + margin
+		}
+
+		c.Series = append(c.Series, series)
+	}
+
+	return c
+}
+
+func writeChart(w http.ResponseWriter, c *chart.LineChart, options *chartOptions) error {
+	if options.format == "png" {
+		w.Header().Set("Content-Type", "image/png")
+		return c.WritePNG(w)
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	return c.WriteSVG(w)
+}
+
+func (s *APIServer) getStoredRunChart(w http.ResponseWriter, r *http.Request) error {
+	options, err := getChartOptions(r)
+
+	if err != nil {
+		return err
+	}
+
+	run, err := loadRun(r.Context(), mux.Vars(r)["id"])
+
+	if err != nil {
+		return err
+	}
+
+	return writeChart(w, getRunChart(run, options), options)
+}
+
+func (s *APIServer) getSingleSimulationChart(w http.ResponseWriter, r *http.Request) error {
+	options, err := getChartOptions(r)
+
+	if err != nil {
+		return err
+	}
+
+	config, err := getQueryConfig(r.Context(), r.URL.Query())
+
+	if err != nil {
+		return err
+	}
+
+	seed, seeded, err := getSeed(r.URL.Query())
+
+	if err != nil {
+		return err
+	}
+
+	var run *simulationRun
+
+	if seeded {
+		variant := fmt.Sprintf("%s/%v/%dx%d/%v", options.format, options.series, options.width, options.height, options.theme)
+
+		if checkNotModified(w, r, getETag(r.Context(), config, seed, variant)) {
+			return nil
+		}
+
+		run, err = getCachedRun(r.Context(), config, seed)
+	} else {
+		run, err = runSimulation(r.Context(), config)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return writeChart(w, getRunChart(run, options), options)
+}
+
+func (s *APIServer) getMultipleSimulationsChart(w http.ResponseWriter, r *http.Request) error {
+	options, err := getChartOptions(r)
+
+	if err != nil {
+		return err
+	}
+
+	iterations, err := getIterations(r)
+
+	if err != nil {
+		return err
+	}
+
+	intervals, err := getQueryIntervals(r.Context(), r.URL.Query())
+
+	if err != nil {
+		return err
+	}
+
+	runs := []*simulationRun{}
+
+	for run := range s.startRandomSimulations(r.Context(), iterations, intervals) {
+		runs = append(runs, run)
+	}
+
+	if len(runs) == 0 {
+		return errors.New("All simulations failed, no chart to draw.")
+	}
+
+	return writeChart(w, getAggregateChart(runs, options), options)
+}
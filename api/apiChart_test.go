@@ -0,0 +1,53 @@
+package api_test
+
+import (
+	"image/png"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastianring/simgameserver/api"
+)
+
+func TestAPIServer_MultipleSimulationsChart(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/chart/new_multiple_sim/4?theme=dark&series=creature1", nil)
+	req = mux.SetURLVars(req, map[string]string{"iterations": "4"})
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+	err := s.HandleMultipleSimulationsChart(rr, req)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	svg := rr.Body.String()
+
+	if !strings.HasPrefix(svg, "<svg") || strings.Count(svg, "<polygon") != 1 {
+		t.Error("Expected an svg with one confidence band")
+	}
+}
+
+func TestAPIServer_SingleSimulationChartAsPNG(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/chart/new_single_sim?width=300&height=200", nil)
+	req.Header.Set("Accept", "image/png")
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+	err := s.HandleSingleSimulationChart(rr, req)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	img, err := png.Decode(rr.Body)
+
+	if err != nil {
+		t.Fatal("Issue decoding png: ", err.Error())
+	}
+
+	if img.Bounds().Dx() != 300 {
+		t.Error("Wrong image width: ", img.Bounds().Dx())
+	}
+}
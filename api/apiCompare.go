@@ -0,0 +1,405 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sebastianring/simgameserver/stats"
+	sg "github.com/sebastianring/simulationgame"
+)
+
+const (
+	// Differences with a p-value below compareAlpha are reported as significant.
+	compareAlpha          = 0.05
+	maxCompareRepetitions = 50
+	maxCompareRuns        = 100
+)
+
+// compareRequest is the body of POST /api/compare, every config is simulated
+// repetitions times and becomes one group.
+type compareRequest struct {
+	Configs     []map[string]json.Number `json:"configs"`
+	Repetitions int                      `json:"repetitions"`
+}
+
+// compareGroup is a set of runs with the same config, Series is the mean
+// population per round aligned to the longest run of all groups.
+type compareGroup struct {
+	Label   string                   `json:"label"`
+	Config  *sg.SimulationConfig     `json:"config"`
+	RunIDs  []string                 `json:"run_ids"`
+	Series  map[string][]float64     `json:"series"`
+	Metrics map[string]*groupMetrics `json:"metrics"`
+	runs    []*simulationRun
+	samples map[string]*metricSamples
+}
+
+// groupMetrics are the metrics of one creature type over the runs of a group.
+// MeanExtinctionRound is nil when the type survived in every run.
+type groupMetrics struct {
+	FinalPopulation     stats.Summary `json:"final_population"`
+	AreaUnderCurve      stats.Summary `json:"area_under_curve"`
+	ExtinctionRate      float64       `json:"extinction_rate"`
+	MeanExtinctionRound *float64      `json:"mean_extinction_round"`
+}
+
+type metricSamples struct {
+	finalPopulation []float64
+	areaUnderCurve  []float64
+	extinction      []float64
+}
+
+// compareDifference is the difference of the mean of a metric between a group
+// and the baseline group. Test and Significant are nil if either group has
+// less than two values of the metric.
+type compareDifference struct {
+	Baseline     string            `json:"baseline"`
+	Group        string            `json:"group"`
+	CreatureType string            `json:"creature_type"`
+	Metric       string            `json:"metric"`
+	Difference   float64           `json:"difference"`
+	Test         *stats.TestResult `json:"test"`
+	Significant  *bool             `json:"significant"`
+}
+
+type compareResult struct {
+	Rounds      int                 `json:"rounds"`
+	Alpha       float64             `json:"alpha"`
+	Groups      []*compareGroup     `json:"groups"`
+	Differences []compareDifference `json:"differences"`
+}
+
+// getCreatureCount function    Returns the number of creatures of a type at
+// the start of a run.
+func getCreatureCount(config *sg.SimulationConfig, t sg.BoardObjectType) float64 {
+	if t == sg.Creature1Type {
+		return float64(config.Creature1)
+	}
+
+	return float64(config.Creature2)
+}
+
+// getAreaUnderCurve function    Returns the area under the population curve
+// of a run using the trapezoid rule, starting from the initial count at
+// round 0.
+func getAreaUnderCurve(run *simulationRun, t sg.BoardObjectType) float64 {
+	previous := getCreatureCount(run.Config, t)
+	area := 0.0
+
+	for _, v := range run.populationSeries(t, run.roundsPlayed()) {
+		area += (previous + v) / 2
+		previous = v
+	}
+
+	return area
+}
+
+// getExtinctionRound function    Returns the first round a type had no
+// creatures alive at the end of, false if it survived the whole run.
+func getExtinctionRound(run *simulationRun, t sg.BoardObjectType) (int, bool) {
+	for i, v := range run.populationSeries(t, run.roundsPlayed()) {
+		if v == 0 {
+			return i + 1, true
+		}
+	}
+
+	return 0, false
+}
+
+func summarize(values []float64) stats.Summary {
+	r := stats.Running{}
+
+	for _, v := range values {
+		r.Add(v)
+	}
+
+	return r.Summary()
+}
+
+func mean(values []float64) float64 {
+	return summarize(values).Mean
+}
+
+// getCompareResult function    Returns the comparison of the groups, the first
+// group is the baseline the others are compared to.
+func getCompareResult(groups []*compareGroup) *compareResult {
+	result := compareResult{Alpha: compareAlpha, Groups: groups, Differences: []compareDifference{}}
+
+	for _, g := range groups {
+		for _, run := range g.runs {
+			if run.roundsPlayed() > result.Rounds {
+				result.Rounds = run.roundsPlayed()
+			}
+		}
+	}
+
+	for _, g := range groups {
+		g.Series = map[string][]float64{}
+		g.Metrics = map[string]*groupMetrics{}
+		g.samples = map[string]*metricSamples{}
+
+		for _, t := range creatureTypes {
+			name := creatureTypeNames[t]
+			perRound := make([]stats.Running, result.Rounds)
+			samples := metricSamples{}
+
+			for _, run := range g.runs {
+				for i, v := range run.populationSeries(t, result.Rounds) {
+					perRound[i].Add(v)
+				}
+
+				samples.finalPopulation = append(samples.finalPopulation, float64(run.finalPopulation(t)))
+				samples.areaUnderCurve = append(samples.areaUnderCurve, getAreaUnderCurve(run, t))
+
+				if round, extinct := getExtinctionRound(run, t); extinct {
+					samples.extinction = append(samples.extinction, float64(round))
+				}
+			}
+
+			g.Series[name] = make([]float64, result.Rounds)
+
+			for i := range perRound {
+				g.Series[name][i] = perRound[i].Mean()
+			}
+
+			metrics := groupMetrics{
+				FinalPopulation: summarize(samples.finalPopulation),
+				AreaUnderCurve:  summarize(samples.areaUnderCurve),
+				ExtinctionRate:  float64(len(samples.extinction)) / float64(len(g.runs)),
+			}
+
+			if len(samples.extinction) > 0 {
+				m := mean(samples.extinction)
+				metrics.MeanExtinctionRound = &m
+			}
+
+			g.Metrics[name] = &metrics
+			g.samples[name] = &samples
+		}
+	}
+
+	baseline := groups[0]
+
+	for _, g := range groups[1:] {
+		for _, t := range creatureTypes {
+			name := creatureTypeNames[t]
+			a, b := baseline.samples[name], g.samples[name]
+
+			result.Differences = append(result.Differences,
+				getDifference(baseline, g, name, "final_population", a.finalPopulation, b.finalPopulation),
+				getDifference(baseline, g, name, "area_under_curve", a.areaUnderCurve, b.areaUnderCurve))
+
+			// Extinction rounds only exist for the runs where the type died out.
+			if len(a.extinction) > 0 && len(b.extinction) > 0 {
+				result.Differences = append(result.Differences,
+					getDifference(baseline, g, name, "extinction_round", a.extinction, b.extinction))
+			}
+		}
+	}
+
+	return &result
+}
+
+func getDifference(baseline *compareGroup, g *compareGroup, creatureType string, metric string, a []float64, b []float64) compareDifference {
+	d := compareDifference{
+		Baseline:     baseline.Label,
+		Group:        g.Label,
+		CreatureType: creatureType,
+		Metric:       metric,
+		Difference:   mean(b) - mean(a),
+	}
+
+	if test, err := stats.WelchTTest(b, a); err == nil {
+		significant := test.PValue < compareAlpha
+		d.Test = test
+		d.Significant = &significant
+	}
+
+	return d
+}
+
+func getConfigLabel(config *sg.SimulationConfig) string {
+	return fmt.Sprintf("rows=%d cols=%d foods=%d creature1=%d creature2=%d maxrounds=%d",
+		config.Rows, config.Cols, config.Foods, config.Creature1, config.Creature2, config.MaxRounds)
+}
+
+// getStoredComparison function    Compares stored runs, runs with the same
+// config are grouped as repetitions of each other.
+func (s *APIServer) getStoredComparison(w http.ResponseWriter, r *http.Request) error {
+	ids := []string{}
+
+	for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) < 2 {
+		return errors.New("At least two run ids are needed, please check parameter ids.")
+	}
+
+	if len(ids) > maxCompareRuns {
+		return errors.New("Too many run ids, at most " + strconv.Itoa(maxCompareRuns) + " runs can be compared.")
+	}
+
+	groups := []*compareGroup{}
+	byLabel := map[string]*compareGroup{}
+
+	for _, id := range ids {
+		run, err := loadRun(r.Context(), id)
+
+		if err != nil {
+			return err
+		}
+
+		label := getConfigLabel(run.Config)
+		g, ok := byLabel[label]
+
+		if !ok {
+			g = &compareGroup{Label: label, Config: run.Config, RunIDs: []string{}}
+			byLabel[label] = g
+			groups = append(groups, g)
+		}
+
+		g.runs = append(g.runs, run)
+		g.RunIDs = append(g.RunIDs, run.RunID)
+	}
+
+	if len(groups) < 2 {
+		return errors.New("All runs have the same config, there is nothing to compare.")
+	}
+
+	return WriteJSON(w, http.StatusOK, getCompareResult(groups))
+}
+
+// getConfigsFromCompareRequest function    Returns the validated configs of a
+// compare request, the values are converted to url values to share the
+// validation of the other endpoints. The preset of the query is the base of
+// every config.
+func getConfigsFromCompareRequest(ctx context.Context, request *compareRequest, query url.Values) ([]*sg.SimulationConfig, error) {
+	if len(request.Configs) < 2 {
+		return nil, errors.New("At least two configs are needed to compare.")
+	}
+
+	if request.Repetitions < 1 || request.Repetitions > maxCompareRepetitions {
+		return nil, errors.New("Invalid repetitions, interval should be between 1-" + strconv.Itoa(maxCompareRepetitions) + ".")
+	}
+
+	if len(request.Configs)*request.Repetitions > maxCompareRuns {
+		return nil, errors.New("Too many runs, configs times repetitions should be at most " + strconv.Itoa(maxCompareRuns) + ".")
+	}
+
+	base, err := getPresetValues(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	configs := []*sg.SimulationConfig{}
+
+	for i, values := range request.Configs {
+		config, err := getBodyConfig(base, values)
+
+		if err != nil {
+			return nil, errors.New("Invalid config " + strconv.Itoa(i+1) + ": " + err.Error())
+		}
+
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
+
+// newComparison function    Simulates every config of the request body the
+// given number of repetitions concurrently and compares the results.
+func (s *APIServer) newComparison(w http.ResponseWriter, r *http.Request) error {
+	request := compareRequest{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&request); err != nil {
+		return errors.New("Invalid request body: " + err.Error())
+	}
+
+	configs, err := getConfigsFromCompareRequest(r.Context(), &request, r.URL.Query())
+
+	if err != nil {
+		return err
+	}
+
+	labels := make([]string, len(configs))
+
+	for i := range labels {
+		labels[i] = "config " + strconv.Itoa(i+1)
+	}
+
+	groups, err := runGroups(r.Context(), configs, labels, request.Repetitions)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, getCompareResult(groups))
+}
+
+// runGroups function    Simulates every config the given number of
+// repetitions on the shared simulation pool, failed runs are left out of
+// their group. Runs not started when ctx is done are skipped and an error is
+// returned.
+func runGroups(ctx context.Context, configs []*sg.SimulationConfig, labels []string, repetitions int) ([]*compareGroup, error) {
+	ctx, storeRuns := startStoreBatch(ctx)
+	defer storeRuns()
+
+	groups := make([]*compareGroup, len(configs))
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+
+	for i, config := range configs {
+		groups[i] = &compareGroup{Label: labels[i], Config: config, RunIDs: []string{}}
+
+		g := groups[i]
+
+		for rep := 0; rep < repetitions && ctx.Err() == nil; rep++ {
+			wg.Add(1)
+			simulationPool.Submit(func() {
+				defer wg.Done()
+
+				if ctx.Err() != nil {
+					return
+				}
+
+				run, err := runSimulation(ctx, g.Config)
+
+				if err != nil {
+					return
+				}
+
+				mu.Lock()
+				g.runs = append(g.runs, run)
+				g.RunIDs = append(g.RunIDs, run.RunID)
+				mu.Unlock()
+			})
+		}
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, errors.New("Simulations stopped before all runs were done: " + err.Error())
+	}
+
+	for _, g := range groups {
+		if len(g.runs) == 0 {
+			return nil, errors.New("All simulations of " + g.Label + " failed, nothing to compare.")
+		}
+	}
+
+	return groups, nil
+}
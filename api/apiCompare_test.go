@@ -0,0 +1,85 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sebastianring/simgameserver/api"
+)
+
+func TestAPIServer_CompareConfigs(t *testing.T) {
+	fmt.Println("Comparing two configs with three repetitions each")
+
+	body := `{"configs": [{"creature1": 5, "creature2": 5}, {"creature1": 20, "creature2": 5}], "repetitions": 3}`
+	req := httptest.NewRequest("POST", "/api/compare", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+	err := s.HandleCompare(rr, req)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	result := struct {
+		Rounds int `json:"rounds"`
+		Groups []struct {
+			Label  string               `json:"label"`
+			RunIDs []string             `json:"run_ids"`
+			Series map[string][]float64 `json:"series"`
+		} `json:"groups"`
+		Differences []struct {
+			Metric      string `json:"metric"`
+			Significant *bool  `json:"significant"`
+		} `json:"differences"`
+	}{}
+
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatal("Issue decoding response: ", err.Error())
+	}
+
+	if len(result.Groups) != 2 {
+		t.Fatal("Expected 2 groups, got: ", len(result.Groups))
+	}
+
+	for _, g := range result.Groups {
+		if len(g.Series["creature1"]) != result.Rounds {
+			t.Error("Expected series aligned to ", result.Rounds, " rounds in ", g.Label)
+		}
+	}
+
+	if len(result.Differences) < 4 {
+		t.Error("Expected final population and area differences for both creature types")
+	}
+}
+
+func TestAPIServer_CompareNeedsTwoConfigs(t *testing.T) {
+	body := `{"configs": [{"creature1": 5}], "repetitions": 3}`
+	req := httptest.NewRequest("POST", "/api/compare", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+
+	if err := s.HandleCompare(rr, req); err == nil {
+		t.Error("Expected an error comparing a single config")
+	}
+}
+
+func TestAPIServer_CompareStopsWithTheRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	body := `{"configs": [{"creature1": 5}, {"creature1": 20}], "repetitions": 50}`
+	req := httptest.NewRequest("POST", "/api/compare", strings.NewReader(body)).WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+
+	if err := s.HandleCompare(rr, req); err == nil || !strings.Contains(err.Error(), "stopped") {
+		t.Error("Expected the comparison to stop with its request, got: ", err)
+	}
+}
@@ -0,0 +1,298 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/sebastianring/simgameserver/stats"
+	sg "github.com/sebastianring/simulationgame"
+)
+
+// Outcomes of a run, the creature type with the most creatures alive at the
+// end wins.
+var winOutcomes = []string{"creature1", "creature2", "draw"}
+
+var corrections = map[string]func([]float64) []float64{
+	"holm":       stats.HolmCorrection,
+	"bonferroni": stats.BonferroniCorrection,
+	"none":       func(p []float64) []float64 { return p },
+}
+
+// experimentRequest is the body of POST /api/experiment, every group is
+// simulated repetitions times.
+type experimentRequest struct {
+	Groups []struct {
+		Label  string                 `json:"label"`
+		Config map[string]json.Number `json:"config"`
+	} `json:"groups"`
+	Repetitions int    `json:"repetitions"`
+	Correction  string `json:"correction"`
+}
+
+type experimentGroup struct {
+	Label           string                   `json:"label"`
+	Config          *sg.SimulationConfig     `json:"config"`
+	RunIDs          []string                 `json:"run_ids"`
+	Wins            map[string]int           `json:"wins"`
+	FinalPopulation map[string]stats.Summary `json:"final_population"`
+}
+
+// experimentTest is one hypothesis test between the listed groups, the
+// p-value is adjusted for the other tests of the same kind when there are
+// more than two groups.
+type experimentTest struct {
+	Groups         []string          `json:"groups"`
+	CreatureType   string            `json:"creature_type,omitempty"`
+	Metric         string            `json:"metric"`
+	Result         *stats.TestResult `json:"result"`
+	AdjustedPValue float64           `json:"adjusted_p_value"`
+	Significant    bool              `json:"significant"`
+}
+
+type experimentResult struct {
+	Repetitions int               `json:"repetitions"`
+	Alpha       float64           `json:"alpha"`
+	Correction  string            `json:"correction"`
+	Groups      []experimentGroup `json:"groups"`
+	Tests       []*experimentTest `json:"tests"`
+}
+
+// getWinner function    Returns the outcome of a run, a draw if both types
+// have the same number of creatures alive at the end.
+func getWinner(run *simulationRun) string {
+	c1 := run.finalPopulation(sg.Creature1Type)
+	c2 := run.finalPopulation(sg.Creature2Type)
+
+	if c1 > c2 {
+		return "creature1"
+	} else if c2 > c1 {
+		return "creature2"
+	}
+
+	return "draw"
+}
+
+func getWinCounts(g *compareGroup) []float64 {
+	counts := make([]float64, len(winOutcomes))
+
+	for _, run := range g.runs {
+		for i, outcome := range winOutcomes {
+			if getWinner(run) == outcome {
+				counts[i]++
+			}
+		}
+	}
+
+	return counts
+}
+
+func getFinalPopulations(g *compareGroup, t sg.BoardObjectType) []float64 {
+	values := []float64{}
+
+	for _, run := range g.runs {
+		values = append(values, float64(run.finalPopulation(t)))
+	}
+
+	return values
+}
+
+// getExperimentTests function    Returns the tests of every pair of groups: a
+// Welch t-test and a Mann-Whitney U test of the final population of each
+// creature type and a chi-square test of the wins. With more than two groups
+// a chi-square test of the wins of all groups is added.
+func getExperimentTests(groups []*compareGroup) ([]*experimentTest, error) {
+	tests := []*experimentTest{}
+
+	for i := 0; i < len(groups); i++ {
+		for j := i + 1; j < len(groups); j++ {
+			a, b := groups[i], groups[j]
+			labels := []string{a.Label, b.Label}
+
+			for _, t := range creatureTypes {
+				welch, err := stats.WelchTTest(getFinalPopulations(a, t), getFinalPopulations(b, t))
+
+				if err != nil {
+					return nil, err
+				}
+
+				mannWhitney, err := stats.MannWhitneyU(getFinalPopulations(a, t), getFinalPopulations(b, t))
+
+				if err != nil {
+					return nil, err
+				}
+
+				tests = append(tests,
+					&experimentTest{Groups: labels, CreatureType: creatureTypeNames[t], Metric: "final_population", Result: welch},
+					&experimentTest{Groups: labels, CreatureType: creatureTypeNames[t], Metric: "final_population", Result: mannWhitney})
+			}
+
+			chiSquare, err := stats.ChiSquareTest([][]float64{getWinCounts(a), getWinCounts(b)})
+
+			if err != nil {
+				return nil, err
+			}
+
+			tests = append(tests, &experimentTest{Groups: labels, Metric: "wins", Result: chiSquare})
+		}
+	}
+
+	if len(groups) > 2 {
+		table := [][]float64{}
+		labels := []string{}
+
+		for _, g := range groups {
+			table = append(table, getWinCounts(g))
+			labels = append(labels, g.Label)
+		}
+
+		chiSquare, err := stats.ChiSquareTest(table)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tests = append(tests, &experimentTest{Groups: labels, Metric: "wins", Result: chiSquare})
+	}
+
+	return tests, nil
+}
+
+// adjustPValues function    Adjusts the p-values of the pairwise tests per
+// kind of test, metric and creature type.
+func adjustPValues(tests []*experimentTest, correct func([]float64) []float64) {
+	families := map[string][]*experimentTest{}
+	order := []string{}
+
+	for _, test := range tests {
+		key := test.Result.Test + "/" + test.Metric + "/" + test.CreatureType
+
+		// Tests of all groups at once have nothing to be corrected for.
+		if len(test.Groups) > 2 {
+			key += "/all"
+		}
+
+		if _, ok := families[key]; !ok {
+			order = append(order, key)
+		}
+
+		families[key] = append(families[key], test)
+	}
+
+	for _, key := range order {
+		pValues := []float64{}
+
+		for _, test := range families[key] {
+			pValues = append(pValues, test.Result.PValue)
+		}
+
+		for i, p := range correct(pValues) {
+			families[key][i].AdjustedPValue = p
+			families[key][i].Significant = p < compareAlpha
+		}
+	}
+}
+
+// newExperiment function    Simulates the groups of the request body and
+// tests if their outcomes differ.
+func (s *APIServer) newExperiment(w http.ResponseWriter, r *http.Request) error {
+	request := experimentRequest{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&request); err != nil {
+		return errors.New("Invalid request body: " + err.Error())
+	}
+
+	if request.Correction == "" {
+		request.Correction = "holm"
+	}
+
+	correct, ok := corrections[request.Correction]
+
+	if !ok {
+		return errors.New("Unknown correction: " + request.Correction + ", should be holm, bonferroni or none.")
+	}
+
+	if request.Repetitions < 2 {
+		return errors.New("At least two repetitions per group are needed to test for differences.")
+	}
+
+	compare := compareRequest{Repetitions: request.Repetitions}
+	labels := []string{}
+	seen := map[string]bool{}
+
+	for i, g := range request.Groups {
+		label := g.Label
+
+		if label == "" {
+			label = "group " + strconv.Itoa(i+1)
+		}
+
+		if seen[label] {
+			return errors.New("Duplicate group label: " + label)
+		}
+
+		seen[label] = true
+		labels = append(labels, label)
+		compare.Configs = append(compare.Configs, g.Config)
+	}
+
+	configs, err := getConfigsFromCompareRequest(r.Context(), &compare, r.URL.Query())
+
+	if err != nil {
+		return err
+	}
+
+	groups, err := runGroups(r.Context(), configs, labels, request.Repetitions)
+
+	if err != nil {
+		return err
+	}
+
+	tests, err := getExperimentTests(groups)
+
+	if err != nil {
+		return err
+	}
+
+	if len(groups) > 2 {
+		adjustPValues(tests, correct)
+	} else {
+		adjustPValues(tests, corrections["none"])
+	}
+
+	result := experimentResult{
+		Repetitions: request.Repetitions,
+		Alpha:       compareAlpha,
+		Correction:  request.Correction,
+		Tests:       tests,
+	}
+
+	if len(groups) <= 2 {
+		result.Correction = "none"
+	}
+
+	for _, g := range groups {
+		eg := experimentGroup{
+			Label:           g.Label,
+			Config:          g.Config,
+			RunIDs:          g.RunIDs,
+			Wins:            map[string]int{},
+			FinalPopulation: map[string]stats.Summary{},
+		}
+
+		for i, count := range getWinCounts(g) {
+			eg.Wins[winOutcomes[i]] = int(count)
+		}
+
+		for _, t := range creatureTypes {
+			eg.FinalPopulation[creatureTypeNames[t]] = summarize(getFinalPopulations(g, t))
+		}
+
+		result.Groups = append(result.Groups, eg)
+	}
+
+	return WriteJSON(w, http.StatusOK, &result)
+}
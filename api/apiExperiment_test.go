@@ -0,0 +1,90 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sebastianring/simgameserver/api"
+)
+
+func TestAPIServer_Experiment(t *testing.T) {
+	fmt.Println("Running an experiment with three groups")
+
+	body := `{"groups": [{"label": "few", "config": {"creature2": 2}}, {"label": "some", "config": {"creature2": 10}}, {"config": {"creature2": 30}}], "repetitions": 3, "correction": "bonferroni"}`
+	req := httptest.NewRequest("POST", "/api/experiment", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+	err := s.HandleExperiment(rr, req)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	result := struct {
+		Correction string `json:"correction"`
+		Groups     []struct {
+			Label string         `json:"label"`
+			Wins  map[string]int `json:"wins"`
+		} `json:"groups"`
+		Tests []struct {
+			Groups         []string `json:"groups"`
+			AdjustedPValue float64  `json:"adjusted_p_value"`
+			Result         struct {
+				Test   string  `json:"test"`
+				PValue float64 `json:"p_value"`
+			} `json:"result"`
+		} `json:"tests"`
+	}{}
+
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatal("Issue decoding response: ", err.Error())
+	}
+
+	if len(result.Groups) != 3 || result.Groups[2].Label != "group 3" {
+		t.Fatal("Expected 3 groups with a default label for the last one")
+	}
+
+	// 3 pairs with 2 tests per creature type and a chi-square test, and one
+	// chi-square test of all groups.
+	if len(result.Tests) != 3*5+1 {
+		t.Fatal("Wrong number of tests: ", len(result.Tests))
+	}
+
+	for _, test := range result.Tests {
+		if len(test.Groups) == 2 && test.AdjustedPValue < test.Result.PValue {
+			t.Error("Adjusted p-value is below the p-value of ", test.Result.Test)
+		}
+	}
+}
+
+func TestAPIServer_ExperimentUnknownCorrection(t *testing.T) {
+	body := `{"groups": [{"config": {}}, {"config": {}}], "repetitions": 3, "correction": "sidak"}`
+	req := httptest.NewRequest("POST", "/api/experiment", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+
+	if err := s.HandleExperiment(rr, req); err == nil {
+		t.Error("Expected an error for an unknown correction")
+	}
+}
+
+func TestAPIServer_ExperimentStopsWithTheRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	body := `{"groups": [{"config": {"foods": 75}}, {"config": {"foods": 100}}, {"config": {"foods": 125}}], "repetitions": 30}`
+	req := httptest.NewRequest("POST", "/api/experiment", strings.NewReader(body)).WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+
+	if err := s.HandleExperiment(rr, req); err == nil || !strings.Contains(err.Error(), "stopped") {
+		t.Error("Expected the experiment to stop with its request, got: ", err)
+	}
+}
@@ -0,0 +1,464 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	ldb "github.com/sebastianring/simgameserver/db"
+)
+
+const apiKeyPrefix = "sgk_"
+
+var errInvalidAPIKey = errors.New("Invalid api key.")
+
+// apiKeyRequest is the body of POST /api/keys, a key without workspaces owns
+// the default workspace and a key without expires_at does not expire.
+type apiKeyRequest struct {
+	Owner      string            `json:"owner"`
+	Scopes     []string          `json:"scopes"`
+	Workspaces map[string]string `json:"workspaces"`
+	ExpiresAt  *time.Time        `json:"expires_at"`
+}
+
+// newAPIKeyResponse holds the key itself, which is only shown once.
+type newAPIKeyResponse struct {
+	Key string `json:"key"`
+	*ldb.DBapiKey
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// apiKeyStore keeps the api keys, sql.ErrNoRows is returned for a missing key
+// like the db functions do.
+type apiKeyStore interface {
+	Save(key *ldb.DBapiKey) error
+	Get(id uuid.UUID) (*ldb.DBapiKey, error)
+	ListActive() ([]*ldb.DBapiKey, error)
+	Revoke(id uuid.UUID) error
+}
+
+type dbAPIKeyStore struct{}
+
+func (dbAPIKeyStore) Save(key *ldb.DBapiKey) error {
+	db, err := openStoreDB()
+
+	if err != nil {
+		return err
+	}
+
+	return ldb.SaveAPIKey(db, key)
+}
+
+func (dbAPIKeyStore) Get(id uuid.UUID) (*ldb.DBapiKey, error) {
+	db, err := openStoreDB()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ldb.GetAPIKey(db, id)
+}
+
+func (dbAPIKeyStore) ListActive() ([]*ldb.DBapiKey, error) {
+	db, err := openStoreDB()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ldb.ListActiveAPIKeys(db)
+}
+
+func (dbAPIKeyStore) Revoke(id uuid.UUID) error {
+	db, err := openStoreDB()
+
+	if err != nil {
+		return err
+	}
+
+	return ldb.RevokeAPIKey(db, id)
+}
+
+// memoryAPIKeyStore is the key store without a db, tokens of its keys stop
+// working on a restart like the keys do.
+type memoryAPIKeyStore struct {
+	mu   sync.Mutex
+	keys map[uuid.UUID]*ldb.DBapiKey
+}
+
+func (s *memoryAPIKeyStore) Save(key *ldb.DBapiKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key.CreatedAt = time.Now()
+	stored := *key
+	s.keys[key.Id] = &stored
+
+	return nil
+}
+
+func (s *memoryAPIKeyStore) Get(id uuid.UUID) (*ldb.DBapiKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	stored := *key
+
+	return &stored, nil
+}
+
+func (s *memoryAPIKeyStore) ListActive() ([]*ldb.DBapiKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := []*ldb.DBapiKey{}
+
+	for _, key := range s.keys {
+		if isActive(key) {
+			stored := *key
+			keys = append(keys, &stored)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+
+	return keys, nil
+}
+
+func (s *memoryAPIKeyStore) Revoke(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+
+	if !ok || key.RevokedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	now := time.Now()
+	key.RevokedAt = &now
+
+	return nil
+}
+
+var memoryAPIKeys = &memoryAPIKeyStore{keys: map[uuid.UUID]*ldb.DBapiKey{}}
+
+func getAPIKeyStore() apiKeyStore {
+	return selectStore[apiKeyStore](dbAPIKeyStore{}, memoryAPIKeys)
+}
+
+// getKeyWorkspaces function    Returns the workspaces of a key sorted, the
+// events of a key are audited in each of them.
+func getKeyWorkspaces(key *ldb.DBapiKey) []string {
+	if key.Workspaces == nil {
+		return []string{defaultWorkspace}
+	}
+
+	workspaces := []string{}
+
+	for workspace := range key.Workspaces {
+		workspaces = append(workspaces, workspace)
+	}
+
+	sort.Strings(workspaces)
+
+	return workspaces
+}
+
+func isActive(key *ldb.DBapiKey) bool {
+	return key.RevokedAt == nil && (key.ExpiresAt == nil || key.ExpiresAt.After(time.Now()))
+}
+
+func hashAPIKeySecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+
+	return sum[:]
+}
+
+// newAPIKey function    Creates and stores a key, the returned string is the
+// key itself: the prefix, the id as hex and a random secret.
+func newAPIKey(store apiKeyStore, request *apiKeyRequest) (string, *ldb.DBapiKey, error) {
+	request.Owner = strings.TrimSpace(request.Owner)
+
+	if request.Owner == "" {
+		return "", nil, errors.New("An api key needs an owner.")
+	}
+
+	if len(request.Scopes) == 0 {
+		return "", nil, errors.New("An api key needs at least one scope.")
+	}
+
+	for _, scope := range request.Scopes {
+		known := false
+
+		for _, s := range Scopes {
+			known = known || s == scope
+		}
+
+		if !known {
+			return "", nil, errors.New("Unknown scope: " + scope + ", should be one of " + strings.Join(Scopes, ", ") + ".")
+		}
+	}
+
+	if request.Workspaces != nil && len(request.Workspaces) == 0 {
+		return "", nil, errors.New("An api key needs at least one workspace, leave workspaces out for the default one.")
+	}
+
+	if err := validateMemberships(request.Workspaces); err != nil {
+		return "", nil, err
+	}
+
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		return "", nil, errors.New("expires_at should be in the future.")
+	}
+
+	secret := make([]byte, 32)
+
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+
+	id := uuid.New()
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	key := ldb.DBapiKey{
+		Id:         id,
+		Owner:      request.Owner,
+		Scopes:     request.Scopes,
+		Workspaces: request.Workspaces,
+		Hash:       hashAPIKeySecret(encoded),
+		ExpiresAt:  request.ExpiresAt,
+	}
+
+	if err := store.Save(&key); err != nil {
+		return "", nil, err
+	}
+
+	return apiKeyPrefix + hex.EncodeToString(id[:]) + "_" + encoded, &key, nil
+}
+
+// CreateAPIKey function    Creates a key in the db, used by the apikey
+// command to create the first admin key. The key is audited with cli as the
+// actor.
+func CreateAPIKey(owner string, scopes []string, workspaces map[string]string, expiresAt *time.Time) (string, error) {
+	if !ldb.IsConfigured() {
+		return "", errors.New("Api keys can only be created from the command line with a db, please set SIM_GAME_DB_PW or SIM_GAME_DB_PW_FILE.")
+	}
+
+	value, key, err := newAPIKey(dbAPIKeyStore{}, &apiKeyRequest{Owner: owner, Scopes: scopes, Workspaces: workspaces, ExpiresAt: expiresAt})
+
+	if err != nil {
+		return "", err
+	}
+
+	after, err := json.Marshal(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, workspace := range getKeyWorkspaces(key) {
+		entry := ldb.DBauditEntry{Actor: "cli", Workspace: workspace, Action: AuditAPIKeyCreate, Target: "apikey:" + key.Id.String(), After: after}
+
+		if err := saveAuditEntry(&entry); err != nil {
+			return "", err
+		}
+	}
+
+	return value, nil
+}
+
+// authenticateAPIKey function    Returns the stored key of a key string if it
+// is active and its secret matches. Every failure gives the same error, so
+// the response does not tell which part was wrong.
+func authenticateAPIKey(store apiKeyStore, value string) (*ldb.DBapiKey, error) {
+	rest, ok := strings.CutPrefix(value, apiKeyPrefix)
+
+	if !ok {
+		return nil, errInvalidAPIKey
+	}
+
+	idHex, secret, ok := strings.Cut(rest, "_")
+
+	if !ok {
+		return nil, errInvalidAPIKey
+	}
+
+	idBytes, err := hex.DecodeString(idHex)
+
+	if err != nil || len(idBytes) != 16 {
+		return nil, errInvalidAPIKey
+	}
+
+	key, err := store.Get(uuid.UUID(idBytes))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errInvalidAPIKey
+	} else if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare(key.Hash, hashAPIKeySecret(secret)) != 1 || !isActive(key) {
+		return nil, errInvalidAPIKey
+	}
+
+	return key, nil
+}
+
+// newToken function    Exchanges the api key in the X-API-Key header, or in
+// the api_key field of the body, for a short-lived token with its scopes.
+func (s *APIServer) newToken(w http.ResponseWriter, r *http.Request) error {
+	value := r.Header.Get("X-API-Key")
+
+	if value == "" {
+		body := struct {
+			APIKey string `json:"api_key"`
+		}{}
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return errors.New("No api key given, please use the X-API-Key header or api_key in the body.")
+		}
+
+		value = body.APIKey
+	}
+
+	key, err := authenticateAPIKey(getAPIKeyStore(), value)
+
+	if errors.Is(err, errInvalidAPIKey) {
+		w.Header().Set("WWW-Authenticate", `ApiKey realm="simgameserver"`)
+		return WriteJSON(w, http.StatusUnauthorized, ApiError{Error: err.Error()})
+	} else if err != nil {
+		return err
+	}
+
+	token, err := issueJWT(s.auth, "apikey:"+key.Id.String(), key.Owner, key.Scopes, key.Workspaces)
+
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	return WriteJSON(w, http.StatusOK, tokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.auth.tokenTTL.Seconds()),
+		Scope:       strings.Join(key.Scopes, " "),
+	})
+}
+
+func (s *APIServer) newAPIKey(w http.ResponseWriter, r *http.Request) error {
+	request := apiKeyRequest{}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return errors.New("Invalid request body: " + err.Error())
+	}
+
+	if err := validateMemberships(request.Workspaces); err != nil {
+		return err
+	}
+
+	// An admin can only hand out access to the workspaces it owns.
+	if !ownsMemberships(getOwnedWorkspaces(r), request.Workspaces) {
+		return WriteJSON(w, http.StatusForbidden, ApiError{Error: "An api key can only have workspaces you are an owner of."})
+	}
+
+	value, key, err := newAPIKey(getAPIKeyStore(), &request)
+
+	if err != nil {
+		return err
+	}
+
+	for _, workspace := range getKeyWorkspaces(key) {
+		recordWorkspaceAudit(r, workspace, AuditAPIKeyCreate, "apikey:"+key.Id.String(), nil, key)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	return WriteJSON(w, http.StatusCreated, newAPIKeyResponse{Key: value, DBapiKey: key})
+}
+
+// getAPIKeys function    Returns the active keys whose workspaces the caller
+// all owns.
+func (s *APIServer) getAPIKeys(w http.ResponseWriter, r *http.Request) error {
+	keys, err := getAPIKeyStore().ListActive()
+
+	if err != nil {
+		return err
+	}
+
+	owned := getOwnedWorkspaces(r)
+	visible := []*ldb.DBapiKey{}
+
+	for _, key := range keys {
+		if ownsMemberships(owned, key.Workspaces) {
+			visible = append(visible, key)
+		}
+	}
+
+	return WriteJSON(w, http.StatusOK, visible)
+}
+
+// revokeAPIKey function    Revokes a key so it can not get new tokens, tokens
+// it already got stay valid until they expire. Keys with a workspace the
+// caller does not own are not found.
+func (s *APIServer) revokeAPIKey(w http.ResponseWriter, r *http.Request) error {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+
+	if err != nil {
+		return errors.New("Invalid api key id: " + err.Error())
+	}
+
+	store := getAPIKeyStore()
+	before, err := store.Get(id)
+
+	if err == nil && !ownsMemberships(getOwnedWorkspaces(r), before.Workspaces) {
+		err = sql.ErrNoRows
+	}
+
+	if err == nil {
+		err = store.Revoke(id)
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("No active api key with id " + id.String() + ".")
+	} else if err != nil {
+		return err
+	}
+
+	after, err := store.Get(id)
+
+	if err != nil {
+		return err
+	}
+
+	for _, workspace := range getKeyWorkspaces(before) {
+		recordWorkspaceAudit(r, workspace, AuditAPIKeyRevoke, "apikey:"+id.String(), before, after)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
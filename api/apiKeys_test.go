@@ -0,0 +1,115 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func serveAuthRequest(router *mux.Router, method string, url string, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestAPIKeys(t *testing.T) {
+	router := getAuthRouter(t)
+	admin := map[string]string{"Authorization": "Bearer " + getTestToken(t, getTestClaims("admin"))}
+
+	rr := serveAuthRequest(router, "POST", "/api/keys", `{"owner": "ci", "scopes": ["sim:run"]}`, admin)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatal("Expected the key to be created, got: ", rr.Code, rr.Body.String())
+	}
+
+	created := struct {
+		Key string `json:"key"`
+		Id  string `json:"id"`
+	}{}
+	json.NewDecoder(rr.Body).Decode(&created)
+
+	if strings.Contains(rr.Body.String(), "hash") {
+		t.Error("Expected the hash of the key to stay private")
+	}
+
+	rr = serveAuthRequest(router, "POST", "/api/token", "", map[string]string{"X-API-Key": created.Key})
+
+	if rr.Code != http.StatusOK {
+		t.Fatal("Expected a token for the key, got: ", rr.Code, rr.Body.String())
+	}
+
+	token := struct {
+		AccessToken string `json:"access_token"`
+		Scope       string `json:"scope"`
+	}{}
+	json.NewDecoder(rr.Body).Decode(&token)
+
+	if token.Scope != "sim:run" {
+		t.Error("Expected the scopes of the key, got: ", token.Scope)
+	}
+
+	bearer := map[string]string{"Authorization": "Bearer " + token.AccessToken}
+
+	if rr := serveAuthRequest(router, "GET", "/api/new_single_sim", "", bearer); rr.Code != http.StatusOK {
+		t.Error("Expected the token to run simulations, got: ", rr.Code, rr.Body.String())
+	}
+
+	if rr := serveAuthRequest(router, "GET", "/api/keys", "", bearer); rr.Code != http.StatusForbidden {
+		t.Error("Expected the token to not manage keys, got: ", rr.Code)
+	}
+
+	rr = serveAuthRequest(router, "GET", "/api/keys", "", admin)
+
+	if !strings.Contains(rr.Body.String(), created.Id) {
+		t.Error("Expected the key among the active keys, got: ", rr.Body.String())
+	}
+
+	wrong := created.Key[:len(created.Key)-4] + "AAAA"
+
+	if rr := serveAuthRequest(router, "POST", "/api/token", `{"api_key": "`+wrong+`"}`, nil); rr.Code != http.StatusUnauthorized {
+		t.Error("Expected a wrong secret to be refused, got: ", rr.Code)
+	}
+
+	if rr := serveAuthRequest(router, "DELETE", "/api/keys/"+created.Id, "", admin); rr.Code != http.StatusNoContent {
+		t.Fatal("Expected the key to be revoked, got: ", rr.Code, rr.Body.String())
+	}
+
+	if rr := serveAuthRequest(router, "POST", "/api/token", `{"api_key": "`+created.Key+`"}`, nil); rr.Code != http.StatusUnauthorized {
+		t.Error("Expected a revoked key to be refused, got: ", rr.Code)
+	}
+
+	rr = serveAuthRequest(router, "GET", "/api/keys", "", admin)
+
+	if strings.Contains(rr.Body.String(), created.Id) {
+		t.Error("Expected the revoked key to not be listed")
+	}
+}
+
+func TestAPIKeys_Invalid(t *testing.T) {
+	router := getAuthRouter(t)
+	admin := map[string]string{"Authorization": "Bearer " + getTestToken(t, getTestClaims("admin"))}
+
+	bodies := []string{
+		`{"scopes": ["sim:run"]}`,
+		`{"owner": "ci", "scopes": []}`,
+		`{"owner": "ci", "scopes": ["sim:everything"]}`,
+		`{"owner": "ci", "scopes": ["sim:run"], "expires_at": "2001-01-01T00:00:00Z"}`,
+	}
+
+	for _, body := range bodies {
+		if rr := serveAuthRequest(router, "POST", "/api/keys", body, admin); rr.Code != http.StatusBadRequest {
+			t.Error("Expected an error for key: ", body, rr.Code)
+		}
+	}
+}
@@ -1,83 +1,151 @@
 package api
 
 import (
+	"context"
 	"errors"
-	"fmt"
-	"log"
 	"net/http"
 	"strconv"
-	"sync"
 
 	"github.com/gorilla/mux"
 	sc "github.com/sebastianring/simgameserver/simconfig"
-	sg "github.com/sebastianring/simulationgame"
 )
 
 func (s *APIServer) newMultipleRandomSimulationsConcurrent(w http.ResponseWriter, r *http.Request) error {
-	vars := mux.Vars(r)
-	var iterations uint
+	iterations, err := getIterations(r)
 
-	if len(vars["iterations"]) == 0 {
-		iterations = 10
-	} else {
-		temp, err := strconv.Atoi(vars["iterations"])
+	if err != nil {
+		return err
+	}
+
+	intervals, err := getQueryIntervals(r.Context(), r.URL.Query())
+
+	if err != nil {
+		return err
+	}
+
+	rw, err := newResultWriter(w, r, false)
+
+	if err != nil {
+		return err
+	}
+
+	if r.URL.Query().Get("precision") != "" {
+		options, err := getAdaptiveOptions(r, iterations)
 
 		if err != nil {
-			msg := "Error converting parameter iterations to uint: " + err.Error()
-			log.Println(msg)
-			return errors.New(msg)
+			return err
+		}
+
+		options.intervals = intervals
+
+		result := s.runAdaptiveSimulations(r.Context(), options)
+		result.setHeaders(w)
+
+		for _, run := range result.runs {
+			if err := rw.WriteRun(run); err != nil {
+				return err
+			}
 		}
 
-		if temp < 1 || temp > 100 {
-			msg := "Either too few or too many iterations, interval should be between 1-100." + err.Error()
-			fmt.Println(msg)
-			return errors.New(msg)
+		return rw.Close()
+	}
+
+	// Every run is written as it completes, the headers are sent with the
+	// first one so the runs returned and failed are sent as trailers.
+	w.Header().Set("Trailer", "X-Runs, X-Runs-Failed")
+	written := 0
+
+	for run := range s.startRandomSimulations(r.Context(), iterations, intervals) {
+		if err := rw.WriteRun(run); err != nil {
+			return err
 		}
 
-		iterations = uint(temp)
+		written++
 	}
 
-	boardMap := [][]*simpleRoundData{}
-	wg := sync.WaitGroup{}
+	if written == 0 {
+		return errors.New("All " + strconv.Itoa(int(iterations)) + " simulations failed.")
+	}
 
-	for i := uint(0); i < iterations; i++ {
-		wg.Add(1)
-		go func() {
-			s.runRandomSimulation(&boardMap)
-			wg.Done()
-		}()
+	if err := rw.Close(); err != nil {
+		return err
 	}
 
-	wg.Wait()
+	w.Header().Set("X-Runs", strconv.Itoa(written))
+	w.Header().Set("X-Runs-Failed", strconv.Itoa(int(iterations)-written))
+
+	return nil
+}
+
+// startRandomSimulations function    Runs random simulations on the shared
+// pool, the returned channel gets every successful run and is closed when all
+// are done. The configs are drawn from the intervals, nil means the standard
+// ones. Runs not started when ctx is done are skipped.
+func (s *APIServer) startRandomSimulations(ctx context.Context, iterations uint, intervals map[string]sc.Interval) <-chan *simulationRun {
+	ctx, storeRuns := startStoreBatch(ctx)
+	runs := make(chan *simulationRun, iterations)
+
+	done := submitIterations(ctx, iterations, func() {
+		if ctx.Err() != nil {
+			return
+		}
+
+		run, err := s.runRandomSimulation(ctx, intervals)
+
+		if err == nil {
+			runs <- run
+		}
+	})
+
+	go func() {
+		<-done
+		storeRuns()
+		close(runs)
+	}()
 
-	return WriteJSON(w, http.StatusOK, boardMap)
+	return runs
 }
 
-func (s *APIServer) runRandomSimulation(target *[][]*simpleRoundData) error {
-	sc, err := sc.GetRandomSimulationConfig()
+// runRandomSimulation function    Runs a simulation of a random config drawn
+// from the intervals, in a span of its own so that the iterations of a
+// multi-sim request are children of its span.
+func (s *APIServer) runRandomSimulation(ctx context.Context, intervals map[string]sc.Interval) (run *simulationRun, err error) {
+	ctx, span := tracer.Start(ctx, "iteration")
+	defer endSpan(span, &err)
+
+	config, err := getRandomConfig(intervals)
 
 	if err != nil {
-		log.Println(err)
-		return err
+		return nil, err
 	}
 
-	log.Println("Starting random simulation with this config: ", sc)
-
-	resultBoard, err := sg.RunSimulation(sc)
+	run, err = runSimulation(ctx, config)
 
 	if err != nil {
-		log.Println(err)
-		return err
+		return nil, err
+	}
+
+	return run, nil
+}
+
+// getIterations function    Returns the iterations path parameter, 10 if it
+// is not part of the route.
+func getIterations(r *http.Request) (uint, error) {
+	vars := mux.Vars(r)
+
+	if len(vars["iterations"]) == 0 {
+		return 10, nil
 	}
 
-	roundData, err := getRoundData(resultBoard, AliveAtEnd)
+	temp, err := strconv.Atoi(vars["iterations"])
 
 	if err != nil {
-		log.Println(err)
-		return err
+		return 0, errors.New("Error converting parameter iterations to uint: " + err.Error())
 	}
 
-	*target = append(*target, roundData)
+	if temp < 1 || temp > 100 {
+		return 0, errors.New("Either too few or too many iterations, interval should be between 1-100.")
+	}
 
-	return nil
+	return uint(temp), nil
 }
@@ -0,0 +1,76 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// flushRecorder records the length of the body at every flush.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes []int
+}
+
+func (fr *flushRecorder) Flush() {
+	fr.flushes = append(fr.flushes, fr.Body.Len())
+	fr.ResponseRecorder.Flush()
+}
+
+func TestAPIServer_MultipleSimStreamsRuns(t *testing.T) {
+	router := getLimitRouter(t, "", "0")
+	req := httptest.NewRequest("GET", "/api/new_multiple_sim/3?format=ndjson", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	rr := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal("Expected the runs, got: ", rr.Code, rr.Body.String())
+	}
+
+	// Every run is flushed on its own, before the next one is written. A run
+	// whose creatures all died in the first round has no rows.
+	if len(rr.flushes) != 3 || rr.flushes[0] > rr.flushes[1] || rr.flushes[1] > rr.flushes[2] || rr.flushes[2] != rr.Body.Len() {
+		t.Error("Expected a flush for every run, got: ", rr.flushes, rr.Body.Len())
+	}
+
+	result := rr.Result()
+
+	if result.Header.Get("X-Runs") != "" {
+		t.Error("Expected the runs to be counted after the body, got: ", result.Header)
+	}
+
+	if result.Trailer.Get("X-Runs") != "3" || result.Trailer.Get("X-Runs-Failed") != "0" {
+		t.Error("Expected the runs in the trailers, got: ", result.Trailer)
+	}
+}
+
+func TestAPIServer_MultipleSimFailedRuns(t *testing.T) {
+	router := getLimitRouter(t, `{"/api/new_multiple_sim/{iterations:[1-9][0-9]*}": {"rate": 0}}`, "400000")
+
+	// Random runs of a preset without intervals are all of the default 40 x 100
+	// cells and 50 rounds, so two of them fit in the quota.
+	req := httptest.NewRequest("POST", "/api/presets", strings.NewReader(`{"name": "quota-default-board", "config": {}}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatal("Expected the preset to be created, got: ", rr.Code, rr.Body.String())
+	}
+
+	rr = serveFrom(router, "/api/new_multiple_sim/5?preset=quota-default-board", "192.0.2.1:1234")
+	runs := [][]any{}
+
+	if err := json.NewDecoder(rr.Body).Decode(&runs); err != nil || rr.Code != http.StatusOK {
+		t.Fatal("Expected the runs that fit, got: ", rr.Code, err)
+	}
+
+	trailer := rr.Result().Trailer
+
+	if trailer.Get("X-Runs") != strconv.Itoa(len(runs)) || trailer.Get("X-Runs-Failed") != strconv.Itoa(5-len(runs)) || len(runs) > 2 {
+		t.Error("Expected the failed runs to be counted, got: ", len(runs), trailer)
+	}
+}
@@ -0,0 +1,515 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	ldb "github.com/sebastianring/simgameserver/db"
+	sc "github.com/sebastianring/simgameserver/simconfig"
+	sg "github.com/sebastianring/simulationgame"
+)
+
+var presetNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// presetRequest is the body of POST /api/presets and PUT /api/presets/{name},
+// config has the parameters of /api/new_single_sim.
+type presetRequest struct {
+	Name      string                 `json:"name"`
+	Config    map[string]json.Number `json:"config"`
+	Intervals map[string]sc.Interval `json:"intervals"`
+}
+
+// presetStore keeps every version of every preset by workspace, a saved
+// preset goes to its own workspace. The errors are the same as the ones of
+// the db functions: sql.ErrNoRows for a missing preset and
+// ldb.ErrPresetExists for a name in use. The audit entry of a change, if not
+// nil, is stored together with it.
+type presetStore interface {
+	Save(preset *ldb.DBpreset, replace bool, audit *ldb.DBauditEntry) error
+	Get(workspace string, name string, version int) (*ldb.DBpreset, error)
+	List(workspace string) ([]*ldb.DBpreset, error)
+	Versions(workspace string, name string) ([]*ldb.DBpreset, error)
+	Delete(workspace string, name string, audit *ldb.DBauditEntry) error
+}
+
+type dbPresetStore struct{}
+
+func (dbPresetStore) Save(preset *ldb.DBpreset, replace bool, audit *ldb.DBauditEntry) error {
+	db, err := openStoreDB()
+
+	if err != nil {
+		return err
+	}
+
+	return ldb.SavePreset(db, preset, replace, audit)
+}
+
+func (dbPresetStore) Get(workspace string, name string, version int) (*ldb.DBpreset, error) {
+	db, err := openStoreDB()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ldb.GetPreset(db, workspace, name, version)
+}
+
+func (dbPresetStore) List(workspace string) ([]*ldb.DBpreset, error) {
+	db, err := openStoreDB()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ldb.ListPresets(db, workspace)
+}
+
+func (dbPresetStore) Versions(workspace string, name string) ([]*ldb.DBpreset, error) {
+	db, err := openStoreDB()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ldb.GetPresetVersions(db, workspace, name)
+}
+
+func (dbPresetStore) Delete(workspace string, name string, audit *ldb.DBauditEntry) error {
+	db, err := openStoreDB()
+
+	if err != nil {
+		return err
+	}
+
+	return ldb.DeletePreset(db, workspace, name, audit)
+}
+
+type presetKey struct {
+	workspace string
+	name      string
+}
+
+// memoryPresetStore is the preset store without a db, there is no audit log
+// to store the audit entries in then.
+type memoryPresetStore struct {
+	mu      sync.Mutex
+	presets map[presetKey][]*ldb.DBpreset
+}
+
+func (s *memoryPresetStore) Save(preset *ldb.DBpreset, replace bool, audit *ldb.DBauditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := presetKey{preset.Workspace, preset.Name}
+	versions := s.presets[key]
+
+	if !replace && len(versions) > 0 {
+		return ldb.ErrPresetExists
+	} else if replace && len(versions) == 0 {
+		return sql.ErrNoRows
+	}
+
+	preset.Version = len(versions) + 1
+	preset.CreatedAt = time.Now()
+	stored := *preset
+	s.presets[key] = append(versions, &stored)
+
+	return nil
+}
+
+func (s *memoryPresetStore) Get(workspace string, name string, version int) (*ldb.DBpreset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions := s.presets[presetKey{workspace, name}]
+
+	if version == 0 {
+		version = len(versions)
+	}
+
+	if version < 1 || version > len(versions) {
+		return nil, sql.ErrNoRows
+	}
+
+	return versions[version-1], nil
+}
+
+func (s *memoryPresetStore) List(workspace string) ([]*ldb.DBpreset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	presets := []*ldb.DBpreset{}
+
+	for key, versions := range s.presets {
+		if key.workspace == workspace {
+			presets = append(presets, versions[len(versions)-1])
+		}
+	}
+
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+
+	return presets, nil
+}
+
+func (s *memoryPresetStore) Versions(workspace string, name string) ([]*ldb.DBpreset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*ldb.DBpreset{}, s.presets[presetKey{workspace, name}]...), nil
+}
+
+func (s *memoryPresetStore) Delete(workspace string, name string, audit *ldb.DBauditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := presetKey{workspace, name}
+
+	if _, ok := s.presets[key]; !ok {
+		return sql.ErrNoRows
+	}
+
+	delete(s.presets, key)
+
+	return nil
+}
+
+var memoryPresets = &memoryPresetStore{presets: map[presetKey][]*ldb.DBpreset{}}
+
+func getPresetStore() presetStore {
+	return selectStore[presetStore](dbPresetStore{}, memoryPresets)
+}
+
+// getPreset function    Returns the preset named in a query from the
+// workspace of the context, with the version in preset_version or else the
+// latest one, nil if there is no preset.
+func getPreset(ctx context.Context, query url.Values) (*ldb.DBpreset, error) {
+	name := query.Get("preset")
+
+	if name == "" {
+		return nil, nil
+	}
+
+	version := 0
+
+	if v := query.Get("preset_version"); v != "" {
+		n, err := strconv.Atoi(v)
+
+		if err != nil || n < 1 {
+			return nil, errors.New("Invalid preset_version, should be a positive integer.")
+		}
+
+		version = n
+	}
+
+	_, span := startDBSpan(ctx, "getPreset")
+	preset, err := getPresetStore().Get(getWorkspace(ctx), name, version)
+	span.End()
+
+	if errors.Is(err, sql.ErrNoRows) && version == 0 {
+		return nil, errors.New("No preset " + name + ".")
+	} else if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("No version " + strconv.Itoa(version) + " of preset " + name + ".")
+	}
+
+	return preset, err
+}
+
+// getConfigValues function    Returns the parameters of a config as url
+// values, the inverse of sc.GetSimulationConfigFromUrlValues.
+func getConfigValues(config *sg.SimulationConfig) url.Values {
+	return url.Values{
+		"rows":        {strconv.Itoa(config.Rows)},
+		"cols":        {strconv.Itoa(config.Cols)},
+		"foods":       {strconv.Itoa(config.Foods)},
+		"creature1":   {strconv.Itoa(int(config.Creature1))},
+		"creature2":   {strconv.Itoa(int(config.Creature2))},
+		"maxrounds":   {strconv.Itoa(config.MaxRounds)},
+		"gamelogsize": {strconv.Itoa(config.GamelogSize)},
+		"draw":        {strconv.FormatBool(config.Draw)},
+	}
+}
+
+// getPresetValues function    Returns the values of a query with the
+// parameters of its preset filled in, parameters in the query override the
+// ones of the preset. Endpoints making many configs from one query resolve
+// the preset once with it.
+func getPresetValues(ctx context.Context, query url.Values) (url.Values, error) {
+	preset, err := getPreset(ctx, query)
+
+	if err != nil || preset == nil {
+		return query, err
+	}
+
+	return mergePresetValues(preset, query), nil
+}
+
+func mergePresetValues(preset *ldb.DBpreset, query url.Values) url.Values {
+	values := getConfigValues(preset.Config)
+
+	for key, value := range query {
+		if key != "preset" && key != "preset_version" {
+			values[key] = value
+		}
+	}
+
+	return values
+}
+
+// getQueryConfig function    Returns the config of a query and its preset.
+func getQueryConfig(ctx context.Context, query url.Values) (config *sg.SimulationConfig, err error) {
+	ctx, span := tracer.Start(ctx, "validate config")
+	defer endSpan(span, &err)
+
+	values, err := getPresetValues(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sc.GetSimulationConfigFromUrlValues(values)
+}
+
+// getBodyConfig function    Returns the config of the parameters of a request
+// body, base has the parameters they override, e.g. the ones of a preset.
+func getBodyConfig(base url.Values, parameters map[string]json.Number) (*sg.SimulationConfig, error) {
+	values := url.Values{}
+
+	for key, value := range base {
+		values[key] = value
+	}
+
+	for key, value := range parameters {
+		values.Set(key, value.String())
+	}
+
+	return sc.GetSimulationConfigFromUrlValues(values)
+}
+
+// getQueryIntervals function    Returns the intervals random runs draw from,
+// nil for the standard ones without a preset. With a preset the parameters
+// drawn at random are fixed to the ones of its config, the parameters in the
+// query override them, and otherwise the intervals of the preset are used.
+// A preset or query changing a parameter that is not drawn at random, e.g.
+// maxrounds, can not be used for random runs.
+func getQueryIntervals(ctx context.Context, query url.Values) (map[string]sc.Interval, error) {
+	preset, err := getPreset(ctx, query)
+
+	if err != nil || preset == nil {
+		return nil, err
+	}
+
+	config, err := sc.GetSimulationConfigFromUrlValues(mergePresetValues(preset, query))
+
+	if err != nil {
+		return nil, err
+	}
+
+	standard, err := sc.GetSimulationConfigFromUrlValues(url.Values{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	values := getConfigValues(config)
+	standardValues := getConfigValues(standard)
+	intervals := map[string]sc.Interval{}
+
+	for _, name := range sc.ParameterNames {
+		if _, _, ok := sc.GetStandardInterval(name); !ok {
+			if values.Get(name) != standardValues.Get(name) {
+				return nil, errors.New("Parameter " + name + " is not drawn at random, the preset " + preset.Name + " can not be used for random runs with " + name + "=" + values.Get(name) + ".")
+			}
+
+			continue
+		}
+
+		if interval, ok := preset.Intervals[name]; ok && !query.Has(name) {
+			intervals[name] = interval
+			continue
+		}
+
+		value, _ := strconv.Atoi(values.Get(name))
+		intervals[name] = sc.Interval{Min: value, Max: value}
+	}
+
+	return intervals, nil
+}
+
+// getRandomConfig function    Returns a random config drawn from the given
+// intervals, the standard ones are used for parameters without one.
+func getRandomConfig(intervals map[string]sc.Interval) (*sg.SimulationConfig, error) {
+	intervalMap, err := sc.GetIntervalMap(intervals)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sc.GetRandomSimulationConfigFromInterval(intervalMap)
+}
+
+// getPresetFromRequest function    Decodes and validates a preset, the name of
+// a replaced preset comes from the path.
+func getPresetFromRequest(r *http.Request, name string) (*ldb.DBpreset, error) {
+	request := presetRequest{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&request); err != nil {
+		return nil, errors.New("Invalid request body: " + err.Error())
+	}
+
+	if name == "" {
+		name = request.Name
+	}
+
+	if !presetNamePattern.MatchString(name) {
+		return nil, errors.New("Invalid preset name, should be 1-64 lowercase letters, digits, - or _.")
+	}
+
+	values := url.Values{}
+
+	for key, value := range request.Config {
+		values.Set(key, value.String())
+	}
+
+	config, err := sc.GetSimulationConfigFromUrlValues(values)
+
+	if err != nil {
+		return nil, errors.New("Invalid config: " + err.Error())
+	}
+
+	if _, err := sc.GetIntervalMap(request.Intervals); err != nil {
+		return nil, errors.New("Invalid intervals: " + err.Error())
+	}
+
+	return &ldb.DBpreset{Workspace: getWorkspace(r.Context()), Name: name, Config: config, Intervals: request.Intervals}, nil
+}
+
+func (s *APIServer) getPresets(w http.ResponseWriter, r *http.Request) error {
+	presets, err := getPresetStore().List(getWorkspace(r.Context()))
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, presets)
+}
+
+func (s *APIServer) newPreset(w http.ResponseWriter, r *http.Request) error {
+	preset, err := getPresetFromRequest(r, "")
+
+	if err != nil {
+		return err
+	}
+
+	audit, err := getAuditEntry(r, AuditPresetCreate, "preset:"+preset.Name, nil, nil)
+
+	if err != nil {
+		return err
+	}
+
+	if err := getPresetStore().Save(preset, false, audit); err != nil {
+		return err
+	}
+
+	return WriteJSON(w, http.StatusCreated, preset)
+}
+
+// getNamedPreset function    Returns the latest version of the preset in the
+// path, or the one in the version parameter.
+func (s *APIServer) getNamedPreset(w http.ResponseWriter, r *http.Request) error {
+	query := url.Values{"preset": {mux.Vars(r)["name"]}, "preset_version": {r.URL.Query().Get("version")}}
+	preset, err := getPreset(r.Context(), query)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, preset)
+}
+
+// replacePreset function    Stores the body as the next version of the
+// preset in the path, the earlier versions are kept.
+func (s *APIServer) replacePreset(w http.ResponseWriter, r *http.Request) error {
+	name := mux.Vars(r)["name"]
+	preset, err := getPresetFromRequest(r, name)
+
+	if err != nil {
+		return err
+	}
+
+	store := getPresetStore()
+	before, err := store.Get(preset.Workspace, name, 0)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("No preset " + name + ", create it with a POST to /api/presets first.")
+	} else if err != nil {
+		return err
+	}
+
+	audit, err := getAuditEntry(r, AuditPresetUpdate, "preset:"+name, before, nil)
+
+	if err != nil {
+		return err
+	}
+
+	err = store.Save(preset, true, audit)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("No preset " + name + ", create it with a POST to /api/presets first.")
+	} else if err != nil {
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, preset)
+}
+
+func (s *APIServer) deletePreset(w http.ResponseWriter, r *http.Request) error {
+	name := mux.Vars(r)["name"]
+	workspace := getWorkspace(r.Context())
+	store := getPresetStore()
+	before, err := store.Get(workspace, name, 0)
+
+	if err == nil {
+		var audit *ldb.DBauditEntry
+
+		if audit, err = getAuditEntry(r, AuditPresetDelete, "preset:"+name, before, nil); err == nil {
+			err = store.Delete(workspace, name, audit)
+		}
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("No preset " + name + ".")
+	} else if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (s *APIServer) getPresetVersions(w http.ResponseWriter, r *http.Request) error {
+	name := mux.Vars(r)["name"]
+	versions, err := getPresetStore().Versions(getWorkspace(r.Context()), name)
+
+	if err != nil {
+		return err
+	}
+
+	if len(versions) == 0 {
+		return errors.New("No preset " + name + ".")
+	}
+
+	return WriteJSON(w, http.StatusOK, versions)
+}
@@ -0,0 +1,202 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastianring/simgameserver/api"
+	sc "github.com/sebastianring/simgameserver/simconfig"
+)
+
+type presetResponse struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+	Config  struct {
+		Rows  int
+		Foods int
+	} `json:"config"`
+}
+
+func presetRequest(t *testing.T, handler func(http.ResponseWriter, *http.Request) error, method string, url string, name string, body string) (*httptest.ResponseRecorder, error) {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+
+	if name != "" {
+		req = mux.SetURLVars(req, map[string]string{"name": name})
+	}
+
+	rr := httptest.NewRecorder()
+
+	return rr, handler(rr, req)
+}
+
+func TestAPIServer_Presets(t *testing.T) {
+	fmt.Println("Creating, versioning, using and deleting a preset")
+	t.Setenv("SIM_GAME_DB_PW", "")
+	sc.InitRules()
+	s := api.NewAPIServer(":8080")
+
+	body := `{"name": "small-scarce-food", "config": {"rows": 20, "cols": 30, "foods": 10}, "intervals": {"rows": {"min": 20, "max": 25}}}`
+	rr, err := presetRequest(t, s.HandlePresets, "POST", "/api/presets", "", body)
+
+	if err != nil || rr.Code != http.StatusCreated {
+		t.Fatal("Expected the preset to be created, got: ", rr.Code, err)
+	}
+
+	if _, err := presetRequest(t, s.HandlePresets, "POST", "/api/presets", "", body); err == nil {
+		t.Error("Expected an error creating a preset that exists")
+	}
+
+	rr, err = presetRequest(t, s.HandlePreset, "PUT", "/api/presets/small-scarce-food", "small-scarce-food", `{"config": {"rows": 20, "cols": 30, "foods": 5}}`)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	latest := presetResponse{}
+	json.NewDecoder(rr.Body).Decode(&latest)
+
+	if latest.Version != 2 || latest.Config.Foods != 5 {
+		t.Error("Expected version 2 with 5 foods, got: ", latest)
+	}
+
+	rr, err = presetRequest(t, s.HandlePreset, "GET", "/api/presets/small-scarce-food?version=1", "small-scarce-food", "")
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	first := presetResponse{}
+	json.NewDecoder(rr.Body).Decode(&first)
+
+	if first.Version != 1 || first.Config.Foods != 10 {
+		t.Error("Expected version 1 with 10 foods, got: ", first)
+	}
+
+	rr, err = presetRequest(t, s.HandlePresetVersions, "GET", "/api/presets/small-scarce-food/versions", "small-scarce-food", "")
+	versions := []presetResponse{}
+	json.NewDecoder(rr.Body).Decode(&versions)
+
+	if err != nil || len(versions) != 2 {
+		t.Error("Expected two versions, got: ", len(versions), err)
+	}
+
+	// The batch reports the configs it ran, the preset is the base of every
+	// item and the item's own parameters override it.
+	rr, err = presetRequest(t, s.HandleBatch, "POST", "/api/batch?preset=small-scarce-food", "", `[{"label": "preset"}, {"label": "override", "config": {"rows": 22}}]`)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	batch := struct {
+		Results map[string]presetResponse `json:"results"`
+	}{}
+	json.NewDecoder(rr.Body).Decode(&batch)
+
+	if batch.Results["preset"].Config.Rows != 20 || batch.Results["preset"].Config.Foods != 5 || batch.Results["override"].Config.Rows != 22 {
+		t.Error("Expected the preset with overrides, got: ", batch.Results)
+	}
+
+	rr, err = presetRequest(t, s.HandleSingleSimulation, "GET", "/api/new_single_sim?preset=small-scarce-food&foods=8", "", "")
+
+	if err != nil || rr.Code != http.StatusOK {
+		t.Error("Expected a simulation with the preset, got: ", rr.Code, err)
+	}
+
+	if _, err := presetRequest(t, s.HandleSingleSimulation, "GET", "/api/new_single_sim?preset=small-scarce-food&preset_version=3", "", ""); err == nil {
+		t.Error("Expected an error for a version that does not exist")
+	}
+
+	if _, err := presetRequest(t, s.HandlePreset, "DELETE", "/api/presets/small-scarce-food", "small-scarce-food", ""); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err := presetRequest(t, s.HandleSingleSimulation, "GET", "/api/new_single_sim?preset=small-scarce-food", "", ""); err == nil {
+		t.Error("Expected an error for a deleted preset")
+	}
+}
+
+func TestAPIServer_InvalidPresets(t *testing.T) {
+	t.Setenv("SIM_GAME_DB_PW", "")
+	sc.InitRules()
+	s := api.NewAPIServer(":8080")
+
+	bodies := []string{
+		`{"name": "Not A Name", "config": {}}`,
+		`{"name": "too-many-rows", "config": {"rows": 1000}}`,
+		`{"name": "bad-interval", "config": {}, "intervals": {"maxrounds": {"min": 1, "max": 5}}}`,
+	}
+
+	for _, body := range bodies {
+		if _, err := presetRequest(t, s.HandlePresets, "POST", "/api/presets", "", body); err == nil {
+			t.Error("Expected an error for preset: ", body)
+		}
+	}
+
+	if _, err := presetRequest(t, s.HandlePreset, "PUT", "/api/presets/missing", "missing", `{"config": {}}`); err == nil {
+		t.Error("Expected an error replacing a preset that does not exist")
+	}
+}
+
+func TestAPIServer_PresetRandomRuns(t *testing.T) {
+	t.Setenv("SIM_GAME_DB_PW", "")
+	sc.InitRules()
+	s := api.NewAPIServer(":8080")
+
+	bodies := []string{
+		`{"name": "random-no-intervals", "config": {"rows": 60, "cols": 70, "foods": 60, "creature1": 10, "creature2": 0}}`,
+		`{"name": "random-long-runs", "config": {"maxrounds": 80}}`,
+	}
+
+	for _, body := range bodies {
+		if rr, err := presetRequest(t, s.HandlePresets, "POST", "/api/presets", "", body); err != nil || rr.Code != http.StatusCreated {
+			t.Fatal("Expected the preset to be created, got: ", rr.Code, err)
+		}
+	}
+
+	// Without intervals the random runs of a preset are runs of its config, the
+	// parameters in the query override it. A creature type missing from the
+	// config never shows up in the rounds.
+	for query, missing := range map[string]string{
+		"":                          "2",
+		"&creature1=0&creature2=10": "1",
+	} {
+		rounds := []struct {
+			CreatureSummary map[string]any
+		}{}
+
+		// A run whose creatures all died in the first round has no rounds to
+		// check, another run is made then.
+		for attempt := 0; attempt < 5 && len(rounds) == 0; attempt++ {
+			rr, err := presetRequest(t, s.HandleSingleRandomSimulation, "GET", "/api/new_random_sim?preset=random-no-intervals"+query, "", "")
+
+			if err != nil {
+				t.Fatal("Expected a random run of the preset, got: ", err)
+			}
+
+			if err := json.NewDecoder(rr.Body).Decode(&rounds); err != nil {
+				t.Fatal("Expected rounds, got: ", err)
+			}
+		}
+
+		if len(rounds) == 0 {
+			t.Fatal("Expected rounds in one of the runs")
+		}
+
+		for _, round := range rounds {
+			if _, ok := round.CreatureSummary[missing]; ok {
+				t.Error("Expected the config of the preset with the query, got creature type ", missing, " for query: ", query)
+				break
+			}
+		}
+	}
+
+	if _, err := presetRequest(t, s.HandleSingleRandomSimulation, "GET", "/api/new_random_sim?preset=random-long-runs", "", ""); err == nil {
+		t.Error("Expected an error for a preset with maxrounds in random runs")
+	}
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultReplayFPS = 2.0
+	minReplayFPS     = 0.1
+	maxReplayFPS     = 60.0
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// replayMessage is sent from the server, Type is one of meta, frame or end.
+type replayMessage struct {
+	Type   string      `json:"type"`
+	RunID  string      `json:"run_id,omitempty"`
+	Frames int         `json:"frames,omitempty"`
+	FPS    float64     `json:"fps,omitempty"`
+	Index  int         `json:"index"`
+	Frame  *boardFrame `json:"frame,omitempty"`
+}
+
+// replayControl is sent from the client, Action is one of play, pause, seek
+// (to Frame) or speed (to FPS).
+type replayControl struct {
+	Action string  `json:"action"`
+	Frame  int     `json:"frame"`
+	FPS    float64 `json:"fps"`
+}
+
+func getReplayFPS(r *http.Request) (float64, error) {
+	value := r.URL.Query().Get("fps")
+
+	if value == "" {
+		return defaultReplayFPS, nil
+	}
+
+	fps, err := strconv.ParseFloat(value, 64)
+
+	if err != nil || fps < minReplayFPS || fps > maxReplayFPS {
+		return 0, errors.New("Invalid value for fps, should be between 0.1-60.")
+	}
+
+	return fps, nil
+}
+
+// replaySimulation runs a simulation with the config in the url values and
+// plays it back frame by frame over a websocket. The run is complete before
+// playback starts, so the client can pause, seek and change speed freely.
+func (s *APIServer) replaySimulation(w http.ResponseWriter, r *http.Request) error {
+	fps, err := getReplayFPS(r)
+
+	if err != nil {
+		return err
+	}
+
+	values := r.URL.Query()
+	values.Del("fps")
+	config, err := getQueryConfig(r.Context(), values)
+
+	if err != nil {
+		return err
+	}
+
+	run, frames, err := runSimulationFrames(r.Context(), config)
+
+	if err != nil {
+		return err
+	}
+
+	if err := storeRun(r.Context(), run); err != nil {
+		slog.ErrorContext(r.Context(), "Error storing run", "run_id", run.RunID, "error", err)
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+
+	if err != nil {
+		// The upgrader has already responded to the client.
+		slog.WarnContext(r.Context(), "Error upgrading to websocket", "error", err)
+		return nil
+	}
+
+	defer conn.Close()
+
+	// The reader stops when the handler returns, closing the connection ends
+	// a blocked read and done a blocked send.
+	ctx := r.Context()
+	done := make(chan struct{})
+	defer close(done)
+
+	controls := make(chan replayControl)
+
+	go func() {
+		defer close(controls)
+
+		for {
+			control := replayControl{}
+
+			if err := conn.ReadJSON(&control); err != nil {
+				return
+			}
+
+			select {
+			case controls <- control:
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	err = conn.WriteJSON(replayMessage{Type: "meta", RunID: run.RunID, Frames: len(frames), FPS: fps})
+
+	if err != nil {
+		return nil
+	}
+
+	index := 0
+	playing := true
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case control, ok := <-controls:
+			if !ok {
+				return nil
+			}
+
+			switch control.Action {
+			case "play":
+				if index >= len(frames) {
+					index = 0
+				}
+
+				playing = true
+			case "pause":
+				playing = false
+			case "seek":
+				if control.Frame >= 0 && control.Frame < len(frames) {
+					index = control.Frame
+
+					if !playing {
+						conn.WriteJSON(replayMessage{Type: "frame", Index: index, Frame: frames[index]})
+					}
+				}
+			case "speed":
+				if control.FPS >= minReplayFPS && control.FPS <= maxReplayFPS {
+					fps = control.FPS
+				}
+			}
+
+			if playing && index < len(frames) {
+				timer.Reset(0)
+			}
+
+		case <-timer.C:
+			if !playing || index >= len(frames) {
+				continue
+			}
+
+			if err := conn.WriteJSON(replayMessage{Type: "frame", Index: index, Frame: frames[index]}); err != nil {
+				return nil
+			}
+
+			index++
+
+			if index == len(frames) {
+				playing = false
+				conn.WriteJSON(replayMessage{Type: "end", Index: index - 1})
+				continue
+			}
+
+			timer.Reset(time.Duration(float64(time.Second) / fps))
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sebastianring/simgameserver/api"
+)
+
+func TestAPIServer_Replay(t *testing.T) {
+	s := api.NewAPIServer(":8080")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.HandleReplay(w, r); err != nil {
+			t.Error(err.Error())
+		}
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/ws/replay?fps=60"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+
+	if err != nil {
+		t.Fatal("Issue connecting to websocket: ", err.Error())
+	}
+
+	defer conn.Close()
+
+	meta := map[string]any{}
+
+	if err := conn.ReadJSON(&meta); err != nil || meta["type"] != "meta" {
+		t.Fatal("Expected a meta message first: ", meta, err)
+	}
+
+	frames := 0
+
+	for {
+		msg := map[string]any{}
+
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal("Issue reading from websocket: ", err.Error())
+		}
+
+		if msg["type"] == "end" {
+			break
+		}
+
+		frames++
+	}
+
+	if float64(frames) != meta["frames"] {
+		t.Error("Expected all frames before end, got: ", frames, meta["frames"])
+	}
+}
+
+func TestAPIServer_ReplayStopsWithTheClient(t *testing.T) {
+	s := api.NewAPIServer(":8080")
+	returned := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(returned)
+		s.HandleReplay(w, r)
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/ws/replay?fps=0.1"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+
+	if err != nil {
+		t.Fatal("Issue connecting to websocket: ", err.Error())
+	}
+
+	for i := 0; i < 10; i++ {
+		conn.WriteJSON(map[string]any{"action": "speed", "fps": 1})
+	}
+
+	conn.Close()
+
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the replay to stop when the client is gone")
+	}
+}
@@ -0,0 +1,282 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sebastianring/simgameserver/optimize"
+	sg "github.com/sebastianring/simulationgame"
+)
+
+const maxSearchRuns = 2000
+
+// searchRequest is the body of POST /api/search. Every evaluation of a config
+// is the mean of the metric over repetitions runs.
+type searchRequest struct {
+	Optimizer      string                 `json:"optimizer"`
+	Metric         string                 `json:"metric"`
+	CreatureType   string                 `json:"creature_type"`
+	Goal           string                 `json:"goal"`
+	Parameters     []string               `json:"parameters"`
+	Ranges         map[string]string      `json:"ranges"`
+	Fixed          map[string]json.Number `json:"fixed"`
+	Repetitions    int                    `json:"repetitions"`
+	MaxEvaluations int                    `json:"max_evaluations"`
+	MaxSeconds     float64                `json:"max_seconds"`
+	Seed           *int64                 `json:"seed"`
+}
+
+type searchEntry struct {
+	Evaluation     int                  `json:"evaluation"`
+	Value          float64              `json:"value"`
+	Config         *sg.SimulationConfig `json:"config"`
+	ElapsedSeconds float64              `json:"elapsed_seconds"`
+}
+
+// searchResult holds the best config found and the history of every config
+// that was the best so far.
+type searchResult struct {
+	Optimizer      string             `json:"optimizer"`
+	Metric         string             `json:"metric"`
+	CreatureType   string             `json:"creature_type"`
+	Goal           string             `json:"goal"`
+	Seed           int64              `json:"seed"`
+	Parameters     []*parameterBounds `json:"parameters"`
+	Evaluations    int                `json:"evaluations"`
+	Failed         int                `json:"failed"`
+	ElapsedSeconds float64            `json:"elapsed_seconds"`
+	StopReason     string             `json:"stop_reason"`
+	Best           *searchEntry       `json:"best"`
+	History        []searchEntry      `json:"history"`
+}
+
+func getSearchRequest(r *http.Request) (*searchRequest, error) {
+	request := searchRequest{
+		Optimizer:      "cmaes",
+		Metric:         "final_population",
+		CreatureType:   "creature1",
+		Goal:           "maximize",
+		Parameters:     defaultSearchParameters,
+		Repetitions:    1,
+		MaxEvaluations: 100,
+		MaxSeconds:     60,
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&request); err != nil {
+		return nil, errors.New("Invalid request body: " + err.Error())
+	}
+
+	if _, ok := optimize.Optimizers[request.Optimizer]; !ok {
+		names := []string{}
+
+		for name := range optimize.Optimizers {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		return nil, errors.New("Unknown optimizer: " + request.Optimizer + ", should be one of " + strings.Join(names, ", ") + ".")
+	}
+
+	if request.Goal != "maximize" && request.Goal != "minimize" {
+		return nil, errors.New("Unknown goal: " + request.Goal + ", should be maximize or minimize.")
+	}
+
+	if len(request.Parameters) == 0 {
+		return nil, errors.New("At least one parameter has to be searched.")
+	}
+
+	if request.Repetitions < 1 || request.Repetitions > 10 {
+		return nil, errors.New("Invalid repetitions, interval should be between 1-10.")
+	}
+
+	if request.MaxEvaluations < 1 || request.MaxEvaluations*request.Repetitions > maxSearchRuns {
+		return nil, errors.New("Invalid max_evaluations, should be at least 1 and at most " + strconv.Itoa(maxSearchRuns) + " runs including repetitions.")
+	}
+
+	if request.MaxSeconds < 1 || request.MaxSeconds > 300 {
+		return nil, errors.New("Invalid max_seconds, interval should be between 1-300.")
+	}
+
+	for _, name := range request.Parameters {
+		if _, ok := request.Fixed[name]; ok {
+			return nil, errors.New("Parameter " + name + " can not be both searched and fixed.")
+		}
+	}
+
+	return &request, nil
+}
+
+// search function    Runs the optimizer until the evaluation or time budget is
+// spent, a batch that was started is always finished so the time budget can
+// be exceeded by the time of one batch. The seed makes the optimizer propose
+// the same configs, and run k of a seeded search is seeded with the seed plus
+// k, so that a seeded search stopping at max_evaluations is reproducible.
+// Fixed parameters override the ones of the query's preset.
+func search(ctx context.Context, request *searchRequest, query url.Values) (*searchResult, error) {
+	metric, creatureType, err := getRunMetric(request.Metric, request.CreatureType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	space, err := getParameterSpace(request.Parameters, request.Ranges)
+
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := getPresetValues(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range request.Fixed {
+		base.Set(key, value.String())
+	}
+
+	result := searchResult{
+		Optimizer:    request.Optimizer,
+		Metric:       request.Metric,
+		CreatureType: request.CreatureType,
+		Goal:         request.Goal,
+		Seed:         time.Now().UnixNano(),
+		Parameters:   space,
+		History:      []searchEntry{},
+	}
+
+	if request.Seed != nil {
+		result.Seed = *request.Seed
+	}
+
+	// The optimizers minimize, a maximized metric is negated.
+	sign := 1.0
+
+	if request.Goal == "maximize" {
+		sign = -1
+	}
+
+	rng := rand.New(rand.NewSource(result.Seed))
+	optimizer := optimize.Optimizers[request.Optimizer](len(space), runtime.NumCPU(), rng)
+	start := time.Now()
+	budget := time.Duration(request.MaxSeconds * float64(time.Second))
+	result.StopReason = "max_evaluations"
+
+	for result.Evaluations < request.MaxEvaluations {
+		if time.Since(start) >= budget {
+			result.StopReason = "max_seconds"
+			break
+		}
+
+		points := optimizer.Ask()
+		complete := len(points) <= request.MaxEvaluations-result.Evaluations
+
+		if !complete {
+			points = points[:request.MaxEvaluations-result.Evaluations]
+		}
+
+		configs := make([]*sg.SimulationConfig, len(points)*request.Repetitions)
+
+		for i, point := range points {
+			config, err := getPointConfig(base, space, point)
+
+			if err != nil {
+				slog.WarnContext(ctx, "Skipping config", "error", err)
+				continue
+			}
+
+			for rep := 0; rep < request.Repetitions; rep++ {
+				configs[i*request.Repetitions+rep] = config
+			}
+		}
+
+		var seed *int64
+
+		if request.Seed != nil {
+			s := result.Seed + int64(result.Evaluations*request.Repetitions)
+			seed = &s
+		}
+
+		runs := runConfigs(ctx, configs, seed)
+		values := make([]float64, len(points))
+
+		for i := range points {
+			r := 0.0
+			n := 0
+
+			for _, run := range runs[i*request.Repetitions : (i+1)*request.Repetitions] {
+				if run != nil {
+					r += metric(run, creatureType)
+					n++
+				}
+			}
+
+			result.Evaluations++
+
+			// Configs that can not be simulated are the worst possible.
+			if n == 0 {
+				result.Failed++
+				values[i] = math.Inf(1)
+				continue
+			}
+
+			value := r / float64(n)
+			values[i] = sign * value
+
+			if result.Best == nil || sign*value < sign*result.Best.Value {
+				entry := searchEntry{
+					Evaluation:     result.Evaluations,
+					Value:          value,
+					Config:         configs[i*request.Repetitions],
+					ElapsedSeconds: time.Since(start).Seconds(),
+				}
+
+				result.Best = &entry
+				result.History = append(result.History, entry)
+			}
+		}
+
+		if complete {
+			optimizer.Tell(points, values)
+		}
+	}
+
+	result.ElapsedSeconds = time.Since(start).Seconds()
+
+	if result.Best == nil {
+		return nil, errors.New("No config could be simulated, check the ranges and fixed parameters.")
+	}
+
+	return &result, nil
+}
+
+func (s *APIServer) newSearch(w http.ResponseWriter, r *http.Request) error {
+	request, err := getSearchRequest(r)
+
+	if err != nil {
+		return err
+	}
+
+	result, err := search(r.Context(), request, r.URL.Query())
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, result)
+}
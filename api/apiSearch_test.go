@@ -0,0 +1,102 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sebastianring/simgameserver/api"
+)
+
+func TestAPIServer_Search(t *testing.T) {
+	for _, optimizer := range []string{"random", "genetic", "cmaes"} {
+		fmt.Println("Searching with optimizer", optimizer)
+
+		body := `{"optimizer": "` + optimizer + `", "metric": "area_under_curve", "parameters": ["creature1", "foods"], "ranges": {"foods": "20-60"}, "max_evaluations": 12, "seed": 1}`
+		req := httptest.NewRequest("POST", "/api/search", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+
+		s := api.NewAPIServer(":8080")
+		err := s.HandleSearch(rr, req)
+
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		result := struct {
+			Evaluations int `json:"evaluations"`
+			Best        struct {
+				Value float64 `json:"value"`
+			} `json:"best"`
+			History []struct {
+				Value float64 `json:"value"`
+			} `json:"history"`
+		}{}
+
+		if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+			t.Fatal("Issue decoding response: ", err.Error())
+		}
+
+		if result.Evaluations != 12 || len(result.History) == 0 {
+			t.Fatal("Unexpected result: ", result)
+		}
+
+		for i := 1; i < len(result.History); i++ {
+			if result.History[i].Value <= result.History[i-1].Value {
+				t.Error("History is not improving: ", result.History)
+			}
+		}
+
+		if result.History[len(result.History)-1].Value != result.Best.Value {
+			t.Error("Best is not the last of the history")
+		}
+	}
+}
+
+func TestAPIServer_SearchSearchedAndFixed(t *testing.T) {
+	body := `{"parameters": ["foods"], "fixed": {"foods": 50}}`
+	req := httptest.NewRequest("POST", "/api/search", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+
+	if err := s.HandleSearch(rr, req); err == nil {
+		t.Error("Expected an error for a parameter both searched and fixed")
+	}
+}
+
+func TestAPIServer_SearchSeeded(t *testing.T) {
+	fmt.Println("Searching twice with the same seed in two workspaces")
+	router := getLimitRouter(t, "", "0")
+	history := []string{}
+
+	// The workspaces keep the seeded runs of the second search out of the
+	// cache of the first.
+	for _, workspace := range []string{"search-a", "search-b"} {
+		body := `{"optimizer": "random", "parameters": ["creature1", "foods"], "max_evaluations": 6, "repetitions": 2, "seed": 5}`
+		req := httptest.NewRequest("POST", "/api/search?workspace="+workspace, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		result := struct {
+			History []struct {
+				Evaluation int             `json:"evaluation"`
+				Value      float64         `json:"value"`
+				Config     json.RawMessage `json:"config"`
+			} `json:"history"`
+		}{}
+
+		if err := json.NewDecoder(rr.Body).Decode(&result); err != nil || len(result.History) == 0 {
+			t.Fatal("Expected a search result, got: ", rr.Code, err)
+		}
+
+		encoded, _ := json.Marshal(result.History)
+		history = append(history, string(encoded))
+	}
+
+	if history[0] != history[1] {
+		t.Error("Expected the same history for the same seed, got: ", history)
+	}
+}
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sebastianring/simgameserver/chart"
+	"github.com/sebastianring/simgameserver/stats"
+	sg "github.com/sebastianring/simulationgame"
+)
+
+const maxSensitivityRuns = 1000
+
+type sensitivityParameter struct {
+	*parameterBounds
+	FirstOrder float64 `json:"first_order"`
+	Total      float64 `json:"total"`
+}
+
+type sensitivityResult struct {
+	Metric        string                  `json:"metric"`
+	CreatureType  string                  `json:"creature_type"`
+	Samples       int                     `json:"samples"`
+	Runs          int                     `json:"runs"`
+	FailedSamples int                     `json:"failed_samples"`
+	Seed          int64                   `json:"seed"`
+	Mean          float64                 `json:"mean"`
+	Variance      float64                 `json:"variance"`
+	Parameters    []*sensitivityParameter `json:"parameters"`
+}
+
+// getSensitivity function    Samples the parameters with a Saltelli design of
+// Latin hypercubes inside their bounds and returns the Sobol indices of the
+// metric. Parameters that are not sampled keep the value of the query, or
+// their standard value. The seed makes the sampling and the runs, run i with
+// the seed plus i, reproducible.
+func getSensitivity(ctx context.Context, query url.Values) (*sensitivityResult, error) {
+	query, err := getPresetValues(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := sensitivityResult{
+		Metric:       query.Get("metric"),
+		CreatureType: query.Get("creature_type"),
+		Seed:         time.Now().UnixNano(),
+	}
+
+	if result.Metric == "" {
+		result.Metric = "final_population"
+	}
+
+	if result.CreatureType == "" {
+		result.CreatureType = "creature1"
+	}
+
+	metric, creatureType, err := getRunMetric(result.Metric, result.CreatureType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	names := defaultSearchParameters
+
+	if parameters := query.Get("parameters"); parameters != "" {
+		names = strings.Split(parameters, ",")
+	}
+
+	ranges, err := getRanges(query.Get("ranges"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	space, err := getParameterSpace(names, ranges)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range space {
+		result.Parameters = append(result.Parameters, &sensitivityParameter{parameterBounds: p})
+	}
+
+	result.Samples = 20
+
+	if samples := query.Get("samples"); samples != "" {
+		n, err := strconv.Atoi(samples)
+
+		if err != nil || n < 2 || n > 100 {
+			return nil, errors.New("Invalid samples, interval should be between 2-100.")
+		}
+
+		result.Samples = n
+	}
+
+	result.Runs = result.Samples * (len(names) + 2)
+
+	if result.Runs > maxSensitivityRuns {
+		return nil, errors.New("Too many runs, samples times the number of parameters plus 2 should be at most " + strconv.Itoa(maxSensitivityRuns) + ".")
+	}
+
+	var seed *int64
+
+	if value := query.Get("seed"); value != "" {
+		s, err := strconv.ParseInt(value, 10, 64)
+
+		if err != nil {
+			return nil, errors.New("Invalid seed, should be an integer.")
+		}
+
+		result.Seed = s
+		seed = &s
+	}
+
+	a, b, ab := stats.SaltelliDesign(result.Samples, len(names), rand.New(rand.NewSource(result.Seed)))
+
+	// All points are laid out in one slice to run them on the same workers:
+	// A, then B, then every AB_i.
+	points := append(append([][]float64{}, a...), b...)
+
+	for _, m := range ab {
+		points = append(points, m...)
+	}
+
+	configs := make([]*sg.SimulationConfig, len(points))
+
+	for i, point := range points {
+		// A point that does not make a valid config, e.g. too many creatures
+		// for a small board, fails like a run that failed.
+		config, err := getPointConfig(query, space, point)
+
+		if err != nil {
+			slog.WarnContext(ctx, "Skipping sample", "error", err)
+			continue
+		}
+
+		configs[i] = config
+	}
+
+	runs := runConfigs(ctx, configs, seed)
+	n := result.Samples
+	fa, fb := []float64{}, []float64{}
+	fab := make([][]float64, len(names))
+
+	// A sample is left out of every matrix if any of its runs failed.
+	for j := 0; j < n; j++ {
+		ok := runs[j] != nil && runs[n+j] != nil
+
+		for i := range names {
+			ok = ok && runs[(2+i)*n+j] != nil
+		}
+
+		if !ok {
+			result.FailedSamples++
+			continue
+		}
+
+		fa = append(fa, metric(runs[j], creatureType))
+		fb = append(fb, metric(runs[n+j], creatureType))
+
+		for i := range names {
+			fab[i] = append(fab[i], metric(runs[(2+i)*n+j], creatureType))
+		}
+	}
+
+	first, total, err := stats.SobolIndices(fa, fb, fab)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, p := range result.Parameters {
+		p.FirstOrder = first[i]
+		p.Total = total[i]
+	}
+
+	r := stats.Running{}
+
+	for j := range fa {
+		r.Add(fa[j])
+		r.Add(fb[j])
+	}
+
+	result.Mean = r.Mean()
+	result.Variance = r.Variance()
+
+	return &result, nil
+}
+
+func getSensitivityChart(result *sensitivityResult, options *chartOptions) *chart.BarChart {
+	c := chart.BarChart{
+		Title:  "Sobol indices of " + result.Metric + " of " + result.CreatureType + ", " + strconv.Itoa(result.Samples) + " samples",
+		YLabel: "Share of variance",
+		Width:  options.width,
+		Height: options.height,
+		Theme:  options.theme,
+		Series: []chart.Series{{Name: "first order"}, {Name: "total"}},
+	}
+
+	for _, p := range result.Parameters {
+		c.Categories = append(c.Categories, p.Name)
+		c.Series[0].Values = append(c.Series[0].Values, p.FirstOrder)
+		c.Series[1].Values = append(c.Series[1].Values, p.Total)
+	}
+
+	return &c
+}
+
+// getSensitivityAnalysis function    Returns the sensitivity report as json, or
+// as a bar chart if the format is svg or png.
+func (s *APIServer) getSensitivityAnalysis(w http.ResponseWriter, r *http.Request) error {
+	var options *chartOptions
+
+	if format := r.URL.Query().Get("format"); format != "" && format != "json" {
+		var err error
+		options, err = getChartOptions(r)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := getSensitivity(r.Context(), r.URL.Query())
+
+	if err != nil {
+		return err
+	}
+
+	if options == nil {
+		return WriteJSON(w, http.StatusOK, result)
+	}
+
+	c := getSensitivityChart(result, options)
+
+	if options.format == "png" {
+		w.Header().Set("Content-Type", "image/png")
+		return c.WritePNG(w)
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	return c.WriteSVG(w)
+}
@@ -0,0 +1,93 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sebastianring/simgameserver/api"
+)
+
+func TestAPIServer_Sensitivity(t *testing.T) {
+	fmt.Println("Running a sensitivity analysis of creature1 and foods")
+
+	req := httptest.NewRequest("GET", "/api/sensitivity?parameters=creature1,foods&samples=8&seed=3&ranges=creature1:0-30,foods:20-60&metric=area_under_curve", nil)
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+	err := s.HandleSensitivity(rr, req)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	result := struct {
+		Runs       int `json:"runs"`
+		Parameters []struct {
+			Name string `json:"name"`
+			Min  int    `json:"min"`
+			Max  int    `json:"max"`
+		} `json:"parameters"`
+	}{}
+
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatal("Issue decoding response: ", err.Error())
+	}
+
+	if result.Runs != 8*4 || len(result.Parameters) != 2 || result.Parameters[0].Min != 0 || result.Parameters[1].Max != 60 {
+		t.Error("Unexpected result: ", result)
+	}
+}
+
+func TestAPIServer_SensitivityChart(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/sensitivity?parameters=creature1,creature2&samples=4&metric=area_under_curve&format=svg", nil)
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+
+	if err := s.HandleSensitivity(rr, req); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if !strings.HasPrefix(rr.Body.String(), "<svg") {
+		t.Error("Expected an svg chart")
+	}
+}
+
+func TestAPIServer_SensitivityInvalidParameters(t *testing.T) {
+	s := api.NewAPIServer(":8080")
+
+	for _, query := range []string{"parameters=draw", "parameters=rows&ranges=rows:1-300", "parameters=rows,rows"} {
+		req := httptest.NewRequest("GET", "/api/sensitivity?"+query, nil)
+		rr := httptest.NewRecorder()
+
+		if err := s.HandleSensitivity(rr, req); err == nil {
+			t.Error("Expected an error for ", query)
+		}
+	}
+}
+
+func TestAPIServer_SensitivitySeeded(t *testing.T) {
+	fmt.Println("Running a sensitivity analysis twice with the same seed in two workspaces")
+	router := getLimitRouter(t, "", "0")
+	results := []string{}
+
+	// The workspaces keep the seeded runs of the second analysis out of the
+	// cache of the first.
+	for _, workspace := range []string{"sensitivity-a", "sensitivity-b"} {
+		rr := serveFrom(router, "/api/sensitivity?parameters=creature1,foods&samples=4&seed=9&metric=area_under_curve&workspace="+workspace, "192.0.2.1:1234")
+
+		if rr.Code != http.StatusOK {
+			t.Fatal("Expected an analysis, got: ", rr.Code, rr.Body.String())
+		}
+
+		results = append(results, rr.Body.String())
+	}
+
+	if results[0] != results[1] {
+		t.Error("Expected the same analysis for the same seed, got: ", results)
+	}
+}
@@ -1,94 +1,104 @@
 package api
 
 import (
+	"database/sql"
 	"errors"
 	"github.com/gorilla/mux"
 	ldb "github.com/sebastianring/simgameserver/db"
-	sc "github.com/sebastianring/simgameserver/simconfig"
-	sg "github.com/sebastianring/simulationgame"
-	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
-	"strconv"
 )
 
 func (s *APIServer) newSingleSimulation(w http.ResponseWriter, r *http.Request) error {
-	sc, err := sc.GetSimulationConfigFromUrlValues(r.URL.Query())
+	sc, err := getQueryConfig(r.Context(), r.URL.Query())
 
 	if err != nil {
-		log.Println("Error occured during getting simulation config from URL values: ", err)
 		return err
 	}
 
-	log.Println("Starting simulation with config: ")
-	log.Println("sc.creature1: " + strconv.Itoa(int(sc.Creature1)))
+	seed, seeded, err := getSeed(r.URL.Query())
 
-	resultBoard, err := sg.RunSimulation(sc)
+	if err != nil {
+		return err
+	}
+
+	format, err := negotiateFormat(r)
+
+	if err != nil {
+		return err
+	}
+
+	// A seeded run always gives the same result, so it can be cached by the
+	// client as well as here.
+	if seeded && checkNotModified(w, r, getETag(r.Context(), sc, seed, string(format))) {
+		return nil
+	}
+
+	rw, err := newFormatWriter(w, format, true)
 
 	if err != nil {
-		log.Println("Error occured during running the simulation: ", err)
 		return err
 	}
 
-	roundData, err := getRoundData(resultBoard, AliveAtEnd)
+	var run *simulationRun
+
+	if seeded {
+		run, err = getCachedRun(r.Context(), sc, seed)
+	} else {
+		run, err = runSimulation(r.Context(), sc)
+	}
 
 	if err != nil {
 		return err
 	}
 
-	return WriteJSON(w, http.StatusOK, roundData)
+	if err := rw.WriteRun(run); err != nil {
+		return err
+	}
+
+	return rw.Close()
 }
 
 func (s *APIServer) newRandomSimulation(w http.ResponseWriter, r *http.Request) error {
-	sc, err := sc.GetRandomSimulationConfigFromUrl(r)
+	intervals, err := getQueryIntervals(r.Context(), r.URL.Query())
 
 	if err != nil {
+		return err
 	}
 
-	log.Println("Starting simulation with config: ", sc)
-	resultBoard, err := sg.RunSimulation(sc)
+	sc, err := getRandomConfig(intervals)
 
 	if err != nil {
+		return err
 	}
 
-	roundData, err := getRoundData(resultBoard, AliveAtEnd)
+	rw, err := newResultWriter(w, r, true)
 
 	if err != nil {
+		return err
 	}
 
-	return WriteJSON(w, http.StatusOK, roundData)
-}
-
-func (s *APIServer) getSimulationForm(w http.ResponseWriter, r *http.Request) error {
-	t, err := template.ParseFiles("html/new_sim_form.html")
+	run, err := runSimulation(r.Context(), sc)
 
 	if err != nil {
-		return errors.New(err.Error())
+		return err
 	}
 
-	p := struct {
-		Title string
-		Text  string
-	}{
-		Title: "Simulation configuration",
-		Text:  "Please add your simulation configuration below",
+	if err := rw.WriteRun(run); err != nil {
+		return err
 	}
 
-	t.Execute(w, p)
-
-	return nil
+	return rw.Close()
 }
 
 func (s *APIServer) getBoardFromDb(w http.ResponseWriter, r *http.Request) error {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	log.Println("Trying to get a board from db")
-
 	if id == "" {
 		return errors.New("No id given, please check parameter id, currently given id: " + id)
 	} else {
-		log.Println("Looking for this board in the db: " + id)
+		slog.DebugContext(r.Context(), "Looking for board in the db", "id", id)
 	}
 
 	db, err := ldb.OpenDbConnection()
@@ -97,15 +107,17 @@ func (s *APIServer) getBoardFromDb(w http.ResponseWriter, r *http.Request) error
 		return errors.New("Error connecting to DB: " + err.Error())
 	}
 
-	defer db.Close()
-
-	query := "SELECT * FROM simulation_game.boards WHERE id = $1"
-	rows, err := db.Query(query, id)
+	// Boards are written by the simulation game, their workspace is the one
+	// of the run stored with the same id.
+	query := "SELECT b.id, b.rows, b.cols FROM simulation_game.boards b JOIN simulation_game.runs r ON r.id = b.id WHERE b.id = $1 AND r.workspace = $2"
+	rows, err := db.Query(query, id, getWorkspace(r.Context()))
 
 	if err != nil {
 		return err
 	}
 
+	defer rows.Close()
+
 	var results []ldb.DBboard
 
 	for rows.Next() {
@@ -134,7 +146,7 @@ func (s *APIServer) delBoardFromDb(w http.ResponseWriter, r *http.Request) error
 	if id == "" {
 		return errors.New("No id given, please check parameter id, currently given id: " + id)
 	} else {
-		log.Println("Looking for this board in the db: " + id)
+		slog.DebugContext(r.Context(), "Looking for board in the db", "id", id)
 	}
 
 	db, err := ldb.OpenDbConnection()
@@ -143,11 +155,20 @@ func (s *APIServer) delBoardFromDb(w http.ResponseWriter, r *http.Request) error
 		return errors.New("Error connecting to DB: " + err.Error())
 	}
 
-	defer db.Close()
+	audit, err := getAuditEntry(r, AuditRunDelete, "run:"+id, nil, nil)
 
-	query := "DELETE FROM simulation_game.boards WHERE id = $1"
+	if err != nil {
+		return err
+	}
 
-	_, err = db.Query(query, id)
+	_, err = ldb.DeleteRun(db, getWorkspace(r.Context()), id, audit)
 
-	return err
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("No stored run with id: " + id)
+	} else if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
 }
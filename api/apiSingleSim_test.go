@@ -11,7 +11,6 @@ import (
 )
 
 func TestAPIServer_GetHandleSingleSimulation(t *testing.T) {
-	t.Setenv("sim_game", "valmet865")
 	fmt.Println("Testing a GET method to api url /api/new_sim which generates a new simulation and returns a Json file with the results per round.")
 
 	req := httptest.NewRequest("GET", "/api/new_single_sim", nil)
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/sebastianring/simgameserver/stats"
+)
+
+type iterationEvent struct {
+	Iteration int                `json:"iteration"`
+	RunID     string             `json:"run_id"`
+	Rounds    []*simpleRoundData `json:"rounds"`
+}
+
+type progressEvent struct {
+	Done       int     `json:"done"`
+	Failed     int     `json:"failed"`
+	Total      int     `json:"total"`
+	ETASeconds float64 `json:"eta_seconds"`
+}
+
+// aggregateEvent holds the running aggregates over all completed iterations,
+// it is also used for the final summary event.
+type aggregateEvent struct {
+	Runs            int                      `json:"runs"`
+	Rounds          stats.Summary            `json:"rounds"`
+	FinalPopulation map[string]stats.Summary `json:"final_population"`
+}
+
+type runAggregate struct {
+	rounds          stats.Running
+	finalPopulation map[string]*stats.Running
+}
+
+func newRunAggregate() *runAggregate {
+	ra := runAggregate{finalPopulation: map[string]*stats.Running{}}
+
+	for _, t := range creatureTypes {
+		ra.finalPopulation[creatureTypeNames[t]] = &stats.Running{}
+	}
+
+	return &ra
+}
+
+func (ra *runAggregate) add(run *simulationRun) {
+	ra.rounds.Add(float64(run.roundsPlayed()))
+
+	for _, t := range creatureTypes {
+		ra.finalPopulation[creatureTypeNames[t]].Add(float64(run.finalPopulation(t)))
+	}
+}
+
+func (ra *runAggregate) event() aggregateEvent {
+	ae := aggregateEvent{
+		Runs:            ra.rounds.N(),
+		Rounds:          ra.rounds.Summary(),
+		FinalPopulation: map[string]stats.Summary{},
+	}
+
+	for name, r := range ra.finalPopulation {
+		ae.FinalPopulation[name] = r.Summary()
+	}
+
+	return ae
+}
+
+// writeEvent function    Writes a server-sent event with v as json data and
+// flushes it to the client.
+func writeEvent(w http.ResponseWriter, event string, v any) error {
+	data, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+
+	if err != nil {
+		return err
+	}
+
+	flush(w)
+
+	return nil
+}
+
+// streamMultipleRandomSimulations sends every iteration as soon as it is done,
+// followed by progress and aggregate events, and a summary event at the end.
+func (s *APIServer) streamMultipleRandomSimulations(w http.ResponseWriter, r *http.Request) error {
+	if _, ok := w.(http.Flusher); !ok {
+		return errors.New("Streaming is not supported by this connection.")
+	}
+
+	iterations, err := getIterations(r)
+
+	if err != nil {
+		return err
+	}
+
+	intervals, err := getQueryIntervals(r.Context(), r.URL.Query())
+
+	if err != nil {
+		return err
+	}
+
+	type iterationResult struct {
+		run *simulationRun
+		err error
+	}
+
+	results := make(chan iterationResult, iterations)
+
+	submitIterations(r.Context(), iterations, func() {
+		// Iterations waiting for a worker when the client leaves are skipped.
+		if err := r.Context().Err(); err != nil {
+			results <- iterationResult{err: err}
+			return
+		}
+
+		run, err := s.runRandomSimulation(r.Context(), intervals)
+		results <- iterationResult{run: run, err: err}
+	})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	started := time.Now()
+	aggregate := newRunAggregate()
+	progress := progressEvent{Total: int(iterations)}
+
+	for i := 0; i < int(iterations); i++ {
+		var result iterationResult
+
+		select {
+		case <-r.Context().Done():
+			slog.InfoContext(r.Context(), "Client closed the stream before all iterations were done", "done", i, "iterations", iterations)
+			return nil
+		case result = <-results:
+		}
+
+		if result.err != nil {
+			progress.Failed++
+
+			if err := writeEvent(w, "error", ApiError{Error: result.err.Error()}); err != nil {
+				return nil
+			}
+		} else {
+			progress.Done++
+			aggregate.add(result.run)
+
+			ie := iterationEvent{
+				Iteration: progress.Done,
+				RunID:     result.run.RunID,
+				Rounds:    result.run.Rounds,
+			}
+
+			if err := writeEvent(w, "iteration", ie); err != nil {
+				return nil
+			}
+
+			if err := writeEvent(w, "aggregate", aggregate.event()); err != nil {
+				return nil
+			}
+		}
+
+		finished := progress.Done + progress.Failed
+		perIteration := time.Since(started).Seconds() / float64(finished)
+		progress.ETASeconds = perIteration * float64(progress.Total-finished)
+
+		if err := writeEvent(w, "progress", progress); err != nil {
+			return nil
+		}
+	}
+
+	writeEvent(w, "summary", aggregate.event())
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package api_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastianring/simgameserver/api"
+)
+
+func TestAPIServer_StreamMultipleSimulations(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/stream/multiple_sim/3", nil)
+	req = mux.SetURLVars(req, map[string]string{"iterations": "3"})
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+	err := s.HandleMultipleRandomSimulationsStream(rr, req)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if ct := rr.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Error("Wrong content type: ", ct)
+	}
+
+	body := rr.Body.String()
+
+	if n := strings.Count(body, "event: progress\n"); n != 3 {
+		t.Error("Expected one progress event per iteration, got: ", n)
+	}
+
+	if !strings.HasSuffix(strings.TrimSpace(body), "}") || !strings.Contains(body, "event: summary\n") {
+		t.Error("Stream did not end with a summary event")
+	}
+}
+
+// getGauge function    Returns the value of a gauge without labels from the
+// metrics of the router.
+func getGauge(t *testing.T, router *mux.Router, name string) float64 {
+	rr := serveFrom(router, "/metrics", "192.0.2.1:1234")
+
+	for _, line := range strings.Split(rr.Body.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, name+" "); ok {
+			f, err := strconv.ParseFloat(value, 64)
+
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			return f
+		}
+	}
+
+	t.Fatal("No gauge ", name)
+
+	return 0
+}
+
+func TestAPIServer_StreamUsesThePool(t *testing.T) {
+	router := getLimitRouter(t, "", "0")
+	workers := getGauge(t, router, "simgame_worker_pool_workers")
+
+	// Enough iterations to keep the workers busy while the gauge is read, a
+	// run of creatures dying in the first round takes no time.
+	iterations := strconv.Itoa(int(workers) * 50)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/api/stream/multiple_sim/"+iterations, nil).WithContext(ctx)
+	req = mux.SetURLVars(req, map[string]string{"iterations": iterations})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		api.NewAPIServer(":8080").HandleMultipleRandomSimulationsStream(httptest.NewRecorder(), req)
+	}()
+
+	busy := 0.0
+
+	for streaming := true; busy == 0 && streaming; {
+		select {
+		case <-done:
+			streaming = false
+		default:
+		}
+
+		busy = getGauge(t, router, "simgame_worker_pool_busy_workers")
+	}
+
+	cancel()
+	<-done
+
+	if busy == 0 || busy > workers {
+		t.Error("Expected the iterations to run on the workers of the pool, got busy workers: ", busy, workers)
+	}
+}
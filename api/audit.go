@@ -0,0 +1,211 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	ldb "github.com/sebastianring/simgameserver/db"
+)
+
+// Actions recorded in the audit log, a filter ending in a dot, e.g. preset.,
+// selects all actions on that kind of target.
+const (
+	AuditRunDelete    = "run.delete"
+	AuditPresetCreate = "preset.create"
+	AuditPresetUpdate = "preset.update"
+	AuditPresetDelete = "preset.delete"
+	AuditAPIKeyCreate = "apikey.create"
+	AuditAPIKeyRevoke = "apikey.revoke"
+
+	AuditSigningKeyRotate = "signingkey.rotate"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// errNoAuditDB is returned by the audit log without a db, it is only kept in
+// the db so that it outlives the server and can not be changed.
+var errNoAuditDB = errors.New("The audit log needs a db, please set SIM_GAME_DB_PW or SIM_GAME_DB_PW_FILE.")
+
+// saveAuditEntry function    Appends an entry to the audit log in the db.
+func saveAuditEntry(entry *ldb.DBauditEntry) error {
+	if !ldb.IsConfigured() {
+		return errNoAuditDB
+	}
+
+	db, err := openStoreDB()
+
+	if err != nil {
+		return err
+	}
+
+	return ldb.SaveAuditEntry(db, entry)
+}
+
+// getAuditEntry function    Returns the audit entry of an action of a request
+// with json snapshots of the target before and after it, nil for a target
+// that did not exist. The entry is stored by the store making the change in
+// the same transaction, so that a change is never made without its entry.
+// Nothing is recorded without a db, which only happens with auth off since
+// the server does not start with auth on and no db, then the entry is nil.
+func getAuditEntry(r *http.Request, action string, target string, before any, after any) (*ldb.DBauditEntry, error) {
+	workspace, _ := r.Context().Value(workspaceKey{}).(string)
+
+	return getWorkspaceAuditEntry(r, workspace, action, target, before, after)
+}
+
+// getWorkspaceAuditEntry function    Same as getAuditEntry for an action of a
+// global route in a given workspace, e.g. creating an api key of it.
+func getWorkspaceAuditEntry(r *http.Request, workspace string, action string, target string, before any, after any) (*ldb.DBauditEntry, error) {
+	if !ldb.IsConfigured() {
+		slog.DebugContext(r.Context(), "Not recording audit entry without a db", "action", action, "target", target)
+		return nil, nil
+	}
+
+	entry := ldb.DBauditEntry{
+		Actor:     getCaller(r),
+		RequestID: getRequestID(r.Context()),
+		Workspace: workspace,
+		Action:    action,
+		Target:    target,
+	}
+
+	var err error
+
+	if entry.Before, err = getAuditSnapshot(before); err != nil {
+		return nil, err
+	}
+
+	if entry.After, err = getAuditSnapshot(after); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// recordWorkspaceAudit function    Appends an action of a request in a given
+// workspace to the audit log on its own, for actions of stores that can not
+// record it in their transaction. It is called once the action succeeded, so
+// a failure to record is logged instead of failing the request.
+func recordWorkspaceAudit(r *http.Request, workspace string, action string, target string, before any, after any) {
+	entry, err := getWorkspaceAuditEntry(r, workspace, action, target, before, after)
+
+	if err == nil && entry != nil {
+		_, span := startDBSpan(r.Context(), "saveAuditEntry")
+		err = saveAuditEntry(entry)
+		endSpan(span, &err)
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error recording audit entry", "action", action, "target", target, "error", err)
+	}
+}
+
+func getAuditSnapshot(value any) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(value)
+}
+
+// getAuditFilter function    Returns the filter of the query parameters of
+// /api/audit, since and until are RFC 3339 times.
+func getAuditFilter(query url.Values) (*ldb.AuditFilter, error) {
+	filter := ldb.AuditFilter{
+		Actor:     query.Get("actor"),
+		Action:    query.Get("action"),
+		Target:    query.Get("target"),
+		Workspace: query.Get("workspace"),
+		Limit:     defaultAuditLimit,
+	}
+
+	for _, p := range []struct {
+		name  string
+		value **time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		if v := query.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+
+			if err != nil {
+				return nil, errors.New("Invalid " + p.name + ", should be an RFC 3339 time, e.g. 2024-01-02T15:04:05Z.")
+			}
+
+			*p.value = &t
+		}
+	}
+
+	if v := query.Get("before_id"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+
+		if err != nil || n < 1 {
+			return nil, errors.New("Invalid before_id, should be a positive integer.")
+		}
+
+		filter.BeforeID = n
+	}
+
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+
+		if err != nil || n < 1 || n > maxAuditLimit {
+			return nil, errors.New("Invalid limit, should be between 1 and " + strconv.Itoa(maxAuditLimit) + ".")
+		}
+
+		filter.Limit = n
+	}
+
+	return &filter, nil
+}
+
+// getAuditEntries function    Returns the audit entries selected by the
+// query, newest first. The id of the last entry is the before_id of the next
+// page.
+//
+// A caller only sees the entries of the workspaces it owns, asking for another
+// workspace gets 403.
+func (s *APIServer) getAuditEntries(w http.ResponseWriter, r *http.Request) error {
+	filter, err := getAuditFilter(r.URL.Query())
+
+	if err != nil {
+		return err
+	}
+
+	if owned := getOwnedWorkspaces(r); owned != nil && filter.Workspace != "" && !owned[filter.Workspace] {
+		return WriteJSON(w, http.StatusForbidden, ApiError{Error: "Not an owner of workspace " + filter.Workspace + "."})
+	} else if owned != nil {
+		filter.Workspaces = []string{}
+
+		for workspace := range owned {
+			filter.Workspaces = append(filter.Workspaces, workspace)
+		}
+
+		sort.Strings(filter.Workspaces)
+	}
+
+	if !ldb.IsConfigured() {
+		return errNoAuditDB
+	}
+
+	db, err := openStoreDB()
+
+	if err != nil {
+		return err
+	}
+
+	entries, err := ldb.ListAuditEntries(db, filter)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,174 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type testAuditEntry struct {
+	Id        int64           `json:"id"`
+	Actor     string          `json:"actor"`
+	RequestID string          `json:"request_id"`
+	Workspace string          `json:"workspace"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+}
+
+func getAuditEntries(t *testing.T, router *mux.Router, query string, headers map[string]string) []testAuditEntry {
+	rr := serveAuthRequest(router, "GET", "/api/audit?"+query, "", headers)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal("Expected the audit log, got: ", rr.Code, rr.Body.String())
+	}
+
+	entries := []testAuditEntry{}
+
+	if err := json.NewDecoder(rr.Body).Decode(&entries); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return entries
+}
+
+// getDBRouter function    Returns the router of getAuthRouter with the db of
+// SIM_GAME_TEST_DB_PW, e.g. for the audit log which is only kept in a db. The
+// test is skipped without one.
+func getDBRouter(t *testing.T) *mux.Router {
+	password := os.Getenv("SIM_GAME_TEST_DB_PW")
+
+	if password == "" {
+		t.Skip("The test needs a db, set SIM_GAME_TEST_DB_PW to run it.")
+	}
+
+	router := getAuthRouter(t)
+	t.Setenv("SIM_GAME_DB_PW", password)
+
+	return router
+}
+
+func TestAudit_Presets(t *testing.T) {
+	router := getDBRouter(t)
+	admin := map[string]string{"Authorization": "Bearer " + getTestToken(t, getTestClaims("admin")), "X-Request-ID": "req-audit-1"}
+
+	name := "audited-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	serveAuthRequest(router, "POST", "/api/presets", `{"name": "`+name+`", "config": {"rows": 40}}`, admin)
+	serveAuthRequest(router, "PUT", "/api/presets/"+name, `{"config": {"rows": 50}}`, admin)
+
+	if rr := serveAuthRequest(router, "DELETE", "/api/presets/"+name, "", admin); rr.Header().Get("X-Request-ID") != "req-audit-1" {
+		t.Error("Expected the request id to be sent back, got: ", rr.Header().Get("X-Request-ID"))
+	}
+
+	entries := getAuditEntries(t, router, "target=preset:"+name, admin)
+	actions := []string{"preset.delete", "preset.update", "preset.create"}
+
+	if len(entries) != len(actions) {
+		t.Fatal("Expected an entry per change, got: ", entries)
+	}
+
+	for i, entry := range entries {
+		if entry.Action != actions[i] || entry.Actor != "sub:test" || entry.RequestID != "req-audit-1" || entry.Workspace != "default" {
+			t.Error("Unexpected entry: ", entry)
+		}
+	}
+
+	if entries[2].Before != nil || entries[0].After != nil {
+		t.Error("Expected no snapshot before a create or after a delete")
+	}
+
+	before, after := struct{ Version int }{}, struct{ Version int }{}
+	json.Unmarshal(entries[1].Before, &before)
+	json.Unmarshal(entries[1].After, &after)
+
+	if before.Version != 1 || after.Version != 2 {
+		t.Error("Expected the versions before and after the update, got: ", before, after)
+	}
+
+	if page := getAuditEntries(t, router, "target=preset:"+name+"&limit=1", admin); len(page) != 1 || page[0].Id != entries[0].Id {
+		t.Error("Expected the newest entry, got: ", page)
+	}
+
+	if page := getAuditEntries(t, router, "action=preset.&before_id="+strconv.FormatInt(entries[0].Id, 10), admin); len(page) < 2 || page[0].Id != entries[1].Id {
+		t.Error("Expected the entries before the id, got: ", page)
+	}
+}
+
+func TestAudit_APIKeys(t *testing.T) {
+	router := getDBRouter(t)
+	admin := map[string]string{"Authorization": "Bearer " + getTestToken(t, getTestClaims("admin"))}
+
+	rr := serveAuthRequest(router, "POST", "/api/keys", `{"owner": "audit", "scopes": ["sim:read"]}`, admin)
+	created := struct {
+		Id string `json:"id"`
+	}{}
+	json.NewDecoder(rr.Body).Decode(&created)
+	serveAuthRequest(router, "DELETE", "/api/keys/"+created.Id, "", admin)
+
+	entries := getAuditEntries(t, router, "target=apikey:"+created.Id, admin)
+
+	if len(entries) != 2 || entries[0].Action != "apikey.revoke" || entries[1].Action != "apikey.create" || entries[0].RequestID == "" {
+		t.Fatal("Expected the key to be audited, got: ", entries)
+	}
+
+	revoked := struct {
+		RevokedAt *string `json:"revoked_at"`
+	}{}
+	json.Unmarshal(entries[0].After, &revoked)
+
+	if revoked.RevokedAt == nil {
+		t.Error("Expected the snapshot after the revoke to be revoked, got: ", string(entries[0].After))
+	}
+}
+
+func TestAudit_Access(t *testing.T) {
+	router := getAuthRouter(t)
+	reader := map[string]string{"Authorization": "Bearer " + getTestToken(t, getTestClaims("sim:read"))}
+	admin := map[string]string{"Authorization": "Bearer " + getTestToken(t, getTestClaims("admin"))}
+
+	if rr := serveAuthRequest(router, "GET", "/api/audit", "", reader); rr.Code != http.StatusForbidden {
+		t.Error("Expected the audit log to need the admin scope, got: ", rr.Code)
+	}
+
+	for _, query := range []string{"since=yesterday", "limit=0", "limit=1001", "before_id=x"} {
+		if rr := serveAuthRequest(router, "GET", "/api/audit?"+query, "", admin); rr.Code != http.StatusBadRequest {
+			t.Error("Expected an error for: ", query, rr.Code)
+		}
+	}
+
+	teamA := getWorkspaceToken(t, "admin", map[string]string{"team-a": "owner", "team-b": "member"})
+
+	if rr := serveAuthRequest(router, "GET", "/api/audit?workspace=team-b", "", teamA); rr.Code != http.StatusForbidden {
+		t.Error("Expected the audit log of a workspace the caller does not own to be refused, got: ", rr.Code)
+	}
+
+	if rr := serveAuthRequest(router, "GET", "/api/audit", "", admin); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "needs a db") {
+		t.Error("Expected the audit log to need a db, got: ", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAudit_Workspaces(t *testing.T) {
+	router := getDBRouter(t)
+	teamA := getWorkspaceToken(t, "admin", map[string]string{"team-a": "owner", "team-b": "member"})
+	teamB := getWorkspaceToken(t, "admin", map[string]string{"team-b": "owner"})
+	teamB["X-Workspace"] = "team-b"
+
+	name := "audited-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	serveAuthRequest(router, "POST", "/api/presets", `{"name": "`+name+`", "config": {"rows": 40}}`, teamB)
+	defer serveAuthRequest(router, "DELETE", "/api/presets/"+name, "", teamB)
+
+	if entries := getAuditEntries(t, router, "target=preset:"+name, teamA); len(entries) != 0 {
+		t.Error("Expected the entries of a workspace the caller does not own to be left out, got: ", entries)
+	}
+
+	if entries := getAuditEntries(t, router, "target=preset:"+name, teamB); len(entries) != 1 || entries[0].Workspace != "team-b" {
+		t.Error("Expected the entry among the entries of its workspace, got: ", entries)
+	}
+}
@@ -0,0 +1,348 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/sebastianring/simgameserver/redact"
+)
+
+// Scopes a token can carry, admin grants every other scope as well.
+const (
+	ScopeRun    = "sim:run"
+	ScopeRead   = "sim:read"
+	ScopeDelete = "sim:delete"
+	ScopeAdmin  = "admin"
+)
+
+const minJWTSecretLength = 32
+
+const defaultTokenTTL = 15 * time.Minute
+
+const defaultKeyRotation = 24 * time.Hour
+
+// Scopes are all scopes a token can carry.
+var Scopes = []string{ScopeRun, ScopeRead, ScopeDelete, ScopeAdmin}
+
+// routeScopes are the scopes a route needs by method when auth is enabled,
+// keyed by the path template of the route. A method missing from a route only
+// needs a valid token. A route missing here and from openRoutes is refused,
+// so that a new route is never open by mistake.
+var routeScopes = map[string]map[string]string{
+	"/api/new_single_sim":                                  {"GET": ScopeRun},
+	"/api/new_multiple_sim/{iterations:[1-9][0-9]*}":       {"GET": ScopeRun},
+	"/api/stream/multiple_sim/{iterations:[1-9][0-9]*}":    {"GET": ScopeRun},
+	"/api/ws/replay":                                       {"GET": ScopeRun},
+	"/api/new_random_sim":                                  {"GET": ScopeRun},
+	"/api/chart/new_single_sim":                            {"GET": ScopeRun},
+	"/api/chart/new_multiple_sim/{iterations:[1-9][0-9]*}": {"GET": ScopeRun},
+	"/api/chart/sim/{id:[0-9a-fA-F-]+}":                    {"GET": ScopeRead},
+	"/api/gif/new_single_sim":                              {"GET": ScopeRun},
+	"/new_sim_form":                                        {"POST": ScopeRun},
+	"/ui/":                                                 {"GET": ScopeRead},
+	"/ui/run":                                              {"GET": ScopeRun},
+	"/ui/sim/{id:[0-9a-fA-F-]+}":                           {"GET": ScopeRead},
+	"/ui/history":                                          {"GET": ScopeRead},
+	"/ui/compare":                                          {"GET": ScopeRead},
+	"/api/compare":                                         {"GET": ScopeRead, "POST": ScopeRun},
+	"/api/experiment":                                      {"POST": ScopeRun},
+	"/api/sensitivity":                                     {"GET": ScopeRun},
+	"/api/search":                                          {"POST": ScopeRun},
+	"/api/batch":                                           {"POST": ScopeRun},
+	"/api/presets":                                         {"GET": ScopeRead, "POST": ScopeAdmin},
+	"/api/presets/{name}":                                  {"GET": ScopeRead, "PUT": ScopeAdmin, "DELETE": ScopeAdmin},
+	"/api/presets/{name}/versions":                         {"GET": ScopeRead},
+	"/api/sim/{id:[0-9a-fA-F-]+}":                          {"GET": ScopeRead, "DELETE": ScopeDelete},
+	"/api/sim/{id:[0-9a-fA-F-]+}/rounds":                   {"GET": ScopeRead},
+	"/api/keys":                                            {"GET": ScopeAdmin, "POST": ScopeAdmin},
+	"/api/keys/{id}":                                       {"DELETE": ScopeAdmin},
+	"/api/workspaces":                                      {"GET": ScopeRead},
+	"/api/audit":                                           {"GET": ScopeAdmin},
+}
+
+// openRoutes need no token, e.g. the redirect to the ui and getting a token.
+var openRoutes = map[string]bool{
+	"/":                      true,
+	"/api/token":             true,
+	"/.well-known/jwks.json": true,
+	"/metrics":               true,
+}
+
+// authConfig is read from the environment: SIM_GAME_AUTH turns auth on, and
+// tokens are for the audience JWT_AUDIENCE by the issuer JWT_ISSUER, both
+// simgameserver by default. JWT_ALG is HS256 by default, signing with
+// JWT_SECRET, or RS256 or EdDSA, signing with a key set kept in JWT_KEYS_DIR
+// and rotated every JWT_ROTATION. HMAC tokens are still accepted with an
+// asymmetric JWT_ALG when JWT_SECRET is set. Tokens issued for api keys are
+// valid for JWT_TTL, 15 minutes by default.
+type authConfig struct {
+	enabled  bool
+	secret   []byte
+	keys     *keySet
+	issuer   string
+	audience string
+	tokenTTL time.Duration
+}
+
+// getAuthConfig function    Returns the auth config of the environment, an
+// error if auth is enabled without a secret that is long enough.
+func getAuthConfig() (*authConfig, error) {
+	config := authConfig{
+		secret:   []byte(os.Getenv("JWT_SECRET")),
+		issuer:   os.Getenv("JWT_ISSUER"),
+		audience: os.Getenv("JWT_AUDIENCE"),
+	}
+
+	redact.Register(string(config.secret))
+
+	switch strings.ToLower(os.Getenv("SIM_GAME_AUTH")) {
+	case "", "false", "0", "off":
+	case "true", "1", "on":
+		config.enabled = true
+	default:
+		return nil, errors.New("Invalid SIM_GAME_AUTH, should be true or false.")
+	}
+
+	if config.issuer == "" {
+		config.issuer = "simgameserver"
+	}
+
+	if config.audience == "" {
+		config.audience = "simgameserver"
+	}
+
+	config.tokenTTL = defaultTokenTTL
+
+	if ttl := os.Getenv("JWT_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+
+		if err != nil || d < time.Minute || d > 24*time.Hour {
+			return nil, errors.New("Invalid JWT_TTL, should be a duration between 1m and 24h.")
+		}
+
+		config.tokenTTL = d
+	}
+
+	alg := os.Getenv("JWT_ALG")
+
+	if alg == "" || alg == "HS256" {
+		if config.enabled && len(config.secret) < minJWTSecretLength {
+			return nil, fmt.Errorf("Auth is enabled but JWT_SECRET is missing or shorter than %d bytes.", minJWTSecretLength)
+		}
+
+		return &config, nil
+	}
+
+	if len(config.secret) > 0 && len(config.secret) < minJWTSecretLength {
+		return nil, fmt.Errorf("JWT_SECRET is shorter than %d bytes.", minJWTSecretLength)
+	}
+
+	rotation := defaultKeyRotation
+
+	if value := os.Getenv("JWT_ROTATION"); value != "" {
+		d, err := time.ParseDuration(value)
+
+		if err != nil || d < time.Hour || d > 90*24*time.Hour {
+			return nil, errors.New("Invalid JWT_ROTATION, should be a duration between 1h and 2160h.")
+		}
+
+		rotation = d
+	}
+
+	keys, err := newKeySet(alg, os.Getenv("JWT_KEYS_DIR"), rotation, config.tokenTTL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	config.keys = keys
+
+	return &config, nil
+}
+
+// authClaims are the claims of a token, scope holds the scopes separated by
+// spaces as in RFC 8693 and workspaces the role of the caller by workspace.
+type authClaims struct {
+	Scope      string            `json:"scope"`
+	Owner      string            `json:"owner,omitempty"`
+	Workspaces map[string]string `json:"workspaces,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func (c *authClaims) hasScope(scope string) bool {
+	for _, s := range strings.Fields(c.Scope) {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+type claimsKey struct{}
+
+// getClaims function    Returns the claims of the token a request was
+// authenticated with, nil when auth is disabled or the route is open.
+func getClaims(r *http.Request) *authClaims {
+	claims, _ := r.Context().Value(claimsKey{}).(*authClaims)
+
+	return claims
+}
+
+// validateJWT function    Parses a token and checks its signature, expiry,
+// issuer and audience. HMAC tokens are checked with the secret and RS256 or
+// EdDSA tokens with the key of their kid. Tokens without an expiry are
+// rejected.
+func validateJWT(tokenString string, config *authConfig) (*authClaims, error) {
+	claims := authClaims{}
+	methods := []string{}
+
+	if len(config.secret) >= minJWTSecretLength {
+		methods = append(methods, jwt.SigningMethodHS256.Alg(), jwt.SigningMethodHS384.Alg(), jwt.SigningMethodHS512.Alg())
+	}
+
+	if config.keys != nil {
+		methods = append(methods, config.keys.signingMethod().Alg())
+	}
+
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+			return config.secret, nil
+		}
+
+		if config.keys == nil {
+			return nil, fmt.Errorf("Unexpected signing method: %v ", token.Header["alg"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		key, ok := config.keys.publicKey(kid)
+
+		if !ok {
+			return nil, fmt.Errorf("Unknown signing key: %v ", token.Header["kid"])
+		}
+
+		return key, nil
+	}, jwt.WithValidMethods(methods), jwt.WithIssuer(config.issuer), jwt.WithAudience(config.audience), jwt.WithLeeway(30*time.Second))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("Token has no expiry.")
+	}
+
+	return &claims, nil
+}
+
+// issueJWT function    Returns a token signed with the current key of the
+// key set, or with the secret when there is none, valid for the token ttl.
+func issueJWT(config *authConfig, subject string, owner string, scopes []string, workspaces map[string]string) (string, error) {
+	if config.keys == nil && len(config.secret) < minJWTSecretLength {
+		return "", errors.New("Tokens can not be issued, JWT_SECRET is missing or too short.")
+	}
+
+	now := time.Now()
+	claims := authClaims{
+		Scope:      strings.Join(scopes, " "),
+		Owner:      owner,
+		Workspaces: workspaces,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			Issuer:    config.issuer,
+			Audience:  jwt.ClaimStrings{config.audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(config.tokenTTL)),
+		},
+	}
+
+	if config.keys != nil {
+		return config.keys.sign(&claims)
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, &claims).SignedString(config.secret)
+}
+
+// getToken function    Returns the bearer token of a request. The
+// x-jwt-token header is still accepted, and websocket handshakes can pass
+// the token as access_token since browsers can not set their headers.
+func getToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+
+	if token := r.Header.Get("x-jwt-token"); token != "" {
+		return token
+	}
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return r.URL.Query().Get("access_token")
+	}
+
+	return ""
+}
+
+// WithJWTAuth function    Middleware checking the token of every request to a
+// route in routeScopes, 401 is returned for a missing or invalid token and
+// 403 for a token without the scope of the route or a route in neither
+// routeScopes nor openRoutes.
+func (s *APIServer) WithJWTAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.auth.enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := mux.CurrentRoute(r)
+
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		template, _ := route.GetPathTemplate()
+
+		if openRoutes[template] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scopes, ok := routeScopes[template]
+
+		if !ok {
+			WriteJSON(w, http.StatusForbidden, ApiError{Error: "The route " + template + " has no scopes and is not open."})
+			return
+		}
+
+		token := getToken(r)
+
+		if token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="simgameserver"`)
+			WriteJSON(w, http.StatusUnauthorized, ApiError{Error: "Missing bearer token."})
+			return
+		}
+
+		claims, err := validateJWT(token, s.auth)
+
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="simgameserver", error="invalid_token"`)
+			WriteJSON(w, http.StatusUnauthorized, ApiError{Error: "Issue validating JWT: " + err.Error()})
+			return
+		}
+
+		if scope, ok := scopes[r.Method]; ok && !claims.hasScope(scope) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="simgameserver", error="insufficient_scope", scope="`+scope+`"`)
+			WriteJSON(w, http.StatusForbidden, ApiError{Error: "Token is missing the scope " + scope + "."})
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+	})
+}
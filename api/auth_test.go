@@ -0,0 +1,158 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/sebastianring/simgameserver/api"
+)
+
+var pathVariable = regexp.MustCompile(`\{([a-z]+)(:[^}]*)?\}`)
+
+const testSecret = "a-test-secret-that-is-long-enough-for-hs256"
+
+func getTestToken(t *testing.T, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return token
+}
+
+func getTestClaims(scope string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "test",
+		"iss":   "simgameserver",
+		"aud":   "simgameserver",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": scope,
+	}
+}
+
+func getAuthRouter(t *testing.T) *mux.Router {
+	t.Setenv("SIM_GAME_AUTH", "true")
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("SIM_GAME_DB_PW", "")
+
+	router, err := api.NewAPIServer(":8080").NewRouter()
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return router
+}
+
+func TestAuth_Router(t *testing.T) {
+	router := getAuthRouter(t)
+
+	expired := getTestClaims("admin")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	wrongAudience := getTestClaims("admin")
+	wrongAudience["aud"] = "other"
+	wrongIssuer := getTestClaims("admin")
+	wrongIssuer["iss"] = "other"
+	noExpiry := getTestClaims("admin")
+	delete(noExpiry, "exp")
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		token  string
+		status int
+	}{
+		{"no token", "GET", "/api/presets", "", http.StatusUnauthorized},
+		{"garbage token", "GET", "/api/presets", "not-a-token", http.StatusUnauthorized},
+		{"expired", "GET", "/api/presets", getTestToken(t, expired), http.StatusUnauthorized},
+		{"wrong audience", "GET", "/api/presets", getTestToken(t, wrongAudience), http.StatusUnauthorized},
+		{"wrong issuer", "GET", "/api/presets", getTestToken(t, wrongIssuer), http.StatusUnauthorized},
+		{"no expiry", "GET", "/api/presets", getTestToken(t, noExpiry), http.StatusUnauthorized},
+		{"read scope", "GET", "/api/presets", getTestToken(t, getTestClaims("sim:read")), http.StatusOK},
+		{"missing scope", "POST", "/api/presets", getTestToken(t, getTestClaims("sim:read sim:run")), http.StatusForbidden},
+		{"admin scope", "POST", "/api/presets", getTestToken(t, getTestClaims("admin")), http.StatusBadRequest},
+		{"open route", "GET", "/", "", http.StatusFound},
+		{"form without token", "POST", "/new_sim_form", "", http.StatusUnauthorized},
+		{"form without run scope", "POST", "/new_sim_form", getTestToken(t, getTestClaims("sim:read")), http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.url, strings.NewReader("{}"))
+
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d: %s", test.name, test.status, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestAuth_EveryRouteHasScopes(t *testing.T) {
+	router := getAuthRouter(t)
+	open := map[string]bool{"/": true, "/api/token": true, "/.well-known/jwks.json": true, "/metrics": true}
+
+	router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, _ := route.GetPathTemplate()
+
+		if open[template] {
+			return nil
+		}
+
+		path := pathVariable.ReplaceAllStringFunc(template, func(v string) string {
+			return map[string]string{"iterations": "1", "id": "0b7a2c8e-0f6e-4a39-9b1e-7d3c5a1f2e44", "name": "x"}[pathVariable.FindStringSubmatch(v)[1]]
+		})
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Error("Expected route to need a token: ", template)
+		}
+
+		return nil
+	})
+}
+
+func TestAuth_UnlistedRoute(t *testing.T) {
+	router := getAuthRouter(t)
+	router.HandleFunc("/unlisted", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", "/unlisted", nil)
+	req.Header.Set("Authorization", "Bearer "+getTestToken(t, getTestClaims("admin")))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Error("Expected a route without scopes to be refused, got: ", rr.Code)
+	}
+}
+
+func TestAuth_MissingSecret(t *testing.T) {
+	t.Setenv("SIM_GAME_AUTH", "true")
+	t.Setenv("JWT_SECRET", "")
+
+	if _, err := api.NewAPIServer(":8080").NewRouter(); err == nil {
+		t.Error("Expected an error when auth is enabled without a secret")
+	}
+
+	t.Setenv("JWT_SECRET", "short")
+
+	if _, err := api.NewAPIServer(":8080").NewRouter(); err == nil {
+		t.Error("Expected an error when the secret is too short")
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	sg "github.com/sebastianring/simulationgame"
+)
+
+const (
+	DefaultGIFCellSize = 8
+	DefaultGIFDelay    = 500
+	maxGIFSide         = 2000
+)
+
+// gifColors are the colors of the board objects, the same as the simulation
+// game uses when drawing to a terminal. Index 0 is used for empty cells.
+var gifColors = map[sg.BoardObjectType]color.RGBA{
+	sg.EmptyType:     {0, 0, 0, 255},
+	sg.FoodType:      {0, 170, 0, 255},
+	sg.Creature1Type: {0, 200, 200, 255},
+	sg.Creature2Type: {220, 30, 30, 255},
+}
+
+var gifPalette = color.Palette{
+	gifColors[sg.EmptyType],
+	gifColors[sg.FoodType],
+	gifColors[sg.Creature1Type],
+	gifColors[sg.Creature2Type],
+}
+
+// getBoardGIF function    Returns an animated gif with one image per frame,
+// delay is in milliseconds. The last frame is shown three times as long to
+// make it clear where the animation loops.
+func getBoardGIF(config *sg.SimulationConfig, frames []*boardFrame, cellSize int, delay int) *gif.GIF {
+	width := config.Cols * cellSize
+	height := config.Rows * cellSize
+	anim := gif.GIF{}
+
+	for i, frame := range frames {
+		img := image.NewPaletted(image.Rect(0, 0, width, height), gifPalette)
+
+		for t, name := range boardObjectNames {
+			index := uint8(gifPalette.Index(gifColors[t]))
+
+			for _, cell := range frame.Cells[name] {
+				for y := cell[1] * cellSize; y < (cell[1]+1)*cellSize; y++ {
+					for x := cell[0] * cellSize; x < (cell[0]+1)*cellSize; x++ {
+						img.SetColorIndex(x, y, index)
+					}
+				}
+			}
+		}
+
+		frameDelay := delay / 10
+
+		if i == len(frames)-1 {
+			frameDelay *= 3
+		}
+
+		anim.Image = append(anim.Image, img)
+		anim.Delay = append(anim.Delay, frameDelay)
+	}
+
+	return &anim
+}
+
+// WriteSimulationGIF function    Runs a simulation with the config in the url
+// values and writes it to w as an animated gif, one frame per round. The run
+// is stored in the workspace of ctx.
+func WriteSimulationGIF(ctx context.Context, w io.Writer, values url.Values, cellSize int, delay int) error {
+	if cellSize < 1 || cellSize > 20 {
+		return errors.New("Invalid value for cellsize, should be between 1-20.")
+	}
+
+	if delay < 20 || delay > 5000 {
+		return errors.New("Invalid value for delay, should be between 20-5000 milliseconds.")
+	}
+
+	config, err := getQueryConfig(ctx, values)
+
+	if err != nil {
+		return err
+	}
+
+	if config.Cols*cellSize > maxGIFSide || config.Rows*cellSize > maxGIFSide {
+		return errors.New("Gif would be too large, please use a smaller cell size, max side is " + strconv.Itoa(maxGIFSide) + " pixels.")
+	}
+
+	run, frames, err := runSimulationFrames(ctx, config)
+
+	if err != nil {
+		return err
+	}
+
+	anim := getBoardGIF(config, frames, cellSize, delay)
+
+	if err := storeRun(ctx, run); err != nil {
+		slog.ErrorContext(ctx, "Error storing run", "run_id", run.RunID, "error", err)
+	}
+
+	if rw, ok := w.(http.ResponseWriter); ok {
+		rw.Header().Set("Content-Type", "image/gif")
+	}
+
+	return gif.EncodeAll(w, anim)
+}
+
+func (s *APIServer) getSimulationGIF(w http.ResponseWriter, r *http.Request) error {
+	cellSize, err := getIntOption(r, "cellsize", DefaultGIFCellSize, 1, 20)
+
+	if err != nil {
+		return err
+	}
+
+	delay, err := getIntOption(r, "delay", DefaultGIFDelay, 20, 5000)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteSimulationGIF(r.Context(), w, r.URL.Query(), cellSize, delay)
+}
@@ -0,0 +1,50 @@
+package api_test
+
+import (
+	"image/gif"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sebastianring/simgameserver/api"
+)
+
+func TestAPIServer_SimulationGIF(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/gif/new_single_sim?rows=30&cols=60&cellsize=4&delay=100", nil)
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+	err := s.HandleSimulationGIF(rr, req)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	anim, err := gif.DecodeAll(rr.Body)
+
+	if err != nil {
+		t.Fatal("Issue decoding gif: ", err.Error())
+	}
+
+	if len(anim.Image) < 2 {
+		t.Error("Expected at least the first and last frame, got: ", len(anim.Image))
+	}
+
+	if b := anim.Image[0].Bounds(); b.Dx() != 240 || b.Dy() != 120 {
+		t.Error("Wrong gif size: ", b)
+	}
+
+	if anim.Delay[0] != 10 {
+		t.Error("Wrong frame delay: ", anim.Delay[0])
+	}
+}
+
+func TestAPIServer_SimulationGIFTooLarge(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/gif/new_single_sim?cols=200&cellsize=20", nil)
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+
+	if err := s.HandleSimulationGIF(rr, req); err == nil {
+		t.Error("Expected an error for a too large gif")
+	}
+}
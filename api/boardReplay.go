@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	sg "github.com/sebastianring/simulationgame"
+)
+
+// boardFrame is the state of a board after a round, Cells holds the positions
+// of every non-empty cell as [x, y] grouped by object type, i.e. the board as
+// the next round starts. Frame 0 is the board before the first round.
+type boardFrame struct {
+	Round   int                                        `json:"round"`
+	Rows    int                                        `json:"rows"`
+	Cols    int                                        `json:"cols"`
+	Cells   map[string][][2]int                        `json:"cells"`
+	Summary map[sg.BoardObjectType]*sg.CreatureSummary `json:"summary,omitempty"`
+}
+
+var boardObjectNames = map[sg.BoardObjectType]string{
+	sg.Creature1Type: "creature1",
+	sg.Creature2Type: "creature2",
+	sg.FoodType:      "food",
+}
+
+// getBoardObjectType function    Returns the type of an object on the board,
+// the type field of empty and food objects is never set by the simulation game
+// so the concrete type is used instead.
+func getBoardObjectType(bo sg.BoardObject) sg.BoardObjectType {
+	switch bo.(type) {
+	case *sg.Creature1:
+		return sg.Creature1Type
+	case *sg.Creature2:
+		return sg.Creature2Type
+	case *sg.Food:
+		return sg.FoodType
+	}
+
+	return sg.EmptyType
+}
+
+func captureFrame(b *sg.Board, round int, summary map[sg.BoardObjectType]*sg.CreatureSummary) *boardFrame {
+	frame := boardFrame{
+		Round:   round,
+		Rows:    b.Rows,
+		Cols:    b.Cols,
+		Cells:   map[string][][2]int{},
+		Summary: summary,
+	}
+
+	for _, name := range boardObjectNames {
+		frame.Cells[name] = [][2]int{}
+	}
+
+	for y, row := range b.ObjectBoard {
+		for x, bo := range row {
+			if name, ok := boardObjectNames[getBoardObjectType(bo)]; ok {
+				frame.Cells[name] = append(frame.Cells[name], [2]int{x, y})
+			}
+		}
+	}
+
+	return &frame
+}
+
+// checkBoardLimits function    Same limits as sg.RunSimulation checks before
+// creating a board, spawning more foods or creatures than there is room for
+// never finishes.
+func checkBoardLimits(config *sg.SimulationConfig) error {
+	maxFoods := config.Rows * config.Cols / 2
+
+	if config.Foods > maxFoods {
+		return errors.New("Foods outside interval, min = 1, max = " + strconv.Itoa(maxFoods))
+	}
+
+	maxCreatures := uint((config.Cols*2 + config.Rows*2 - 4) / 2)
+
+	if config.Creature1 < 1 && config.Creature2 < 1 || config.Creature1 > maxCreatures || config.Creature2 > maxCreatures {
+		return errors.New("Creatures outside interval, min = 1, max = " + strconv.Itoa(int(maxCreatures)))
+	}
+
+	return nil
+}
+
+// runSimulationFrames function    Runs a simulation tick by tick instead of
+// through sg.RunSimulation, so the board can be captured after every round.
+// The board is not written to the db by the simulation game in this case.
+func runSimulationFrames(ctx context.Context, config *sg.SimulationConfig) (run *simulationRun, frames []*boardFrame, err error) {
+	ctx, span := startSimulationSpan(ctx, config)
+	defer endSimulationSpan(span, &run, &err)
+	defer logSimulation(ctx, config, time.Now(), &run, &err)
+	defer recoverSimulation(&err)
+
+	if err := checkBoardLimits(config); err != nil {
+		return nil, nil, err
+	}
+
+	settle, err := reserveQuota(ctx, config)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer func() { settle(run) }()
+
+	engineLock.RLock()
+	defer engineLock.RUnlock()
+
+	board := sg.NewBoard(config)
+	frames = []*boardFrame{captureFrame(board, 0, nil)}
+	rounds := len(board.Rounds)
+
+	for board.GameOn {
+		board.TickFrame()
+
+		if len(board.Rounds) == rounds && board.GameOn {
+			continue
+		}
+
+		// The last completed round is the current one when the game has ended,
+		// otherwise the one before the round that was just started.
+		completed := board.CurrentRound
+
+		if len(board.Rounds) != rounds {
+			completed = board.Rounds[len(board.Rounds)-2]
+		}
+
+		frames = append(frames, captureFrame(board, completed.Id, completed.CreaturesAliveAtEndSum))
+		rounds = len(board.Rounds)
+	}
+
+	roundData, err := getRoundData(board, AliveAtEnd)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	run = &simulationRun{
+		RunID:        board.Id,
+		Config:       config,
+		Rounds:       roundData,
+		RoundsPlayed: getRoundsPlayed(board),
+	}
+
+	return run, frames, nil
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	sc "github.com/sebastianring/simgameserver/simconfig"
+)
+
+// ExportRuns function    Writes the stored runs of a workspace with the given
+// ids, followed by a number of fresh random runs stored in it, to w in the
+// given format. The fresh runs are run on the shared pool and stored in one
+// batch. Used by the export command, the API negotiates the format per
+// request instead.
+func ExportRuns(w io.Writer, format ResultFormat, workspace string, ids []string, iterations int) error {
+	if !workspaceNamePattern.MatchString(workspace) {
+		return errors.New("Invalid workspace name, should be 1-64 lowercase letters, digits, - or _.")
+	}
+
+	ctx := context.WithValue(context.Background(), workspaceKey{}, workspace)
+	rw, err := newFormatWriter(w, format, false)
+
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		run, err := loadRun(ctx, id)
+
+		if err != nil {
+			return err
+		}
+
+		if err := rw.WriteRun(run); err != nil {
+			return err
+		}
+	}
+
+	sc.InitRules()
+
+	jobs := make([]simulationJob, iterations)
+
+	for i := range jobs {
+		config, err := sc.GetRandomSimulationConfig()
+
+		if err != nil {
+			return err
+		}
+
+		jobs[i].config = config
+	}
+
+	for _, outcome := range runJobs(ctx, jobs) {
+		if outcome.err != nil {
+			return outcome.err
+		}
+
+		if err := rw.WriteRun(outcome.run); err != nil {
+			return err
+		}
+	}
+
+	return rw.Close()
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	ldb "github.com/sebastianring/simgameserver/db"
+	sc "github.com/sebastianring/simgameserver/simconfig"
+	sg "github.com/sebastianring/simulationgame"
+)
+
+// metricsRegistry holds the metrics served at /metrics, a registry of its own
+// so that tests making many routers do not register them twice.
+var metricsRegistry = prometheus.NewRegistry()
+
+var metrics = promauto.With(metricsRegistry)
+
+// boardSizes are the upper bounds in cells of the board size label of the
+// simulation metrics.
+var boardSizes = []int{1000, 10000, 100000}
+
+var (
+	httpRequests = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "simgame_http_requests_total",
+		Help: "HTTP requests by route template, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = metrics.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "simgame_http_request_duration_seconds",
+		Help:    "HTTP request latency by route template, method and status, streams count until they end.",
+		Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"route", "method", "status"})
+
+	simulationDuration = metrics.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "simgame_simulation_duration_seconds",
+		Help:    "Duration of simulations by board size in cells, the upper bound or +Inf, and outcome.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"board_size", "outcome"})
+
+	resultCacheLookups = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "simgame_result_cache_lookups_total",
+		Help: "Lookups of seeded runs by result: memory_hit, db_hit or miss.",
+	}, []string{"result"})
+
+	validationFailures = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "simgame_validation_failures_total",
+		Help: "Config values rejected by parameter.",
+	}, []string{"parameter"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	sc.OnValidationFailure = func(parameter string) { validationFailures.WithLabelValues(parameter).Inc() }
+
+	metrics.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "simgame_worker_pool_queue_depth",
+		Help: "Simulations waiting for a worker of the shared pool.",
+	}, func() float64 { return float64(simulationPool.waiting.Load()) })
+
+	metrics.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "simgame_worker_pool_busy_workers",
+		Help: "Workers of the shared pool running a simulation.",
+	}, func() float64 { return float64(simulationPool.busy.Load()) })
+
+	metrics.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "simgame_worker_pool_utilization",
+		Help: "Share of the workers of the shared pool running a simulation.",
+	}, func() float64 { return float64(simulationPool.busy.Load()) / float64(simulationPool.workers) })
+
+	metrics.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "simgame_worker_pool_workers",
+		Help: "Workers of the shared pool.",
+	}, func() float64 { return float64(simulationPool.workers) })
+
+	metricsRegistry.MustRegister(dbPoolCollector{})
+}
+
+var (
+	dbOpenDesc      = prometheus.NewDesc("simgame_db_open_connections", "Open connections of the db pool.", nil, nil)
+	dbInUseDesc     = prometheus.NewDesc("simgame_db_in_use_connections", "Connections of the db pool in use.", nil, nil)
+	dbIdleDesc      = prometheus.NewDesc("simgame_db_idle_connections", "Idle connections of the db pool.", nil, nil)
+	dbWaitCountDesc = prometheus.NewDesc("simgame_db_wait_count_total", "Times a query waited for a connection of the db pool.", nil, nil)
+	dbWaitDesc      = prometheus.NewDesc("simgame_db_wait_duration_seconds_total", "Time queries waited for a connection of the db pool.", nil, nil)
+)
+
+// dbPoolCollector reports the stats of the db pool, nothing before it is
+// opened or without a db.
+type dbPoolCollector struct{}
+
+func (dbPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{dbOpenDesc, dbInUseDesc, dbIdleDesc, dbWaitCountDesc, dbWaitDesc} {
+		ch <- desc
+	}
+}
+
+func (dbPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, ok := ldb.PoolStats()
+
+	if !ok {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(dbOpenDesc, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbInUseDesc, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(dbIdleDesc, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(dbWaitCountDesc, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(dbWaitDesc, prometheus.CounterValue, stats.WaitDuration.Seconds())
+}
+
+// getBoardSizeLabel function    Returns the smallest board size bound the
+// cells of a config fit in.
+func getBoardSizeLabel(config *sg.SimulationConfig) string {
+	cells := config.Rows * config.Cols
+
+	for _, size := range boardSizes {
+		if cells <= size {
+			return strconv.Itoa(size)
+		}
+	}
+
+	return "+Inf"
+}
+
+// statusRecorder keeps the status of a response, it passes flushes and
+// hijacks on so that streams and websockets keep working.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+
+	if !ok {
+		return nil, nil, errors.New("The response writer does not support hijacking.")
+	}
+
+	// A hijacked connection is upgraded, e.g. to a websocket.
+	w.status = http.StatusSwitchingProtocols
+
+	return h.Hijack()
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// WithMetrics function    Middleware counting the requests of every route
+// and their latency by the path template, so that ids do not make a series
+// each.
+func (s *APIServer) WithMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := getRouteTemplate(r)
+		started := time.Now()
+		recorder := statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(&recorder, r)
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		labels := prometheus.Labels{"route": route, "method": r.Method, "status": strconv.Itoa(recorder.status)}
+		httpRequests.With(labels).Inc()
+		httpDuration.With(labels).Observe(time.Since(started).Seconds())
+	})
+}
+
+// getMetricsHandler function    Returns the handler serving the metrics in
+// the Prometheus exposition format.
+func getMetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,44 @@
+package api_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	router := getAuthRouter(t)
+	token := map[string]string{"Authorization": "Bearer " + getTestToken(t, getTestClaims("admin"))}
+
+	if rr := serveAuthRequest(router, "GET", "/api/new_single_sim?seed=7", "", token); rr.Code != http.StatusOK {
+		t.Fatal("Expected a run, got: ", rr.Code, rr.Body.String())
+	}
+
+	serveAuthRequest(router, "GET", "/api/new_single_sim?seed=7", "", token)
+	serveAuthRequest(router, "GET", "/api/new_single_sim?rows=abc", "", token)
+
+	rr := serveAuthRequest(router, "GET", "/metrics", "", nil)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal("Expected the metrics without a token, got: ", rr.Code)
+	}
+
+	body, _ := io.ReadAll(rr.Body)
+
+	for _, line := range []string{
+		`simgame_http_requests_total{method="GET",route="/api/new_single_sim",status="200"}`,
+		`simgame_http_requests_total{method="GET",route="/api/new_single_sim",status="400"}`,
+		`simgame_http_request_duration_seconds_bucket{method="GET",route="/api/new_single_sim",status="200",le="+Inf"}`,
+		`simgame_simulation_duration_seconds_count{board_size="10000",outcome="ok"}`,
+		`simgame_result_cache_lookups_total{result="memory_hit"}`,
+		`simgame_validation_failures_total{parameter="rows"}`,
+		`simgame_worker_pool_queue_depth`,
+		`simgame_worker_pool_utilization`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Error("Expected the metrics to have: ", line)
+		}
+	}
+}
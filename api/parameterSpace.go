@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	sc "github.com/sebastianring/simgameserver/simconfig"
+	sg "github.com/sebastianring/simulationgame"
+)
+
+// defaultSearchParameters are the parameters sampled or searched if none are
+// given, the ones describing the board and its population.
+var defaultSearchParameters = []string{"rows", "cols", "foods", "creature1", "creature2"}
+
+// runMetrics are the outcomes of a run that can be analysed or optimized.
+var runMetrics = map[string]func(run *simulationRun, t sg.BoardObjectType) float64{
+	"final_population": func(run *simulationRun, t sg.BoardObjectType) float64 {
+		return float64(run.finalPopulation(t))
+	},
+	"area_under_curve": getAreaUnderCurve,
+	"survival_rounds": func(run *simulationRun, t sg.BoardObjectType) float64 {
+		if round, extinct := getExtinctionRound(run, t); extinct {
+			return float64(round - 1)
+		}
+
+		return float64(run.roundsPlayed())
+	},
+	"rounds_played": func(run *simulationRun, t sg.BoardObjectType) float64 {
+		return float64(run.roundsPlayed())
+	},
+}
+
+// getRunMetric function    Returns the metric and creature type with the
+// given names.
+func getRunMetric(metric string, creatureType string) (func(*simulationRun, sg.BoardObjectType) float64, sg.BoardObjectType, error) {
+	f, ok := runMetrics[metric]
+
+	if !ok {
+		return nil, 0, errors.New("Unknown metric: " + metric + ", should be final_population, area_under_curve, survival_rounds or rounds_played.")
+	}
+
+	for _, t := range creatureTypes {
+		if creatureTypeNames[t] == creatureType {
+			return f, t, nil
+		}
+	}
+
+	return nil, 0, errors.New("Unknown creature type: " + creatureType + ", should be creature1 or creature2.")
+}
+
+// parameterBounds is a parameter and the interval it is searched in.
+type parameterBounds struct {
+	Name string `json:"name"`
+	Min  int    `json:"min"`
+	Max  int    `json:"max"`
+}
+
+// getRuleBounds function    Returns the min and max value of a parameter rule,
+// only integer parameters can be sampled.
+func getRuleBounds(name string) (int, int, error) {
+	rule, ok := sc.GetRule(name)
+
+	if !ok {
+		return 0, 0, errors.New("Unknown parameter: " + name)
+	}
+
+	switch min := rule.MinVal.(type) {
+	case int:
+		return min, rule.MaxVal.(int), nil
+	case uint:
+		return int(min), int(rule.MaxVal.(uint)), nil
+	}
+
+	return 0, 0, errors.New("Parameter " + name + " has no interval and can not be sampled.")
+}
+
+// getParameterBounds function    Returns the bounds a parameter is searched
+// in: the range given for it, which has to be inside its rule, or else the
+// interval of random simulations. Small boards with many creatures make the
+// simulation game stall, which is why the full rule is not the default.
+func getParameterBounds(name string, ranges map[string]string) (int, int, error) {
+	ruleMin, ruleMax, err := getRuleBounds(name)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	value, ok := ranges[name]
+
+	if !ok {
+		if min, max, ok := sc.GetStandardInterval(name); ok {
+			return min, max, nil
+		}
+
+		return ruleMin, ruleMax, nil
+	}
+
+	bounds := strings.Split(value, "-")
+	msg := "Invalid range for " + name + ", should be min-max between " + strconv.Itoa(ruleMin) + "-" + strconv.Itoa(ruleMax) + "."
+
+	if len(bounds) != 2 {
+		return 0, 0, errors.New(msg)
+	}
+
+	min, errMin := strconv.Atoi(bounds[0])
+	max, errMax := strconv.Atoi(bounds[1])
+
+	if errMin != nil || errMax != nil || min < ruleMin || max > ruleMax || min > max {
+		return 0, 0, errors.New(msg)
+	}
+
+	return min, max, nil
+}
+
+// getRanges function    Parses the ranges parameter, e.g. rows:20-60,foods:10-50.
+func getRanges(value string) (map[string]string, error) {
+	ranges := map[string]string{}
+
+	if value == "" {
+		return ranges, nil
+	}
+
+	for _, r := range strings.Split(value, ",") {
+		name, bounds, ok := strings.Cut(r, ":")
+
+		if !ok {
+			return nil, errors.New("Invalid range: " + r + ", should be name:min-max.")
+		}
+
+		ranges[name] = bounds
+	}
+
+	return ranges, nil
+}
+
+// runConfigs function    Runs the configs on the shared simulation pool, the
+// run of a failed or nil config is nil. With a seed config i is run with seed
+// plus i through the result cache, so that the runs are reproducible.
+func runConfigs(ctx context.Context, configs []*sg.SimulationConfig, seed *int64) []*simulationRun {
+	jobs := make([]simulationJob, len(configs))
+
+	for i, config := range configs {
+		jobs[i].config = config
+
+		if seed != nil {
+			s := *seed + int64(i)
+			jobs[i].seed = &s
+		}
+	}
+
+	runs := make([]*simulationRun, len(configs))
+
+	for i, outcome := range runJobs(ctx, jobs) {
+		runs[i] = outcome.run
+	}
+
+	return runs
+}
+
+// getParameterSpace function    Returns the bounds of every parameter, a
+// point of the unit hypercube maps to a config with getPointConfig.
+func getParameterSpace(names []string, ranges map[string]string) ([]*parameterBounds, error) {
+	space := []*parameterBounds{}
+	seen := map[string]bool{}
+
+	for _, name := range names {
+		if seen[name] {
+			return nil, errors.New("Parameter " + name + " is given twice.")
+		}
+
+		seen[name] = true
+		min, max, err := getParameterBounds(name, ranges)
+
+		if err != nil {
+			return nil, err
+		}
+
+		space = append(space, &parameterBounds{Name: name, Min: min, Max: max})
+	}
+
+	for name := range ranges {
+		if !seen[name] {
+			return nil, errors.New("Range given for " + name + ", which is not one of the parameters.")
+		}
+	}
+
+	return space, nil
+}
+
+// getPointConfig function    Returns the config of a point in the unit
+// hypercube, every coordinate picks a value of its parameter with the same
+// chance. Other parameters are taken from base.
+func getPointConfig(base url.Values, space []*parameterBounds, point []float64) (*sg.SimulationConfig, error) {
+	values := url.Values{}
+
+	for key, value := range base {
+		values[key] = value
+	}
+
+	for d, p := range space {
+		value := min(p.Max, p.Min+int(point[d]*float64(p.Max-p.Min+1)))
+		values.Set(p.Name, strconv.Itoa(value))
+	}
+
+	return sc.GetSimulationConfigFromUrlValues(values)
+}
@@ -0,0 +1,405 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	sg "github.com/sebastianring/simulationgame"
+)
+
+const defaultQuota = 500_000_000
+
+const defaultQuotaWindow = time.Hour
+
+// routeLimit is a token bucket, rate tokens are added per second up to burst
+// and every request takes one. A rate of 0 turns the limit off.
+type routeLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// defaultRouteLimits are the limits of the routes running simulations, the
+// ones running many simulations per request get fewer requests.
+var defaultRouteLimits = map[string]routeLimit{
+	"/api/new_single_sim":       {Rate: 2, Burst: 20},
+	"/api/new_random_sim":       {Rate: 2, Burst: 20},
+	"/api/chart/new_single_sim": {Rate: 2, Burst: 20},
+	"/api/gif/new_single_sim":   {Rate: 0.5, Burst: 5},
+	"/api/ws/replay":            {Rate: 0.5, Burst: 5},
+	"/ui/run":                   {Rate: 2, Burst: 20},
+	"/api/new_multiple_sim/{iterations:[1-9][0-9]*}":       {Rate: 0.5, Burst: 5},
+	"/api/stream/multiple_sim/{iterations:[1-9][0-9]*}":    {Rate: 0.5, Burst: 5},
+	"/api/chart/new_multiple_sim/{iterations:[1-9][0-9]*}": {Rate: 0.5, Burst: 5},
+	"/api/compare":     {Rate: 0.2, Burst: 3},
+	"/api/experiment":  {Rate: 0.2, Burst: 3},
+	"/api/sensitivity": {Rate: 0.1, Burst: 2},
+	"/api/search":      {Rate: 0.1, Burst: 2},
+	"/api/batch":       {Rate: 0.1, Burst: 2},
+}
+
+// limitConfig is read from the environment: SIM_GAME_RATE_LIMITS is a json
+// object of routeLimit by route, replacing the default limit of the route.
+// SIM_GAME_QUOTA is the number of cells times rounds a caller can simulate
+// every SIM_GAME_QUOTA_WINDOW, 0 turns the quota off.
+type limitConfig struct {
+	routes map[string]routeLimit
+	quota  int64
+	window time.Duration
+}
+
+// getLimitConfig function    Returns the limit config of the environment, an
+// error for a limit of a route that does not run simulations.
+func getLimitConfig() (*limitConfig, error) {
+	config := limitConfig{
+		routes: map[string]routeLimit{},
+		quota:  defaultQuota,
+		window: defaultQuotaWindow,
+	}
+
+	for route, limit := range defaultRouteLimits {
+		config.routes[route] = limit
+	}
+
+	if value := os.Getenv("SIM_GAME_RATE_LIMITS"); value != "" {
+		limits := map[string]routeLimit{}
+
+		if err := json.Unmarshal([]byte(value), &limits); err != nil {
+			return nil, errors.New("Invalid SIM_GAME_RATE_LIMITS: " + err.Error())
+		}
+
+		for route, limit := range limits {
+			if _, ok := defaultRouteLimits[route]; !ok {
+				return nil, errors.New("Invalid SIM_GAME_RATE_LIMITS, " + route + " is not a route running simulations.")
+			}
+
+			if limit.Rate < 0 || limit.Rate > 0 && limit.Burst < 1 {
+				return nil, errors.New("Invalid SIM_GAME_RATE_LIMITS for " + route + ", rate should be positive and burst at least 1.")
+			}
+
+			config.routes[route] = limit
+		}
+	}
+
+	if value := os.Getenv("SIM_GAME_QUOTA"); value != "" {
+		quota, err := strconv.ParseInt(value, 10, 64)
+
+		if err != nil || quota < 0 {
+			return nil, errors.New("Invalid SIM_GAME_QUOTA, should be a number of cells times rounds, 0 turns it off.")
+		}
+
+		config.quota = quota
+	}
+
+	if value := os.Getenv("SIM_GAME_QUOTA_WINDOW"); value != "" {
+		d, err := time.ParseDuration(value)
+
+		if err != nil || d < time.Minute {
+			return nil, errors.New("Invalid SIM_GAME_QUOTA_WINDOW, should be a duration of at least 1m.")
+		}
+
+		config.window = d
+	}
+
+	return &config, nil
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// quotaExceededError is returned for a run that does not fit in what is left
+// of the quota, it is sent as 429 like a request refused by WithRateLimit.
+type quotaExceededError struct {
+	reset time.Duration
+}
+
+const quotaExceededMessage = "Quota of simulated cells times rounds used up, please retry later."
+
+func (e *quotaExceededError) Error() string {
+	return quotaExceededMessage
+}
+
+// callerQuota is the usage of a caller in the current window. Every run
+// reserves the most it can use before it starts, so that neither a request
+// running many simulations nor concurrent requests go over the quota, and
+// settles it with what it used when it is done. requests are the requests
+// in flight holding the quota.
+type callerQuota struct {
+	mu       sync.Mutex
+	quota    int64
+	window   time.Duration
+	used     int64
+	reserved int64
+	requests int
+	start    time.Time
+	now      func() time.Time
+}
+
+// state function    Returns the usage, reservations included, and the time
+// until the window resets, starting a new window when the last one is over.
+// q.mu has to be held.
+func (q *callerQuota) state(now time.Time) (int64, time.Duration) {
+	if now.Sub(q.start) >= q.window {
+		q.start = now
+		q.used = 0
+	}
+
+	return q.used + q.reserved, q.start.Add(q.window).Sub(now)
+}
+
+func (q *callerQuota) getState() (int64, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.state(q.now())
+}
+
+// reserve function    Reserves n of the quota, a *quotaExceededError is
+// returned when it does not fit.
+func (q *callerQuota) reserve(n int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	used, reset := q.state(q.now())
+
+	if used+n > q.quota {
+		return &quotaExceededError{reset: reset}
+	}
+
+	q.reserved += n
+
+	return nil
+}
+
+// settle function    Replaces a reservation with the usage of its run.
+func (q *callerQuota) settle(reserved int64, used int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.reserved -= reserved
+	q.used += used
+}
+
+func (q *callerQuota) hold(requests int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.requests += requests
+}
+
+// idle function    Returns true if nothing is used, reserved or held, the
+// quota is back to its initial state then. q.mu has to be held.
+func (q *callerQuota) idle(now time.Time) bool {
+	used, _ := q.state(now)
+
+	return used == 0 && q.requests == 0
+}
+
+// rateLimiter keeps the buckets and quotas of every caller, both are dropped
+// once they are back to their initial state.
+type rateLimiter struct {
+	mu      sync.Mutex
+	config  *limitConfig
+	buckets map[string]*tokenBucket
+	quotas  map[string]*callerQuota
+	pruned  time.Time
+	now     func() time.Time
+}
+
+func newRateLimiter(config *limitConfig) *rateLimiter {
+	return &rateLimiter{
+		config:  config,
+		buckets: map[string]*tokenBucket{},
+		quotas:  map[string]*callerQuota{},
+		pruned:  time.Now(),
+		now:     time.Now,
+	}
+}
+
+// take function    Takes a token of the bucket of a caller and route, it
+// returns the tokens left and, when there were none, the time until the next
+// one.
+func (l *rateLimiter) take(caller string, route string, limit routeLimit) (int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	key := caller + " " + route
+	bucket, ok := l.buckets[key]
+
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(float64(limit.Burst), bucket.tokens+now.Sub(bucket.last).Seconds()*limit.Rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return 0, time.Duration((1 - bucket.tokens) / limit.Rate * float64(time.Second))
+	}
+
+	bucket.tokens--
+
+	return int(bucket.tokens), 0
+}
+
+func (l *rateLimiter) getQuota(caller string) *callerQuota {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	quota, ok := l.quotas[caller]
+
+	if !ok {
+		quota = &callerQuota{quota: l.config.quota, window: l.config.window, start: l.now(), now: l.now}
+		l.quotas[caller] = quota
+	}
+
+	return quota
+}
+
+// prune function    Drops buckets not used for an hour and quotas whose
+// window is over with nothing reserved or held by a request, at most once a
+// minute. l.mu has to be held.
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < time.Minute {
+		return
+	}
+
+	l.pruned = now
+
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) > time.Hour {
+			delete(l.buckets, key)
+		}
+	}
+
+	for caller, quota := range l.quotas {
+		quota.mu.Lock()
+
+		if quota.idle(now) {
+			delete(l.quotas, caller)
+		}
+
+		quota.mu.Unlock()
+	}
+}
+
+// getCaller function    Returns who the limits of a request are counted for,
+// the subject of its token, e.g. the api key it was issued for, or its ip.
+func getCaller(r *http.Request) string {
+	if claims := getClaims(r); claims != nil && claims.Subject != "" {
+		return "sub:" + claims.Subject
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+type quotaKey struct{}
+
+// reserveQuota function    Reserves the cells times max rounds of a config
+// from the quota of the request running it, if it has one. The returned
+// function settles the reservation with the cells times rounds played of the
+// run, nil for a failed run.
+func reserveQuota(ctx context.Context, config *sg.SimulationConfig) (func(*simulationRun), error) {
+	quota, ok := ctx.Value(quotaKey{}).(*callerQuota)
+
+	if !ok {
+		return func(*simulationRun) {}, nil
+	}
+
+	reserved := int64(config.Rows) * int64(config.Cols) * int64(config.MaxRounds)
+
+	if err := quota.reserve(reserved); err != nil {
+		return nil, err
+	}
+
+	return func(run *simulationRun) {
+		used := int64(0)
+
+		if run != nil {
+			used = int64(config.Rows) * int64(config.Cols) * int64(run.RoundsPlayed)
+		}
+
+		quota.settle(reserved, used)
+	}, nil
+}
+
+func writeTooManyRequests(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	WriteJSON(w, http.StatusTooManyRequests, ApiError{Error: message})
+}
+
+// WithRateLimit function    Middleware limiting the requests to the routes
+// running simulations by caller, 429 with Retry-After is returned when the
+// bucket of the route is empty or the quota is used up. The remaining
+// requests and quota before the request are in the response headers.
+func (s *APIServer) WithRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		template, _ := route.GetPathTemplate()
+
+		if scope := routeScopes[template][r.Method]; scope != ScopeRun {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		caller := getCaller(r)
+
+		if limit, ok := s.limits.config.routes[template]; ok && limit.Rate > 0 {
+			remaining, retryAfter := s.limits.take(caller, template, limit)
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+
+			if retryAfter > 0 {
+				writeTooManyRequests(w, retryAfter, "Rate limit exceeded, please retry later.")
+				return
+			}
+		}
+
+		if s.limits.config.quota == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		quota := s.limits.getQuota(caller)
+		quota.hold(1)
+		defer quota.hold(-1)
+
+		used, reset := quota.getState()
+		w.Header().Set("X-Quota-Limit", strconv.FormatInt(quota.quota, 10))
+		w.Header().Set("X-Quota-Remaining", strconv.FormatInt(max(0, quota.quota-used), 10))
+		w.Header().Set("X-Quota-Reset", strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+
+		if used >= quota.quota {
+			writeTooManyRequests(w, reset, quotaExceededMessage)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), quotaKey{}, quota)))
+	})
+}
@@ -0,0 +1,135 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastianring/simgameserver/api"
+)
+
+func getLimitRouter(t *testing.T, limits string, quota string) *mux.Router {
+	t.Setenv("SIM_GAME_AUTH", "false")
+	t.Setenv("SIM_GAME_DB_PW", "")
+	t.Setenv("SIM_GAME_RATE_LIMITS", limits)
+	t.Setenv("SIM_GAME_QUOTA", quota)
+
+	router, err := api.NewAPIServer(":8080").NewRouter()
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return router
+}
+
+func serveFrom(router *mux.Router, url string, addr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", url, nil)
+	req.RemoteAddr = addr
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestRateLimit(t *testing.T) {
+	router := getLimitRouter(t, `{"/api/new_single_sim": {"rate": 0.001, "burst": 1}}`, "0")
+
+	rr := serveFrom(router, "/api/new_single_sim", "192.0.2.1:1234")
+
+	if rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatal("Expected the first request to pass, got: ", rr.Code, rr.Header(), rr.Body.String())
+	}
+
+	rr = serveFrom(router, "/api/new_single_sim", "192.0.2.1:5678")
+
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Error("Expected the second request to be limited, got: ", rr.Code, rr.Header())
+	}
+
+	if rr := serveFrom(router, "/api/new_single_sim", "192.0.2.2:1234"); rr.Code != http.StatusOK {
+		t.Error("Expected another caller to have its own limit, got: ", rr.Code)
+	}
+
+	if rr := serveFrom(router, "/api/presets", "192.0.2.1:1234"); rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Limit") != "" {
+		t.Error("Expected routes not running simulations to not be limited, got: ", rr.Code)
+	}
+}
+
+func TestRateLimit_Quota(t *testing.T) {
+	router := getLimitRouter(t, `{"/api/new_single_sim": {"rate": 0}}`, "20000")
+
+	// A run of the default 40 x 100 cells and at most 5 rounds reserves all of
+	// the quota.
+	rr := serveFrom(router, "/api/new_single_sim?maxrounds=5", "192.0.2.1:1234")
+
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Quota-Remaining") != "20000" {
+		t.Fatal("Expected the first request to pass, got: ", rr.Code, rr.Header(), rr.Body.String())
+	}
+
+	rr = serveFrom(router, "/api/new_single_sim?maxrounds=5", "192.0.2.1:1234")
+
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Error("Expected the run not fitting in the quota to be refused, got: ", rr.Code, rr.Header())
+	}
+
+	rr = serveFrom(router, "/api/new_single_sim?maxrounds=10", "192.0.2.2:1234")
+
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("X-Quota-Remaining") != "20000" || rr.Header().Get("Retry-After") == "" {
+		t.Error("Expected a run larger than the quota to be refused before it starts, got: ", rr.Code, rr.Header())
+	}
+}
+
+func TestRateLimit_QuotaBatch(t *testing.T) {
+	router := getLimitRouter(t, `{"/api/batch": {"rate": 0}}`, "40000")
+
+	body := `[{"label": "small", "config": {"maxrounds": 5}, "repetitions": 5}]`
+	req := httptest.NewRequest("POST", "/api/batch", strings.NewReader(body))
+	req.RemoteAddr = "192.0.2.1:1234"
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	result := struct {
+		Runs    int `json:"runs"`
+		Failed  int `json:"failed"`
+		Results map[string]struct {
+			Errors []string `json:"errors"`
+		} `json:"results"`
+	}{}
+
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatal("Issue decoding response: ", rr.Code, err.Error())
+	}
+
+	// At most two runs fit in the quota whatever the order they finish in.
+	if result.Runs != 5 || result.Failed < 3 {
+		t.Fatal("Expected the runs over the quota to be refused, got: ", result)
+	}
+
+	for _, err := range result.Results["small"].Errors {
+		if !strings.Contains(err, "Quota") {
+			t.Error("Expected the runs to fail on the quota, got: ", err)
+		}
+	}
+}
+
+func TestRateLimit_Config(t *testing.T) {
+	tests := [][2]string{
+		{`{"/api/presets": {"rate": 1, "burst": 1}}`, ""},
+		{`{"/api/batch": {"rate": 1, "burst": 0}}`, ""},
+		{`not json`, ""},
+		{"", "-1"},
+	}
+
+	for _, test := range tests {
+		t.Setenv("SIM_GAME_RATE_LIMITS", test[0])
+		t.Setenv("SIM_GAME_QUOTA", test[1])
+
+		if _, err := api.NewAPIServer(":8080").NewRouter(); err == nil {
+			t.Error("Expected an error for limits: ", test)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+	"github.com/sebastianring/simgameserver/logging"
+)
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// getRequestID function    Returns the id of the request of a context, empty
+// outside of requests.
+func getRequestID(ctx context.Context) string {
+	return logging.RequestID(ctx)
+}
+
+// WithRequestID function    Middleware giving every request an id, the one in
+// the X-Request-ID header when it has a valid one, e.g. from a proxy, or else
+// a new one. The id is sent back in the same header and is on every line
+// logged with the request context.
+func (s *APIServer) WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.NewString()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
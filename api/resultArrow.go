@@ -0,0 +1,179 @@
+package api
+
+import (
+	"io"
+	"sort"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet"
+	"github.com/apache/arrow/go/v14/parquet/compress"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+	sg "github.com/sebastianring/simulationgame"
+)
+
+// roundDataSchema is the columnar schema used for arrow and parquet exports.
+// There is one row per run, round and creature type:
+//
+//	run_id               utf8     id of the board the round data comes from
+//	round                int32    round id, starting at 1
+//	creature_type        utf8     creature type as named by the simulation game
+//	total_creatures      int64    creatures alive at the end of the round
+//	total_speed          float64  sum of the speed of those creatures
+//	average_speed        float64
+//	total_scan_chance    float64  sum of the scan proc chance of those creatures
+//	average_scan_chance  float64
+//	rows                 int32    run config columns, repeated for every row
+//	cols                 int32
+//	foods                int32
+//	creature1            uint32
+//	creature2            uint32
+//	max_rounds           int32
+//
+// Config columns are null when the config of a run is unknown.
+var roundDataSchema = arrow.NewSchema([]arrow.Field{
+	{Name: "run_id", Type: arrow.BinaryTypes.String},
+	{Name: "round", Type: arrow.PrimitiveTypes.Int32},
+	{Name: "creature_type", Type: arrow.BinaryTypes.String},
+	{Name: "total_creatures", Type: arrow.PrimitiveTypes.Int64},
+	{Name: "total_speed", Type: arrow.PrimitiveTypes.Float64},
+	{Name: "average_speed", Type: arrow.PrimitiveTypes.Float64},
+	{Name: "total_scan_chance", Type: arrow.PrimitiveTypes.Float64},
+	{Name: "average_scan_chance", Type: arrow.PrimitiveTypes.Float64},
+	{Name: "rows", Type: arrow.PrimitiveTypes.Int32, Nullable: true},
+	{Name: "cols", Type: arrow.PrimitiveTypes.Int32, Nullable: true},
+	{Name: "foods", Type: arrow.PrimitiveTypes.Int32, Nullable: true},
+	{Name: "creature1", Type: arrow.PrimitiveTypes.Uint32, Nullable: true},
+	{Name: "creature2", Type: arrow.PrimitiveTypes.Uint32, Nullable: true},
+	{Name: "max_rounds", Type: arrow.PrimitiveTypes.Int32, Nullable: true},
+}, nil)
+
+// getRunRecord function    Builds an arrow record with the round data of a run,
+// the caller has to release the record.
+func getRunRecord(run *simulationRun) arrow.Record {
+	b := array.NewRecordBuilder(memory.DefaultAllocator, roundDataSchema)
+	defer b.Release()
+
+	for _, round := range run.Rounds {
+		types := make([]sg.BoardObjectType, 0, len(round.CreatureSummary))
+
+		for t := range round.CreatureSummary {
+			types = append(types, t)
+		}
+
+		sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+		for _, t := range types {
+			summary := round.CreatureSummary[t]
+
+			b.Field(0).(*array.StringBuilder).Append(run.RunID)
+			b.Field(1).(*array.Int32Builder).Append(int32(round.ID))
+			b.Field(2).(*array.StringBuilder).Append(summary.CreatureType)
+			b.Field(3).(*array.Int64Builder).Append(int64(summary.TotalCreatures))
+			b.Field(4).(*array.Float64Builder).Append(summary.TotalSpeed)
+			b.Field(5).(*array.Float64Builder).Append(summary.AverageSpeed)
+			b.Field(6).(*array.Float64Builder).Append(summary.TotalScanChance)
+			b.Field(7).(*array.Float64Builder).Append(summary.AverageScanChance)
+
+			if run.Config == nil {
+				for i := 8; i < len(roundDataSchema.Fields()); i++ {
+					b.Field(i).AppendNull()
+				}
+
+				continue
+			}
+
+			b.Field(8).(*array.Int32Builder).Append(int32(run.Config.Rows))
+			b.Field(9).(*array.Int32Builder).Append(int32(run.Config.Cols))
+			b.Field(10).(*array.Int32Builder).Append(int32(run.Config.Foods))
+			b.Field(11).(*array.Uint32Builder).Append(uint32(run.Config.Creature1))
+			b.Field(12).(*array.Uint32Builder).Append(uint32(run.Config.Creature2))
+			b.Field(13).(*array.Int32Builder).Append(int32(run.Config.MaxRounds))
+		}
+	}
+
+	return b.NewRecord()
+}
+
+// arrowResultWriter writes an arrow ipc stream with one record batch per run.
+type arrowResultWriter struct {
+	w      io.Writer
+	writer *ipc.Writer
+}
+
+func (aw *arrowResultWriter) start() {
+	if aw.writer != nil {
+		return
+	}
+
+	writeHeader(aw.w, FormatArrow)
+	aw.writer = ipc.NewWriter(aw.w, ipc.WithSchema(roundDataSchema))
+}
+
+func (aw *arrowResultWriter) WriteRun(run *simulationRun) error {
+	aw.start()
+
+	rec := getRunRecord(run)
+	defer rec.Release()
+
+	if err := aw.writer.Write(rec); err != nil {
+		return err
+	}
+
+	flush(aw.w)
+
+	return nil
+}
+
+func (aw *arrowResultWriter) Close() error {
+	aw.start()
+
+	return aw.writer.Close()
+}
+
+// parquetResultWriter writes a parquet file with one row group per run, the
+// footer is written by Close so the file is only valid once Close returns.
+type parquetResultWriter struct {
+	w      io.Writer
+	writer *pqarrow.FileWriter
+}
+
+func (pw *parquetResultWriter) start() error {
+	if pw.writer != nil {
+		return nil
+	}
+
+	writeHeader(pw.w, FormatParquet)
+
+	props := parquet.NewWriterProperties(parquet.WithCompression(compress.Codecs.Snappy))
+	writer, err := pqarrow.NewFileWriter(roundDataSchema, pw.w, props, pqarrow.DefaultWriterProps())
+
+	if err != nil {
+		return err
+	}
+
+	pw.writer = writer
+
+	return nil
+}
+
+func (pw *parquetResultWriter) WriteRun(run *simulationRun) error {
+	if err := pw.start(); err != nil {
+		return err
+	}
+
+	rec := getRunRecord(run)
+	defer rec.Release()
+
+	return pw.writer.Write(rec)
+}
+
+func (pw *parquetResultWriter) Close() error {
+	if err := pw.start(); err != nil {
+		return err
+	}
+
+	return pw.writer.Close()
+}
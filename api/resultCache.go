@@ -0,0 +1,378 @@
+package api
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	ldb "github.com/sebastianring/simgameserver/db"
+	sg "github.com/sebastianring/simulationgame"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const engineModule = "github.com/sebastianring/simulationgame"
+
+const defaultResultCacheSize = 256
+
+// engineLock guards the global math/rand source of the simulation game. The
+// game reseeds it from the clock at the start of every run, so a seeded run
+// holds the lock exclusively while all other runs share it. Random configs
+// are drawn from a source of their own in simconfig.
+var engineLock sync.RWMutex
+
+// engineVersion is the version of the simulation game module, part of every
+// cache key since a new engine can give other results for the same seed.
+var engineVersion = getEngineVersion()
+
+func getEngineVersion() string {
+	info, ok := debug.ReadBuildInfo()
+
+	if !ok {
+		return "unknown"
+	}
+
+	for _, dep := range info.Deps {
+		if dep.Path == engineModule {
+			if dep.Replace != nil {
+				return dep.Replace.Path + "@" + dep.Replace.Version
+			}
+
+			return dep.Version
+		}
+	}
+
+	return "unknown"
+}
+
+// cacheKeyInput is what a seeded run depends on, the fields are in a fixed
+// order so the json encoding is canonical. Draw is left out since it only
+// changes how the game is shown.
+type cacheKeyInput struct {
+	Workspace   string `json:"workspace"`
+	Engine      string `json:"engine"`
+	Seed        int64  `json:"seed"`
+	Rows        int    `json:"rows"`
+	Cols        int    `json:"cols"`
+	Foods       int    `json:"foods"`
+	Creature1   uint   `json:"creature1"`
+	Creature2   uint   `json:"creature2"`
+	MaxRounds   int    `json:"max_rounds"`
+	GamelogSize int    `json:"gamelog_size"`
+}
+
+// getCacheKey function    Returns the sha256 hash of a validated config, the
+// seed and the engine version as hex. The workspace is part of it so that a
+// cached run is only returned to the workspace it is stored in.
+func getCacheKey(workspace string, config *sg.SimulationConfig, seed int64) string {
+	input, _ := json.Marshal(cacheKeyInput{
+		Workspace:   workspace,
+		Engine:      engineVersion,
+		Seed:        seed,
+		Rows:        config.Rows,
+		Cols:        config.Cols,
+		Foods:       config.Foods,
+		Creature1:   config.Creature1,
+		Creature2:   config.Creature2,
+		MaxRounds:   config.MaxRounds,
+		GamelogSize: config.GamelogSize,
+	})
+
+	sum := sha256.Sum256(input)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// getConfigHash function    Returns a short hash of a config and the engine
+// version, the same for every run of the config, used to group runs in logs.
+func getConfigHash(config *sg.SimulationConfig) string {
+	return getCacheKey("", config, 0)[:16]
+}
+
+type cacheEntry struct {
+	key string
+	run *simulationRun
+}
+
+// resultCache is a least recently used cache of seeded runs by cache key.
+type resultCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+func newResultCache(capacity int) *resultCache {
+	return &resultCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (c *resultCache) Get(key string) (*simulationRun, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+
+	return element.Value.(*cacheEntry).run, true
+}
+
+// Add function    Adds or replaces a run, evicting the least recently used
+// one when the cache is full.
+func (c *resultCache) Add(key string, run *simulationRun) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.capacity < 1 {
+		return
+	}
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*cacheEntry).run = run
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, run: run})
+
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *resultCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// simulationCache holds the seeded runs, its size is set with
+// SIM_GAME_CACHE_SIZE and 0 turns the in-process cache off.
+var simulationCache = newResultCache(getResultCacheSize())
+
+func getResultCacheSize() int {
+	size, err := strconv.Atoi(os.Getenv("SIM_GAME_CACHE_SIZE"))
+
+	if err != nil || size < 0 {
+		return defaultResultCacheSize
+	}
+
+	return size
+}
+
+// getSeed function    Returns the seed parameter of a query, false if there
+// is none.
+func getSeed(query url.Values) (int64, bool, error) {
+	value := query.Get("seed")
+
+	if value == "" {
+		return 0, false, nil
+	}
+
+	seed, err := strconv.ParseInt(value, 10, 64)
+
+	if err != nil {
+		return 0, false, errors.New("Invalid seed, should be an integer.")
+	}
+
+	return seed, true, nil
+}
+
+// runSeededSimulation function    Runs the game like sg.RunSimulation but with
+// the global rand seeded, so the same config and seed always give the same
+// rounds. The board is not written to the game's own tables.
+func runSeededSimulation(ctx context.Context, config *sg.SimulationConfig, seed int64) (run *simulationRun, err error) {
+	ctx, span := startSimulationSpan(ctx, config)
+	defer endSimulationSpan(span, &run, &err)
+	defer logSimulation(ctx, config, time.Now(), &run, &err)
+	defer recoverSimulation(&err)
+
+	span.SetAttributes(attribute.Int64("sim.seed", seed))
+
+	if err := checkBoardLimits(config); err != nil {
+		return nil, err
+	}
+
+	settle, err := reserveQuota(ctx, config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { settle(run) }()
+
+	engineLock.Lock()
+	defer engineLock.Unlock()
+
+	rand.Seed(seed)
+	board := sg.NewBoard(config)
+
+	for board.GameOn {
+		board.TickFrame()
+	}
+
+	roundData, err := getRoundData(board, AliveAtEnd)
+
+	if err != nil {
+		return nil, err
+	}
+
+	run = &simulationRun{
+		RunID:        board.Id,
+		Config:       config,
+		Rounds:       roundData,
+		RoundsPlayed: getRoundsPlayed(board),
+	}
+
+	return run, nil
+}
+
+// loadCachedRun function    Returns the run stored in the db for a cache key,
+// nil if there is none or no db is configured.
+func loadCachedRun(ctx context.Context, key string) (_ *simulationRun, err error) {
+	if !ldb.IsConfigured() {
+		return nil, nil
+	}
+
+	ctx, span := startDBSpan(ctx, "loadCachedRun")
+	defer endSpan(span, &err)
+
+	db, err := ldb.OpenDbConnection()
+
+	if err != nil {
+		return nil, errors.New("Error connecting to DB: " + err.Error())
+	}
+
+	id, err := ldb.GetCachedRunID(db, key)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return loadRun(ctx, id)
+}
+
+// storeCachedRun function    Stores a seeded run and its cache key in the db,
+// nothing is stored when there is no db configured.
+func storeCachedRun(ctx context.Context, key string, run *simulationRun) (err error) {
+	if !ldb.IsConfigured() {
+		return nil
+	}
+
+	ctx, span := startDBSpan(ctx, "storeCachedRun")
+	defer endSpan(span, &err)
+
+	// Stored right away, not with the batch of the request, since the cache
+	// entry refers to the run.
+	if err := saveRuns(ctx, []*simulationRun{run}); err != nil {
+		return err
+	}
+
+	id, err := uuid.Parse(run.RunID)
+
+	if err != nil {
+		return errors.New("Invalid run id: " + err.Error())
+	}
+
+	db, err := ldb.OpenDbConnection()
+
+	if err != nil {
+		return errors.New("Error connecting to DB: " + err.Error())
+	}
+
+	return ldb.SaveCachedRun(db, key, id)
+}
+
+// getCachedRun function    Returns the run of a config and seed from the
+// in-process cache, then the db, and simulates it only if neither has it.
+func getCachedRun(ctx context.Context, config *sg.SimulationConfig, seed int64) (*simulationRun, error) {
+	key := getCacheKey(getWorkspace(ctx), config, seed)
+
+	if run, ok := simulationCache.Get(key); ok {
+		resultCacheLookups.WithLabelValues("memory_hit").Inc()
+		return run, nil
+	}
+
+	run, err := loadCachedRun(ctx, key)
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Error loading cached run from db", "key", key, "error", err)
+	}
+
+	if run != nil {
+		resultCacheLookups.WithLabelValues("db_hit").Inc()
+	} else {
+		resultCacheLookups.WithLabelValues("miss").Inc()
+		run, err = runSeededSimulation(ctx, config, seed)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := storeCachedRun(ctx, key, run); err != nil {
+			slog.ErrorContext(ctx, "Error storing cached run", "key", key, "error", err)
+		}
+	}
+
+	simulationCache.Add(key, run)
+
+	return run, nil
+}
+
+// getETag function    Returns the strong ETag of a seeded result, variant
+// tells apart the representations of the same run, e.g. json and csv.
+func getETag(ctx context.Context, config *sg.SimulationConfig, seed int64, variant string) string {
+	sum := sha256.Sum256([]byte(getCacheKey(getWorkspace(ctx), config, seed) + "/" + variant))
+
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// checkNotModified function    Sets the ETag header and returns true after
+// writing 304 Not Modified if the request's If-None-Match has the ETag. The
+// ETag only depends on the request, so nothing has to be simulated for it.
+func checkNotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	match := r.Header.Get("If-None-Match")
+
+	if match == "" {
+		return false
+	}
+
+	for _, tag := range strings.Split(match, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+
+		if tag == etag || tag == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,125 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/sebastianring/simgameserver/api"
+	sc "github.com/sebastianring/simgameserver/simconfig"
+)
+
+func getSeededSimulation(t *testing.T, url string, etag string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", url, nil)
+
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	rr := httptest.NewRecorder()
+	s := api.NewAPIServer(":8080")
+
+	if err := s.HandleSingleSimulation(rr, req); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return rr
+}
+
+func TestAPIServer_SeededSimulationCache(t *testing.T) {
+	fmt.Println("Requesting the same seeded simulation twice and revalidating it with its ETag")
+	sc.InitRules()
+
+	first := getSeededSimulation(t, "/api/new_single_sim?seed=42", "")
+	etag := first.Header().Get("ETag")
+
+	if etag == "" {
+		t.Fatal("Expected an ETag for a seeded simulation")
+	}
+
+	second := getSeededSimulation(t, "/api/new_single_sim?seed=42", "")
+
+	if second.Header().Get("ETag") != etag || second.Body.String() != first.Body.String() {
+		t.Error("Expected the same ETag and result from the cache")
+	}
+
+	// The workspace is part of the cache key, so the seed is simulated again
+	// in another one.
+	uncached := serveFrom(getLimitRouter(t, "", "0"), "/api/new_single_sim?seed=42&workspace=uncached", "192.0.2.1:1234")
+
+	if uncached.Code != http.StatusOK || uncached.Body.String() != first.Body.String() {
+		t.Error("Expected the same result for the same seed without the cache, got: ", uncached.Code)
+	}
+
+	notModified := getSeededSimulation(t, "/api/new_single_sim?seed=42", `"other", `+etag)
+
+	if notModified.Code != http.StatusNotModified || notModified.Body.Len() != 0 {
+		t.Error("Expected 304 without a body, got: ", notModified.Code)
+	}
+
+	csv := getSeededSimulation(t, "/api/new_single_sim?seed=42&format=csv", etag)
+
+	if csv.Code != http.StatusOK || csv.Header().Get("ETag") == etag {
+		t.Error("Expected another ETag for another format")
+	}
+
+	other := getSeededSimulation(t, "/api/new_single_sim?seed=43", etag)
+
+	if other.Code != http.StatusOK || other.Header().Get("ETag") == etag {
+		t.Error("Expected another ETag for another seed")
+	}
+
+	unseeded := getSeededSimulation(t, "/api/new_single_sim", "")
+
+	if unseeded.Header().Get("ETag") != "" {
+		t.Error("Expected no ETag for a random simulation")
+	}
+}
+
+func TestAPIServer_InvalidSeed(t *testing.T) {
+	sc.InitRules()
+	req := httptest.NewRequest("GET", "/api/new_single_sim?seed=abc", nil)
+	rr := httptest.NewRecorder()
+	s := api.NewAPIServer(":8080")
+
+	if err := s.HandleSingleSimulation(rr, req); err == nil {
+		t.Error("Expected an error for a seed that is not an integer")
+	}
+}
+
+func TestAPIServer_SeededSimulationUnderLoad(t *testing.T) {
+	fmt.Println("Running a seeded simulation while random simulations draw their configs")
+	router := getLimitRouter(t, "", "0")
+
+	// The workspaces keep the seeded runs out of the cache of each other.
+	serial := serveFrom(router, "/api/new_single_sim?seed=7&workspace=serial", "192.0.2.1:1234")
+
+	if serial.Code != http.StatusOK {
+		t.Fatal("Expected the serial run to pass, got: ", serial.Code, serial.Body.String())
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			serveFrom(router, "/api/new_multiple_sim/5", "192.0.2.2:1234")
+		}()
+	}
+
+	for i := 0; i < 3; i++ {
+		url := "/api/new_single_sim?seed=7&workspace=load-" + strconv.Itoa(i)
+		rr := serveFrom(router, url, "192.0.2.1:1234")
+
+		if rr.Code != http.StatusOK || rr.Body.String() != serial.Body.String() {
+			t.Error("Expected the result of the serial run under load, got: ", rr.Code, rr.Body.String())
+		}
+	}
+
+	wg.Wait()
+}
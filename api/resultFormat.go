@@ -0,0 +1,298 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	sg "github.com/sebastianring/simulationgame"
+)
+
+type ResultFormat string
+
+const (
+	FormatJSON    ResultFormat = "json"
+	FormatCSV     ResultFormat = "csv"
+	FormatNDJSON  ResultFormat = "ndjson"
+	FormatArrow   ResultFormat = "arrow"
+	FormatParquet ResultFormat = "parquet"
+)
+
+var formatContentTypes = map[ResultFormat]string{
+	FormatJSON:    "application/json",
+	FormatCSV:     "text/csv",
+	FormatNDJSON:  "application/x-ndjson",
+	FormatArrow:   "application/vnd.apache.arrow.stream",
+	FormatParquet: "application/vnd.apache.parquet",
+}
+
+var tidyHeader = []string{"run_id", "round", "creature_type", "metric", "value"}
+
+// tidyRow is one observation of round data, the format used by the csv and ndjson
+// outputs: one row per run, round, creature type and metric.
+type tidyRow struct {
+	RunID        string  `json:"run_id"`
+	Round        int     `json:"round"`
+	CreatureType string  `json:"creature_type"`
+	Metric       string  `json:"metric"`
+	Value        float64 `json:"value"`
+}
+
+// resultWriter writes simulation runs to a response as they are completed,
+// Close has to be called when all runs have been written.
+type resultWriter interface {
+	WriteRun(run *simulationRun) error
+	Close() error
+}
+
+// negotiateFormat function    Picks the result format, the format parameter
+// takes precedence over the Accept header, json is the default.
+func negotiateFormat(r *http.Request) (ResultFormat, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		f := ResultFormat(strings.ToLower(format))
+
+		if _, ok := formatContentTypes[f]; !ok {
+			return "", errors.New("Unsupported format: " + format + ", should be one of json, csv, ndjson, arrow or parquet.")
+		}
+
+		return f, nil
+	}
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+
+		if err != nil {
+			continue
+		}
+
+		switch mediaType {
+		case "application/json", "*/*":
+			return FormatJSON, nil
+		case "text/csv":
+			return FormatCSV, nil
+		case "application/x-ndjson", "application/ndjson":
+			return FormatNDJSON, nil
+		case "application/vnd.apache.arrow.stream":
+			return FormatArrow, nil
+		case "application/vnd.apache.parquet", "application/x-parquet":
+			return FormatParquet, nil
+		}
+	}
+
+	return FormatJSON, nil
+}
+
+// newResultWriter function    Returns a resultWriter for the negotiated format.
+// With single set, json output is the rounds of one run instead of a list of runs.
+func newResultWriter(w http.ResponseWriter, r *http.Request, single bool) (resultWriter, error) {
+	format, err := negotiateFormat(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newFormatWriter(w, format, single)
+}
+
+// newFormatWriter function    Returns a resultWriter for a given format, w does
+// not have to be a http.ResponseWriter so that results can be written to files.
+func newFormatWriter(w io.Writer, format ResultFormat, single bool) (resultWriter, error) {
+	switch format {
+	case FormatJSON:
+		return &jsonResultWriter{w: w, single: single}, nil
+	case FormatCSV:
+		return &csvResultWriter{w: w}, nil
+	case FormatNDJSON:
+		return &ndjsonResultWriter{w: w}, nil
+	case FormatArrow:
+		return &arrowResultWriter{w: w}, nil
+	case FormatParquet:
+		return &parquetResultWriter{w: w}, nil
+	}
+
+	return nil, errors.New("Unsupported format: " + string(format))
+}
+
+// writeHeader function    Sets the content type and status when results are
+// written to a http response.
+func writeHeader(w io.Writer, format ResultFormat) {
+	if rw, ok := w.(http.ResponseWriter); ok {
+		rw.Header().Set("Content-Type", formatContentTypes[format])
+		rw.WriteHeader(http.StatusOK)
+	}
+}
+
+// jsonResultWriter buffers all runs since the output is a single json document.
+type jsonResultWriter struct {
+	w      io.Writer
+	single bool
+	runs   [][]*simpleRoundData
+}
+
+func (jw *jsonResultWriter) WriteRun(run *simulationRun) error {
+	jw.runs = append(jw.runs, run.Rounds)
+
+	return nil
+}
+
+func (jw *jsonResultWriter) Close() error {
+	var v any = jw.runs
+
+	if jw.single {
+		if len(jw.runs) == 0 {
+			v = []*simpleRoundData{}
+		} else {
+			v = jw.runs[0]
+		}
+	} else if jw.runs == nil {
+		v = [][]*simpleRoundData{}
+	}
+
+	if rw, ok := jw.w.(http.ResponseWriter); ok {
+		return WriteJSON(rw, http.StatusOK, v)
+	}
+
+	return json.NewEncoder(jw.w).Encode(v)
+}
+
+type csvResultWriter struct {
+	w       io.Writer
+	csv     *csv.Writer
+	started bool
+}
+
+func (cw *csvResultWriter) start() error {
+	if cw.started {
+		return nil
+	}
+
+	cw.started = true
+	writeHeader(cw.w, FormatCSV)
+	cw.csv = csv.NewWriter(cw.w)
+
+	return cw.csv.Write(tidyHeader)
+}
+
+func (cw *csvResultWriter) WriteRun(run *simulationRun) error {
+	if err := cw.start(); err != nil {
+		return err
+	}
+
+	for _, row := range getTidyRows(run) {
+		err := cw.csv.Write([]string{
+			row.RunID,
+			strconv.Itoa(row.Round),
+			row.CreatureType,
+			row.Metric,
+			strconv.FormatFloat(row.Value, 'f', -1, 64),
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.csv.Flush()
+	flush(cw.w)
+
+	return cw.csv.Error()
+}
+
+func (cw *csvResultWriter) Close() error {
+	if err := cw.start(); err != nil {
+		return err
+	}
+
+	cw.csv.Flush()
+
+	return cw.csv.Error()
+}
+
+type ndjsonResultWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (nw *ndjsonResultWriter) start() {
+	if nw.started {
+		return
+	}
+
+	nw.started = true
+	writeHeader(nw.w, FormatNDJSON)
+}
+
+func (nw *ndjsonResultWriter) WriteRun(run *simulationRun) error {
+	nw.start()
+	encoder := json.NewEncoder(nw.w)
+
+	for _, row := range getTidyRows(run) {
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+
+	flush(nw.w)
+
+	return nil
+}
+
+func (nw *ndjsonResultWriter) Close() error {
+	nw.start()
+
+	return nil
+}
+
+func flush(w io.Writer) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// getTidyRows function    Flattens the round data of a run into tidy rows,
+// creature types are sorted to keep the output stable.
+func getTidyRows(run *simulationRun) []tidyRow {
+	rows := []tidyRow{}
+
+	for _, round := range run.Rounds {
+		types := make([]sg.BoardObjectType, 0, len(round.CreatureSummary))
+
+		for t := range round.CreatureSummary {
+			types = append(types, t)
+		}
+
+		sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+		for _, t := range types {
+			summary := round.CreatureSummary[t]
+			metrics := []struct {
+				name  string
+				value float64
+			}{
+				{"total_creatures", float64(summary.TotalCreatures)},
+				{"total_speed", summary.TotalSpeed},
+				{"average_speed", summary.AverageSpeed},
+				{"total_scan_chance", summary.TotalScanChance},
+				{"average_scan_chance", summary.AverageScanChance},
+			}
+
+			for _, m := range metrics {
+				rows = append(rows, tidyRow{
+					RunID:        run.RunID,
+					Round:        round.ID,
+					CreatureType: summary.CreatureType,
+					Metric:       m.name,
+					Value:        m.value,
+				})
+			}
+		}
+	}
+
+	return rows
+}
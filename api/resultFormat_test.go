@@ -0,0 +1,149 @@
+package api_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/sebastianring/simgameserver/api"
+)
+
+func TestAPIServer_SingleSimulationAsCSV(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/new_single_sim?format=csv", nil)
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+	err := s.HandleSingleSimulation(rr, req)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if ct := rr.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Error("Wrong content type: ", ct)
+	}
+
+	records, err := csv.NewReader(rr.Body).ReadAll()
+
+	if err != nil {
+		t.Fatal("Issue reading csv: ", err.Error())
+	}
+
+	if strings.Join(records[0], ",") != "run_id,round,creature_type,metric,value" {
+		t.Error("Unexpected csv header: ", records[0])
+	}
+
+	if len(records) < 2 {
+		t.Error("No rows in csv output")
+	}
+}
+
+func TestAPIServer_SingleSimulationAsNDJSON(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/new_single_sim", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+	err := s.HandleSingleSimulation(rr, req)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	scanner := bufio.NewScanner(rr.Body)
+	lines := 0
+
+	for scanner.Scan() {
+		row := map[string]any{}
+
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatal("Issue decoding ndjson line: ", err.Error())
+		}
+
+		for _, key := range []string{"run_id", "round", "creature_type", "metric", "value"} {
+			if _, ok := row[key]; !ok {
+				t.Error("Missing key in ndjson row: ", key)
+			}
+		}
+
+		lines++
+	}
+
+	if lines == 0 {
+		t.Error("No rows in ndjson output")
+	}
+}
+
+func TestAPIServer_UnsupportedFormat(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/new_single_sim?format=xml", nil)
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+	err := s.HandleSingleSimulation(rr, req)
+
+	if err == nil {
+		t.Error("Expected an error for an unsupported format")
+	}
+}
+
+func TestAPIServer_SingleSimulationAsArrow(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/new_single_sim?format=arrow", nil)
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+	err := s.HandleSingleSimulation(rr, req)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	reader, err := ipc.NewReader(rr.Body)
+
+	if err != nil {
+		t.Fatal("Issue reading arrow stream: ", err.Error())
+	}
+
+	defer reader.Release()
+
+	if reader.Schema().Field(0).Name != "run_id" {
+		t.Error("Unexpected first column: ", reader.Schema().Field(0).Name)
+	}
+
+	rows := int64(0)
+
+	for reader.Next() {
+		rows += reader.Record().NumRows()
+	}
+
+	if rows == 0 {
+		t.Error("No rows in arrow stream")
+	}
+}
+
+func TestExportRunsAsParquet(t *testing.T) {
+	buf := bytes.Buffer{}
+
+	err := api.ExportRuns(&buf, api.FormatParquet, "default", nil, 2)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	pf, err := file.NewParquetReader(bytes.NewReader(buf.Bytes()))
+
+	if err != nil {
+		t.Fatal("Issue reading parquet file: ", err.Error())
+	}
+
+	defer pf.Close()
+
+	if pf.NumRowGroups() != 2 {
+		t.Error("Expected one row group per run, got: ", pf.NumRowGroups())
+	}
+}
@@ -0,0 +1,416 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	ldb "github.com/sebastianring/simgameserver/db"
+)
+
+// signingKey is one key of the key set, it signs tokens from activeAt until
+// a newer key becomes active and is kept to verify them until they expired.
+type signingKey struct {
+	kid      string
+	private  crypto.Signer
+	created  time.Time
+	activeAt time.Time
+}
+
+// keySet holds the asymmetric keys tokens are signed with. A new key is made
+// every rotation and published ahead of time, so that services caching the
+// jwks know it before the first token signed with it. Keys are written to dir
+// when there is one, so that a restart keeps the tokens valid.
+type keySet struct {
+	mu       sync.Mutex
+	alg      string
+	dir      string
+	rotation time.Duration
+	ahead    time.Duration
+	tokenTTL time.Duration
+	now      func() time.Time
+	keys     []*signingKey
+}
+
+// jwk is a public key of the jwks document, RFC 7517.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// newKeySet function    Returns a key set for RS256 or EdDSA with the keys in
+// dir, which can be empty to keep them in memory only.
+func newKeySet(alg string, dir string, rotation time.Duration, tokenTTL time.Duration) (*keySet, error) {
+	if alg != "RS256" && alg != "EdDSA" {
+		return nil, errors.New("Unsupported signing algorithm: " + alg + ", should be HS256, RS256 or EdDSA.")
+	}
+
+	ks := keySet{
+		alg:      alg,
+		dir:      dir,
+		rotation: rotation,
+		ahead:    min(time.Hour, rotation/4),
+		tokenTTL: tokenTTL,
+		now:      time.Now,
+	}
+
+	if dir != "" {
+		if err := ks.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if err := ks.maintain(); err != nil {
+		return nil, err
+	}
+
+	return &ks, nil
+}
+
+// load function    Reads the pem files of the key dir, a key is as old as its
+// file.
+func (ks *keySet) load() error {
+	files, err := filepath.Glob(filepath.Join(ks.dir, "*.pem"))
+
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+
+		if err != nil {
+			return err
+		}
+
+		info, err := os.Stat(file)
+
+		if err != nil {
+			return err
+		}
+
+		block, _ := pem.Decode(data)
+
+		if block == nil {
+			return errors.New("No pem block in key file " + file)
+		}
+
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+
+		if err != nil {
+			return errors.New("Invalid key file " + file + ": " + err.Error())
+		}
+
+		signer, ok := private.(crypto.Signer)
+
+		if !ok || getKeyAlg(signer) != ks.alg {
+			slog.Warn("Skipping key file of another algorithm", "file", file)
+			continue
+		}
+
+		created := info.ModTime()
+		ks.keys = append(ks.keys, &signingKey{
+			kid:      strings.TrimSuffix(filepath.Base(file), ".pem"),
+			private:  signer,
+			created:  created,
+			activeAt: created.Add(ks.ahead),
+		})
+	}
+
+	sort.Slice(ks.keys, func(i, j int) bool { return ks.keys[i].created.Before(ks.keys[j].created) })
+
+	return nil
+}
+
+func getKeyAlg(signer crypto.Signer) string {
+	switch signer.(type) {
+	case *rsa.PrivateKey:
+		return "RS256"
+	case ed25519.PrivateKey:
+		return "EdDSA"
+	}
+
+	return ""
+}
+
+// generate function    Makes a new key that becomes active at activeAt.
+func (ks *keySet) generate(activeAt time.Time) (*signingKey, error) {
+	var signer crypto.Signer
+	var err error
+
+	if ks.alg == "RS256" {
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	} else {
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	now := ks.now()
+	key := signingKey{
+		kid:      now.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(id),
+		private:  signer,
+		created:  now,
+		activeAt: activeAt,
+	}
+
+	if ks.dir != "" {
+		der, err := x509.MarshalPKCS8PrivateKey(signer)
+
+		if err != nil {
+			return nil, err
+		}
+
+		file := filepath.Join(ks.dir, key.kid+".pem")
+
+		if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+			return nil, err
+		}
+
+		// The age of a loaded key comes from its file.
+		os.Chtimes(file, now, now)
+	}
+
+	return &key, nil
+}
+
+// maintain function    Makes the first key, publishes the next key when the
+// rotation is due and drops keys whose tokens have all expired. ks.mu has to
+// be held.
+func (ks *keySet) maintain() error {
+	now := ks.now()
+
+	if len(ks.keys) == 0 {
+		key, err := ks.generate(now)
+
+		if err != nil {
+			return err
+		}
+
+		ks.keys = append(ks.keys, key)
+		ks.audit(key)
+	}
+
+	newest := ks.keys[len(ks.keys)-1]
+
+	if !now.Before(newest.activeAt.Add(ks.rotation - ks.ahead)) {
+		key, err := ks.generate(now.Add(ks.ahead))
+
+		if err != nil {
+			return err
+		}
+
+		slog.Info("Rotating signing keys", "next_kid", key.kid, "active_at", key.activeAt)
+		ks.keys = append(ks.keys, key)
+		ks.audit(key)
+	}
+
+	// A key signs until the next key is active, then its tokens have at most
+	// the token ttl left.
+	kept := []*signingKey{}
+
+	for i, key := range ks.keys {
+		if i+1 < len(ks.keys) && now.After(ks.keys[i+1].activeAt.Add(ks.tokenTTL)) {
+			if ks.dir != "" {
+				os.Remove(filepath.Join(ks.dir, key.kid+".pem"))
+			}
+
+			continue
+		}
+
+		kept = append(kept, key)
+	}
+
+	ks.keys = kept
+
+	return nil
+}
+
+// audit function    Appends a new key to the audit log of the default
+// workspace, with the server as the actor. The key is in use already, so a
+// failure to record is logged like a failed rotation.
+func (ks *keySet) audit(key *signingKey) {
+	if !ldb.IsConfigured() {
+		return
+	}
+
+	after, err := json.Marshal(map[string]any{"kid": key.kid, "alg": ks.alg, "active_at": key.activeAt})
+
+	if err == nil {
+		entry := ldb.DBauditEntry{Actor: "server", Workspace: defaultWorkspace, Action: AuditSigningKeyRotate, Target: "signingkey:" + key.kid, After: after}
+		err = saveAuditEntry(&entry)
+	}
+
+	if err != nil {
+		slog.Error("Error recording audit entry", "action", AuditSigningKeyRotate, "target", "signingkey:"+key.kid, "error", err)
+	}
+}
+
+// Rotate function    Runs the rotation every interval, it does not have to
+// run for tokens to be signed since signing keeps the set up to date as well.
+func (ks *keySet) Rotate(interval time.Duration) {
+	for range time.Tick(interval) {
+		ks.mu.Lock()
+
+		if err := ks.maintain(); err != nil {
+			slog.Error("Error rotating signing keys", "error", err)
+		}
+
+		ks.mu.Unlock()
+	}
+}
+
+// current function    Returns the key tokens are signed with now, the newest
+// active key.
+func (ks *keySet) current() (*signingKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if err := ks.maintain(); err != nil {
+		return nil, err
+	}
+
+	now := ks.now()
+	current := ks.keys[0]
+
+	for _, key := range ks.keys {
+		if !key.activeAt.After(now) {
+			current = key
+		}
+	}
+
+	return current, nil
+}
+
+// publicKey function    Returns the public key of a kid, false if the set
+// does not have it.
+func (ks *keySet) publicKey(kid string) (crypto.PublicKey, bool) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	for _, key := range ks.keys {
+		if key.kid == kid {
+			return key.private.Public(), true
+		}
+	}
+
+	return nil, false
+}
+
+func (ks *keySet) signingMethod() jwt.SigningMethod {
+	if ks.alg == "RS256" {
+		return jwt.SigningMethodRS256
+	}
+
+	return jwt.SigningMethodEdDSA
+}
+
+// sign function    Signs the claims with the current key and puts its kid in
+// the header.
+func (ks *keySet) sign(claims jwt.Claims) (string, error) {
+	key, err := ks.current()
+
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(ks.signingMethod(), claims)
+	token.Header["kid"] = key.kid
+
+	return token.SignedString(key.private)
+}
+
+// getJWKS function    Returns the public keys of the set, including the next
+// key that is not active yet.
+func (ks *keySet) getJWKS() (*jwks, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if err := ks.maintain(); err != nil {
+		return nil, err
+	}
+
+	document := jwks{Keys: []jwk{}}
+
+	for _, key := range ks.keys {
+		switch public := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			document.Keys = append(document.Keys, jwk{
+				Kty: "RSA",
+				Kid: key.kid,
+				Use: "sig",
+				Alg: "RS256",
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			document.Keys = append(document.Keys, jwk{
+				Kty: "OKP",
+				Kid: key.kid,
+				Use: "sig",
+				Alg: "EdDSA",
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+
+	return &document, nil
+}
+
+// getJWKS function    Serves the public keys tokens are signed with, so
+// other services can verify them, an empty set when tokens are HMAC signed.
+func (s *APIServer) getJWKS(w http.ResponseWriter, r *http.Request) error {
+	document := &jwks{Keys: []jwk{}}
+
+	if s.auth.keys != nil {
+		var err error
+		document, err = s.auth.keys.getJWKS()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	return WriteJSON(w, http.StatusOK, document)
+}
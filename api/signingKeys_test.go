@@ -0,0 +1,205 @@
+package api_test
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/sebastianring/simgameserver/api"
+)
+
+type testJWKS struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Alg string `json:"alg"`
+		X   string `json:"x"`
+	} `json:"keys"`
+}
+
+func getKeySetRouter(t *testing.T, alg string, dir string) *mux.Router {
+	t.Setenv("SIM_GAME_AUTH", "true")
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("JWT_ALG", alg)
+	t.Setenv("JWT_KEYS_DIR", dir)
+	t.Setenv("SIM_GAME_DB_PW", "")
+
+	router, err := api.NewAPIServer(":8080").NewRouter()
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return router
+}
+
+func getJWKS(t *testing.T, router *mux.Router) testJWKS {
+	rr := serveAuthRequest(router, "GET", "/.well-known/jwks.json", "", nil)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal("Expected the jwks, got: ", rr.Code, rr.Body.String())
+	}
+
+	document := testJWKS{}
+	json.NewDecoder(rr.Body).Decode(&document)
+
+	return document
+}
+
+// getKeyToken function    Returns a token the router issued for a new api
+// key, signed with its key set.
+func getKeyToken(t *testing.T, router *mux.Router) string {
+	admin := map[string]string{"Authorization": "Bearer " + getTestToken(t, getTestClaims("admin"))}
+	rr := serveAuthRequest(router, "POST", "/api/keys", `{"owner": "ci", "scopes": ["sim:read"]}`, admin)
+	created := struct {
+		Key string `json:"key"`
+	}{}
+	json.NewDecoder(rr.Body).Decode(&created)
+
+	rr = serveAuthRequest(router, "POST", "/api/token", "", map[string]string{"X-API-Key": created.Key})
+	token := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	json.NewDecoder(rr.Body).Decode(&token)
+
+	if token.AccessToken == "" {
+		t.Fatal("Expected a token, got: ", rr.Code, rr.Body.String())
+	}
+
+	return token.AccessToken
+}
+
+func getKid(t *testing.T, token string) string {
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	kid, _ := parsed.Header["kid"].(string)
+
+	return kid
+}
+
+func setKeyAge(t *testing.T, dir string, kid string, age time.Duration) {
+	then := time.Now().Add(-age)
+
+	if err := os.Chtimes(filepath.Join(dir, kid+".pem"), then, then); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestSigningKeys_JWKS(t *testing.T) {
+	router := getKeySetRouter(t, "EdDSA", "")
+	token := getKeyToken(t, router)
+	document := getJWKS(t, router)
+
+	if len(document.Keys) != 1 || document.Keys[0].Kty != "OKP" || document.Keys[0].Kid != getKid(t, token) {
+		t.Fatal("Expected the key of the token in the jwks, got: ", document)
+	}
+
+	// Another service only needs the jwks to verify the token.
+	_, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		x, err := base64.RawURLEncoding.DecodeString(document.Keys[0].X)
+
+		return ed25519.PublicKey(x), err
+	}, jwt.WithValidMethods([]string{"EdDSA"}))
+
+	if err != nil {
+		t.Error("Expected the token to verify with the jwks: ", err)
+	}
+
+	bearer := map[string]string{"Authorization": "Bearer " + token}
+
+	if rr := serveAuthRequest(router, "GET", "/api/presets", "", bearer); rr.Code != http.StatusOK {
+		t.Error("Expected the token to be accepted, got: ", rr.Code, rr.Body.String())
+	}
+
+	other := getKeyToken(t, getKeySetRouter(t, "EdDSA", ""))
+
+	if rr := serveAuthRequest(router, "GET", "/api/presets", "", map[string]string{"Authorization": "Bearer " + other}); rr.Code != http.StatusUnauthorized {
+		t.Error("Expected a token of an unknown key to be refused, got: ", rr.Code)
+	}
+}
+
+func TestSigningKeys_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	router := getKeySetRouter(t, "EdDSA", dir)
+	token := getKeyToken(t, router)
+	first := getKid(t, token)
+
+	// A day later the next key is published, but not used yet.
+	setKeyAge(t, dir, first, 25*time.Hour)
+	router = getKeySetRouter(t, "EdDSA", dir)
+	document := getJWKS(t, router)
+
+	if len(document.Keys) != 2 {
+		t.Fatal("Expected the next key to be published, got: ", document)
+	}
+
+	if kid := getKid(t, getKeyToken(t, router)); kid != first {
+		t.Error("Expected the first key to sign until the next one is active, got: ", kid)
+	}
+
+	bearer := map[string]string{"Authorization": "Bearer " + token}
+
+	if rr := serveAuthRequest(router, "GET", "/api/presets", "", bearer); rr.Code != http.StatusOK {
+		t.Error("Expected the token to stay valid after a restart, got: ", rr.Code, rr.Body.String())
+	}
+
+	// Once the tokens of the first key expired it is dropped.
+	next := document.Keys[1].Kid
+	setKeyAge(t, dir, first, 48*time.Hour)
+	setKeyAge(t, dir, next, 2*time.Hour)
+	router = getKeySetRouter(t, "EdDSA", dir)
+	document = getJWKS(t, router)
+
+	if len(document.Keys) != 1 || document.Keys[0].Kid != next {
+		t.Fatal("Expected only the next key to be left, got: ", document)
+	}
+
+	if kid := getKid(t, getKeyToken(t, router)); kid != next {
+		t.Error("Expected the next key to sign, got: ", kid)
+	}
+
+	if rr := serveAuthRequest(router, "GET", "/api/presets", "", bearer); rr.Code != http.StatusUnauthorized {
+		t.Error("Expected a token of a dropped key to be refused, got: ", rr.Code)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, first+".pem")); !os.IsNotExist(err) {
+		t.Error("Expected the file of the dropped key to be removed")
+	}
+}
+
+func TestSigningKeys_Config(t *testing.T) {
+	router := getKeySetRouter(t, "RS256", "")
+
+	if document := getJWKS(t, router); len(document.Keys) != 1 || document.Keys[0].Kty != "RSA" {
+		t.Error("Expected an rsa key, got: ", document)
+	}
+
+	t.Setenv("JWT_SECRET", "")
+
+	if _, err := api.NewAPIServer(":8080").NewRouter(); err != nil {
+		t.Error("Expected a key set to not need a secret: ", err)
+	}
+
+	tests := map[string]string{"JWT_ALG": "none", "JWT_ROTATION": "1m"}
+
+	for key, value := range tests {
+		t.Setenv("JWT_ALG", "EdDSA")
+		t.Setenv("JWT_ROTATION", "")
+		t.Setenv(key, value)
+
+		if _, err := api.NewAPIServer(":8080").NewRouter(); err == nil {
+			t.Error("Expected an error for ", key, "=", value)
+		}
+	}
+}
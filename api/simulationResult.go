@@ -1,10 +1,13 @@
 package api
 
 import (
+	"context"
 	// "encoding/json"
 	"errors"
 	"fmt"
 	sg "github.com/sebastianring/simulationgame"
+	"log/slog"
+	"time"
 )
 
 type RoundDataType byte
@@ -21,7 +24,6 @@ type simpleRoundData struct {
 }
 
 func getRoundData(b *sg.Board, datatype RoundDataType) ([]*simpleRoundData, error) {
-	fmt.Println("Starting to get round data for a specific board.")
 	compiledRounds := []*simpleRoundData{}
 
 	switch datatype {
@@ -61,9 +63,186 @@ func getRoundData(b *sg.Board, datatype RoundDataType) ([]*simpleRoundData, erro
 		}
 
 	default:
-		fmt.Println("Error when trying to get round data - data type does not exist.")
 		return nil, errors.New("Datatype can't be found")
 	}
 
 	return compiledRounds, nil
 }
+
+// simulationRun is a completed run, RoundsPlayed can be larger than the last
+// round in Rounds since rounds without creatures alive at the end have no
+// round data. It is 0 when unknown.
+type simulationRun struct {
+	RunID        string
+	Config       *sg.SimulationConfig
+	Rounds       []*simpleRoundData
+	RoundsPlayed int
+}
+
+// getRoundsPlayed function    Returns the number of rounds that were finished,
+// the board can have an empty round started right before the game ended.
+func getRoundsPlayed(b *sg.Board) int {
+	played := 0
+
+	for _, round := range b.Rounds {
+		if round.CreaturesAliveAtEndSum != nil {
+			played++
+		}
+	}
+
+	return played
+}
+
+// recoverSimulation function    Turns a panic in the simulation game into an
+// error, deferred by everything running simulations since a panic in a handler
+// goroutine would take the whole server down.
+func recoverSimulation(err *error) {
+	if r := recover(); r != nil {
+		slog.Error("Simulation panicked", "panic", r)
+		*err = fmt.Errorf("Simulation failed: %v", r)
+	}
+}
+
+// logSimulation function    Logs one line per simulation with the hash of
+// its config, how long it took and whether it failed, and observes its
+// duration. Deferred before recoverSimulation so that a panic is logged as a
+// failure.
+func logSimulation(ctx context.Context, config *sg.SimulationConfig, started time.Time, run **simulationRun, err *error) {
+	duration := time.Since(started)
+	attrs := []any{"config_hash", getConfigHash(config), "duration", duration}
+
+	if *err != nil {
+		simulationDuration.WithLabelValues(getBoardSizeLabel(config), "error").Observe(duration.Seconds())
+		slog.WarnContext(ctx, "Simulation failed", append(attrs, "outcome", "error", "error", *err)...)
+		return
+	}
+
+	simulationDuration.WithLabelValues(getBoardSizeLabel(config), "ok").Observe(duration.Seconds())
+
+	slog.InfoContext(ctx, "Simulation finished", append(attrs, "outcome", "ok", "run_id", (*run).RunID, "rounds_played", (*run).RoundsPlayed)...)
+}
+
+// runEngine function    Runs sg.RunSimulation sharing engineLock, which is
+// released as soon as the game is over so that storing the run does not hold
+// up seeded runs.
+func runEngine(config *sg.SimulationConfig) (*sg.Board, error) {
+	engineLock.RLock()
+	defer engineLock.RUnlock()
+
+	return sg.RunSimulation(config)
+}
+
+func runSimulation(ctx context.Context, config *sg.SimulationConfig) (run *simulationRun, err error) {
+	ctx, span := startSimulationSpan(ctx, config)
+	defer endSimulationSpan(span, &run, &err)
+	defer logSimulation(ctx, config, time.Now(), &run, &err)
+	defer recoverSimulation(&err)
+
+	settle, err := reserveQuota(ctx, config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { settle(run) }()
+
+	_, engineSpan := tracer.Start(ctx, "sg.RunSimulation")
+	resultBoard, err := runEngine(config)
+	endSpan(engineSpan, &err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, roundSpan := tracer.Start(ctx, "getRoundData")
+	roundData, err := getRoundData(resultBoard, AliveAtEnd)
+	endSpan(roundSpan, &err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	run = &simulationRun{
+		RunID:        resultBoard.Id,
+		Config:       config,
+		Rounds:       roundData,
+		RoundsPlayed: getRoundsPlayed(resultBoard),
+	}
+
+	if err := storeRun(ctx, run); err != nil {
+		slog.ErrorContext(ctx, "Error storing run", "run_id", run.RunID, "error", err)
+	}
+
+	return run, nil
+}
+
+// creatureTypeNames are the names of the creature types, same as the config
+// parameters setting their initial count.
+var creatureTypeNames = map[sg.BoardObjectType]string{
+	sg.Creature1Type: "creature1",
+	sg.Creature2Type: "creature2",
+}
+
+// creatureTypes are the creature types in a stable order.
+var creatureTypes = []sg.BoardObjectType{sg.Creature1Type, sg.Creature2Type}
+
+// finalPopulation function    Returns the number of creatures of a type alive
+// at the end of the last round, rounds where all creatures died are not part
+// of the round data so an extinct type counts as 0.
+func (run *simulationRun) finalPopulation(t sg.BoardObjectType) int {
+	if len(run.Rounds) == 0 || run.roundsPlayed() > run.lastRound() {
+		return 0
+	}
+
+	if summary, ok := run.Rounds[len(run.Rounds)-1].CreatureSummary[t]; ok {
+		return summary.TotalCreatures
+	}
+
+	return 0
+}
+
+// lastRound function    Returns the id of the last round with round data.
+func (run *simulationRun) lastRound() int {
+	if len(run.Rounds) == 0 {
+		return 0
+	}
+
+	return run.Rounds[len(run.Rounds)-1].ID
+}
+
+// roundsPlayed function    Returns the number of rounds played, the last round
+// with round data if it is unknown.
+func (run *simulationRun) roundsPlayed() int {
+	if run.RoundsPlayed > run.lastRound() {
+		return run.RoundsPlayed
+	}
+
+	return run.lastRound()
+}
+
+// populationSeries function    Returns the creatures of a type alive at the end
+// of every round from 1 to length, rounds after the end of the run keep the
+// final population so that runs of different length can be aggregated.
+func (run *simulationRun) populationSeries(t sg.BoardObjectType, length int) []float64 {
+	series := make([]float64, length)
+	byRound := make(map[int]int, len(run.Rounds))
+
+	for _, round := range run.Rounds {
+		if summary, ok := round.CreatureSummary[t]; ok {
+			byRound[round.ID] = summary.TotalCreatures
+		}
+	}
+
+	last := run.lastRound()
+	final := float64(run.finalPopulation(t))
+
+	for i := range series {
+		if i+1 > last {
+			series[i] = final
+		} else {
+			series[i] = float64(byRound[i+1])
+		}
+	}
+
+	return series
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	ldb "github.com/sebastianring/simgameserver/db"
+	sg "github.com/sebastianring/simulationgame"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxStoreBatch is the most runs a storeBatch holds before storing them.
+const maxStoreBatch = 100
+
+type storeBatchKey struct{}
+
+// storeBatch collects the runs of a request running many simulations, so that
+// they are stored together instead of in a transaction each.
+type storeBatch struct {
+	mu   sync.Mutex
+	runs []*simulationRun
+}
+
+// startStoreBatch function    Returns a context whose runs are collected and
+// stored by the returned function, or every maxStoreBatch runs. It is called
+// by everything running many simulations for a request.
+func startStoreBatch(ctx context.Context) (context.Context, func()) {
+	batch := storeBatch{}
+	ctx = context.WithValue(ctx, storeBatchKey{}, &batch)
+
+	return ctx, func() {
+		if err := batch.flush(ctx, 0); err != nil {
+			slog.ErrorContext(ctx, "Error storing runs", "error", err)
+		}
+	}
+}
+
+func (b *storeBatch) add(ctx context.Context, run *simulationRun) error {
+	b.mu.Lock()
+	b.runs = append(b.runs, run)
+	b.mu.Unlock()
+
+	return b.flush(ctx, maxStoreBatch)
+}
+
+// flush function    Stores the runs of the batch if it has at least atLeast of
+// them.
+func (b *storeBatch) flush(ctx context.Context, atLeast int) error {
+	b.mu.Lock()
+
+	if len(b.runs) == 0 || len(b.runs) < atLeast {
+		b.mu.Unlock()
+		return nil
+	}
+
+	runs := b.runs
+	b.runs = nil
+	b.mu.Unlock()
+
+	return saveRuns(ctx, runs)
+}
+
+// storeRun function    Stores the config and round data of a run in the
+// workspace of ctx so it can be exported later, nothing is stored when there
+// is no db configured. A run of a request with a storeBatch is stored with the
+// batch.
+func storeRun(ctx context.Context, run *simulationRun) error {
+	if !ldb.IsConfigured() {
+		return nil
+	}
+
+	if batch, ok := ctx.Value(storeBatchKey{}).(*storeBatch); ok {
+		return batch.add(ctx, run)
+	}
+
+	return saveRuns(ctx, []*simulationRun{run})
+}
+
+// saveRuns function    Stores runs in the workspace of ctx in a single
+// transaction.
+func saveRuns(ctx context.Context, runs []*simulationRun) (err error) {
+	_, span := startDBSpan(ctx, "storeRun")
+	defer endSpan(span, &err)
+
+	span.SetAttributes(attribute.Int("db.runs", len(runs)))
+
+	dbruns := make([]*ldb.DBrun, len(runs))
+	rounds := make([][]ldb.DBroundSummary, len(runs))
+
+	for i, run := range runs {
+		id, err := uuid.Parse(run.RunID)
+
+		if err != nil {
+			return errors.New("Invalid run id: " + err.Error())
+		}
+
+		dbruns[i] = &ldb.DBrun{Id: id, Workspace: getWorkspace(ctx), Config: run.Config, RoundsPlayed: run.RoundsPlayed}
+
+		for _, round := range run.Rounds {
+			for t, summary := range round.CreatureSummary {
+				rounds[i] = append(rounds[i], ldb.DBroundSummary{
+					Round:        round.ID,
+					CreatureType: t,
+					Summary:      *summary,
+				})
+			}
+		}
+	}
+
+	db, err := ldb.OpenDbConnection()
+
+	if err != nil {
+		return errors.New("Error connecting to DB: " + err.Error())
+	}
+
+	return ldb.SaveRuns(db, dbruns, rounds)
+}
+
+// loadRun function    Returns a stored run of the workspace of ctx with its
+// round data, runs of other workspaces are not found.
+func loadRun(ctx context.Context, id string) (_ *simulationRun, err error) {
+	ctx, span := startDBSpan(ctx, "loadRun")
+	defer endSpan(span, &err)
+
+	db, err := ldb.OpenDbConnection()
+
+	if err != nil {
+		return nil, errors.New("Error connecting to DB: " + err.Error())
+	}
+
+	dbrun, rounds, err := ldb.GetRun(db, getWorkspace(ctx), id)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("No stored run with id: " + id)
+	} else if err != nil {
+		return nil, err
+	}
+
+	run := simulationRun{
+		RunID:        dbrun.Id.String(),
+		Config:       dbrun.Config,
+		Rounds:       []*simpleRoundData{},
+		RoundsPlayed: dbrun.RoundsPlayed,
+	}
+
+	for _, r := range rounds {
+		if len(run.Rounds) == 0 || run.Rounds[len(run.Rounds)-1].ID != r.Round {
+			run.Rounds = append(run.Rounds, &simpleRoundData{
+				ID:              r.Round,
+				CreatureSummary: map[sg.BoardObjectType]*sg.CreatureSummary{},
+			})
+		}
+
+		summary := r.Summary
+		run.Rounds[len(run.Rounds)-1].CreatureSummary[r.CreatureType] = &summary
+	}
+
+	return &run, nil
+}
+
+func (s *APIServer) getRoundsFromDb(w http.ResponseWriter, r *http.Request) error {
+	id := mux.Vars(r)["id"]
+
+	if id == "" {
+		return errors.New("No id given, please check parameter id, currently given id: " + id)
+	}
+
+	rw, err := newResultWriter(w, r, true)
+
+	if err != nil {
+		return err
+	}
+
+	run, err := loadRun(r.Context(), id)
+
+	if err != nil {
+		return err
+	}
+
+	if err := rw.WriteRun(run); err != nil {
+		return err
+	}
+
+	return rw.Close()
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+
+	ldb "github.com/sebastianring/simgameserver/db"
+)
+
+// openStoreDB function    Returns the db pool of the stores backed by the db.
+func openStoreDB() (*sql.DB, error) {
+	db, err := ldb.OpenDbConnection()
+
+	if err != nil {
+		return nil, errors.New("Error connecting to DB: " + err.Error())
+	}
+
+	return db, nil
+}
+
+// selectStore function    Returns db when there is a db configured, otherwise
+// memory. Only stores that can do without a db, e.g. for development, have a
+// memory store, and it keeps nothing over a restart.
+func selectStore[T any](db T, memory T) T {
+	if ldb.IsConfigured() {
+		return db
+	}
+
+	return memory
+}
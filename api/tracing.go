@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastianring/simgameserver/redact"
+	sg "github.com/sebastianring/simulationgame"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer makes the spans of the server, it does nothing until setupTracing
+// sets a tracer provider, e.g. for the command line.
+var tracer = otel.Tracer("github.com/sebastianring/simgameserver/api")
+
+// setupTracing function    Sets the tracer provider of OTEL_TRACES_EXPORTER:
+// none (default), console writing spans to stdout, or otlp sending them over
+// http to OTEL_EXPORTER_OTLP_ENDPOINT, or to stdout when there is none set.
+// The returned function flushes the spans left when the server stops.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch name := strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER")); name {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+			slog.Warn("No OTEL_EXPORTER_OTLP_ENDPOINT set, writing spans to stdout")
+			exporter, err = stdouttrace.New(stdouttrace.WithWriter(redact.NewWriter(os.Stdout)))
+		} else {
+			exporter, err = otlptracehttp.New(ctx)
+		}
+	case "console":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(redact.NewWriter(os.Stdout)))
+	default:
+		return nil, errors.New("Unsupported OTEL_TRACES_EXPORTER: " + name + ", should be otlp, console or none.")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Later options override earlier ones, so OTEL_SERVICE_NAME and
+	// OTEL_RESOURCE_ATTRIBUTES can replace the service name.
+	res, err := resource.New(ctx, resource.WithAttributes(semconv.ServiceName("simgameserver")), resource.WithFromEnv(), resource.WithHost())
+
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// getRouteTemplate function    Returns the path template of the route of a
+// request, so that ids do not make a series or span name each.
+func getRouteTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+
+	return "unmatched"
+}
+
+// WithTracing function    Middleware starting the server span of a request,
+// a child of the trace context in the traceparent header when there is one.
+func (s *APIServer) WithTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := getRouteTemplate(r)
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+				attribute.String("request_id", getRequestID(ctx)),
+			))
+		defer span.End()
+
+		recorder := statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(&recorder, r.WithContext(ctx))
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(recorder.status))
+
+		if recorder.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
+
+// endSpan function    Ends a span, marking it failed with the error err
+// points to, deferred with the named error of a function.
+func endSpan(span trace.Span, err *error) {
+	if *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+
+	span.End()
+}
+
+// getConfigAttributes function    Returns the parameters of a config as span
+// attributes.
+func getConfigAttributes(config *sg.SimulationConfig) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("sim.config_hash", getConfigHash(config)),
+		attribute.Int("sim.rows", config.Rows),
+		attribute.Int("sim.cols", config.Cols),
+		attribute.Int("sim.foods", config.Foods),
+		attribute.Int("sim.creature1", int(config.Creature1)),
+		attribute.Int("sim.creature2", int(config.Creature2)),
+		attribute.Int("sim.max_rounds", config.MaxRounds),
+	}
+}
+
+// startSimulationSpan function    Starts the span of one simulation with the
+// parameters of its config.
+func startSimulationSpan(ctx context.Context, config *sg.SimulationConfig) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "simulation", trace.WithAttributes(getConfigAttributes(config)...))
+}
+
+// endSimulationSpan function    Ends the span of a simulation with the rounds
+// played, or the error, of its run.
+func endSimulationSpan(span trace.Span, run **simulationRun, err *error) {
+	if *err == nil && *run != nil {
+		span.SetAttributes(attribute.String("sim.run_id", (*run).RunID), attribute.Int("sim.rounds_played", (*run).RoundsPlayed))
+	}
+
+	endSpan(span, err)
+}
+
+// startDBSpan function    Starts the span of a db operation, e.g. storeRun.
+func startDBSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "db "+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.DBSystemPostgreSQL,
+		semconv.DBOperation(operation),
+	))
+}
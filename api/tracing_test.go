@@ -0,0 +1,77 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	router := getAuthRouter(t)
+	headers := map[string]string{
+		"Authorization": "Bearer " + getTestToken(t, getTestClaims("admin")),
+		"traceparent":   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}
+
+	if rr := serveAuthRequest(router, "GET", "/api/new_single_sim", "", headers); rr.Code != http.StatusOK {
+		t.Fatal("Expected a run, got: ", rr.Code, rr.Body.String())
+	}
+
+	if rr := serveAuthRequest(router, "GET", "/api/new_multiple_sim/3", "", headers); rr.Code != http.StatusOK {
+		t.Fatal("Expected runs, got: ", rr.Code, rr.Body.String())
+	}
+
+	spans := recorder.Ended()
+	names := map[string]int{}
+	parents := map[string]string{}
+
+	for _, span := range spans {
+		if id := span.SpanContext().TraceID().String(); id != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Error("Expected every span in the incoming trace, got: ", span.Name(), id)
+		}
+
+		names[span.Name()]++
+		parents[span.SpanContext().SpanID().String()] = span.Name()
+	}
+
+	for name, count := range map[string]int{
+		"GET /api/new_single_sim":                            1,
+		"GET /api/new_multiple_sim/{iterations:[1-9][0-9]*}": 1,
+		"validate config":                                    1,
+		"iteration":                                          3,
+		"simulation":                                         4,
+		"sg.RunSimulation":                                   4,
+		"getRoundData":                                       4,
+	} {
+		if names[name] != count {
+			t.Error("Expected ", count, " spans named ", name, ", got: ", names[name])
+		}
+	}
+
+	for _, span := range spans {
+		parent := parents[span.Parent().SpanID().String()]
+
+		switch span.Name() {
+		case "GET /api/new_single_sim":
+			if span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+				t.Error("Expected the server span to be a child of the traceparent, got: ", span.Parent().SpanID())
+			}
+		case "iteration":
+			if parent != "GET /api/new_multiple_sim/{iterations:[1-9][0-9]*}" {
+				t.Error("Expected the iterations to be children of the request, got: ", parent)
+			}
+		case "sg.RunSimulation", "getRoundData":
+			if parent != "simulation" {
+				t.Error("Expected the stages to be children of the simulation, got: ", parent)
+			}
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package api
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastianring/simgameserver/chart"
+	ldb "github.com/sebastianring/simgameserver/db"
+	sc "github.com/sebastianring/simgameserver/simconfig"
+	sg "github.com/sebastianring/simulationgame"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+const (
+	historyPageSize  = 25
+	maxUICompareRuns = 6
+)
+
+var uiTemplates = map[string]*template.Template{
+	"index":   parseUITemplate("index.html"),
+	"result":  parseUITemplate("result.html"),
+	"history": parseUITemplate("history.html"),
+	"compare": parseUITemplate("compare.html"),
+}
+
+var parameterLabels = map[string]string{
+	"rows":        "Rows",
+	"cols":        "Cols",
+	"foods":       "Foods",
+	"creature1":   "Creature1",
+	"creature2":   "Creature2",
+	"maxrounds":   "Max rounds",
+	"gamelogsize": "Gamelog size",
+	"draw":        "Draw",
+}
+
+func parseUITemplate(page string) *template.Template {
+	return template.Must(template.ParseFS(templateFS, "templates/layout.html", "templates/"+page))
+}
+
+// uiPage holds the data of every page, each template uses the fields it needs.
+type uiPage struct {
+	Title      string
+	Error      string
+	Fields     []uiField
+	Run        *simulationRun
+	Stored     bool
+	Chart      template.HTML
+	RoundRows  []uiRoundRow
+	Configured bool
+	History    []ldb.DBrun
+	Page       int
+	PrevPage   int
+	NextPage   int
+	HasNext    bool
+	IDs        string
+	Summaries  []uiRunSummary
+}
+
+type uiField struct {
+	Name     string
+	Label    string
+	Hint     string
+	Min      any
+	Max      any
+	Standard any
+	Value    string
+	Checkbox bool
+}
+
+type uiRoundRow struct {
+	Round          int
+	Creature1      int
+	Creature1Speed float64
+	Creature2      int
+	Creature2Speed float64
+}
+
+type uiRunSummary struct {
+	RunID     string
+	Rounds    int
+	Creature1 int
+	Creature2 int
+}
+
+// renderUI function    Renders a page to a buffer first, so a template error
+// does not leave a half written page.
+func renderUI(w http.ResponseWriter, status int, name string, page *uiPage) error {
+	buf := bytes.Buffer{}
+
+	if err := uiTemplates[name].ExecuteTemplate(&buf, "layout", page); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, err := buf.WriteTo(w)
+
+	return err
+}
+
+// getFormFields function    Builds the form fields from the parameter rules,
+// values are the ones submitted if the form is shown again after an error.
+func getFormFields(values url.Values) []uiField {
+	fields := []uiField{}
+
+	for _, name := range sc.ParameterNames {
+		rule, ok := sc.GetRule(name)
+
+		if !ok {
+			continue
+		}
+
+		field := uiField{
+			Name:     name,
+			Label:    parameterLabels[name],
+			Min:      rule.MinVal,
+			Max:      rule.MaxVal,
+			Standard: rule.StandardValue,
+			Value:    values.Get(name),
+		}
+
+		if _, ok := rule.StandardValue.(bool); ok {
+			field.Checkbox = true
+			field.Hint = "Draws the board in the terminal of the server, slows the simulation down."
+		} else {
+			field.Hint = "Between " + toString(rule.MinVal) + "-" + toString(rule.MaxVal) + ", standard " + toString(rule.StandardValue) + "."
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+func toString(v any) string {
+	switch value := v.(type) {
+	case int:
+		return strconv.Itoa(value)
+	case uint:
+		return strconv.FormatUint(uint64(value), 10)
+	case bool:
+		return strconv.FormatBool(value)
+	}
+
+	return ""
+}
+
+// getChartHTML function    Renders a chart as inline svg, so that the pages
+// need neither javascript nor extra requests to show it.
+func getChartHTML(c *chart.LineChart) template.HTML {
+	buf := bytes.Buffer{}
+
+	if err := c.WriteSVG(&buf); err != nil {
+		slog.Error("Error rendering chart", "error", err)
+		return ""
+	}
+
+	return template.HTML(buf.String())
+}
+
+func getUIChartOptions() *chartOptions {
+	return &chartOptions{
+		format: "svg",
+		series: creatureTypes,
+		width:  900,
+		height: 400,
+		theme:  chart.Themes["light"],
+	}
+}
+
+func getRoundRows(run *simulationRun) []uiRoundRow {
+	rows := []uiRoundRow{}
+
+	for _, round := range run.Rounds {
+		row := uiRoundRow{Round: round.ID}
+
+		if summary, ok := round.CreatureSummary[sg.Creature1Type]; ok {
+			row.Creature1 = summary.TotalCreatures
+			row.Creature1Speed = summary.AverageSpeed
+		}
+
+		if summary, ok := round.CreatureSummary[sg.Creature2Type]; ok {
+			row.Creature2 = summary.TotalCreatures
+			row.Creature2Speed = summary.AverageSpeed
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+func getResultPage(run *simulationRun) *uiPage {
+	return &uiPage{
+		Title:     "Simulation result",
+		Run:       run,
+		Stored:    ldb.IsConfigured(),
+		Chart:     getChartHTML(getRunChart(run, getUIChartOptions())),
+		RoundRows: getRoundRows(run),
+	}
+}
+
+func (s *APIServer) getUIIndex(w http.ResponseWriter, r *http.Request) error {
+	page := uiPage{
+		Title:  "New simulation",
+		Fields: getFormFields(url.Values{}),
+	}
+
+	return renderUI(w, http.StatusOK, "index", &page)
+}
+
+func (s *APIServer) getUIRun(w http.ResponseWriter, r *http.Request) error {
+	values := url.Values{}
+
+	// Empty form fields are left out so they get their standard value.
+	for key, value := range r.URL.Query() {
+		if len(value) > 0 && value[0] != "" {
+			values.Set(key, value[0])
+		}
+	}
+
+	config, err := getQueryConfig(r.Context(), values)
+
+	if err == nil {
+		var run *simulationRun
+		run, err = runSimulation(r.Context(), config)
+
+		if err == nil {
+			return renderUI(w, http.StatusOK, "result", getResultPage(run))
+		}
+	}
+
+	page := uiPage{
+		Title:  "New simulation",
+		Error:  err.Error(),
+		Fields: getFormFields(values),
+	}
+
+	return renderUI(w, http.StatusBadRequest, "index", &page)
+}
+
+func (s *APIServer) getUIStoredRun(w http.ResponseWriter, r *http.Request) error {
+	run, err := loadRun(r.Context(), mux.Vars(r)["id"])
+
+	if err != nil {
+		return renderUI(w, http.StatusNotFound, "result", &uiPage{Title: "Simulation result", Error: err.Error()})
+	}
+
+	return renderUI(w, http.StatusOK, "result", getResultPage(run))
+}
+
+func (s *APIServer) getUIHistory(w http.ResponseWriter, r *http.Request) error {
+	page := uiPage{
+		Title:      "Run history",
+		Configured: ldb.IsConfigured(),
+	}
+
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		page.Page = p
+		page.PrevPage = p - 1
+	}
+
+	page.NextPage = page.Page + 1
+
+	if !page.Configured {
+		return renderUI(w, http.StatusOK, "history", &page)
+	}
+
+	db, err := ldb.OpenDbConnection()
+
+	if err != nil {
+		page.Error = "Error connecting to DB: " + err.Error()
+		return renderUI(w, http.StatusInternalServerError, "history", &page)
+	}
+
+	// One more run than shown is fetched to know if there is a next page.
+	runs, err := ldb.ListRuns(db, getWorkspace(r.Context()), historyPageSize+1, page.Page*historyPageSize)
+
+	if err != nil {
+		page.Error = err.Error()
+		return renderUI(w, http.StatusInternalServerError, "history", &page)
+	}
+
+	if len(runs) > historyPageSize {
+		page.HasNext = true
+		runs = runs[:historyPageSize]
+	}
+
+	page.History = runs
+
+	return renderUI(w, http.StatusOK, "history", &page)
+}
+
+// getCompareIDs function    Returns the run ids to compare, given either as
+// several ids parameters from the history form or comma separated.
+func getCompareIDs(r *http.Request) []string {
+	ids := []string{}
+
+	for _, value := range r.URL.Query()["ids"] {
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids
+}
+
+func (s *APIServer) getUICompare(w http.ResponseWriter, r *http.Request) error {
+	ids := getCompareIDs(r)
+	page := uiPage{
+		Title: "Compare runs",
+		IDs:   strings.Join(ids, ","),
+	}
+
+	if len(ids) == 0 {
+		return renderUI(w, http.StatusOK, "compare", &page)
+	}
+
+	if len(ids) > maxUICompareRuns {
+		page.Error = "Too many runs, at most " + strconv.Itoa(maxUICompareRuns) + " runs can be compared."
+		return renderUI(w, http.StatusBadRequest, "compare", &page)
+	}
+
+	runs := []*simulationRun{}
+
+	for _, id := range ids {
+		run, err := loadRun(r.Context(), id)
+
+		if err != nil {
+			page.Error = err.Error()
+			return renderUI(w, http.StatusBadRequest, "compare", &page)
+		}
+
+		runs = append(runs, run)
+	}
+
+	page.Chart = getChartHTML(getCompareChart(runs, getUIChartOptions()))
+
+	for _, run := range runs {
+		page.Summaries = append(page.Summaries, uiRunSummary{
+			RunID:     run.RunID,
+			Rounds:    run.roundsPlayed(),
+			Creature1: run.finalPopulation(sg.Creature1Type),
+			Creature2: run.finalPopulation(sg.Creature2Type),
+		})
+	}
+
+	return renderUI(w, http.StatusOK, "compare", &page)
+}
+
+// getCompareChart function    Returns a chart with one line per run and
+// creature type, runs are told apart by the start of their id.
+func getCompareChart(runs []*simulationRun, options *chartOptions) *chart.LineChart {
+	c := newPopulationChart("Population over time, "+strconv.Itoa(len(runs))+" runs", options)
+
+	for _, run := range runs {
+		for _, t := range options.series {
+			c.Series = append(c.Series, chart.Series{
+				Name:   creatureTypeNames[t] + " " + shortID(run.RunID),
+				Values: run.populationSeries(t, run.roundsPlayed()),
+			})
+		}
+	}
+
+	return c
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+
+	return id
+}
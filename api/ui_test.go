@@ -0,0 +1,64 @@
+package api_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sebastianring/simgameserver/api"
+)
+
+func TestAPIServer_UIIndex(t *testing.T) {
+	req := httptest.NewRequest("GET", "/ui/", nil)
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+
+	if err := s.HandleUIIndex(rr, req); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	body := rr.Body.String()
+
+	for _, name := range []string{"rows", "cols", "foods", "creature1", "creature2", "maxrounds", "gamelogsize", "draw"} {
+		if !strings.Contains(body, `name="`+name+`"`) {
+			t.Error("Missing form field: ", name)
+		}
+	}
+
+	if !strings.Contains(body, `min="5" max="200"`) {
+		t.Error("Missing min and max of rows")
+	}
+}
+
+func TestAPIServer_UIRun(t *testing.T) {
+	req := httptest.NewRequest("GET", "/ui/run?rows=30&cols=&foods=50", nil)
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+
+	if err := s.HandleUIRun(rr, req); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if rr.Code != 200 || !strings.Contains(rr.Body.String(), "<svg") {
+		t.Error("Expected a result page with a chart, got status: ", rr.Code)
+	}
+}
+
+func TestAPIServer_UIRunInvalidConfig(t *testing.T) {
+	req := httptest.NewRequest("GET", "/ui/run?rows=1000", nil)
+	rr := httptest.NewRecorder()
+
+	s := api.NewAPIServer(":8080")
+
+	if err := s.HandleUIRun(rr, req); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	body := rr.Body.String()
+
+	if rr.Code != 400 || !strings.Contains(body, `class="error"`) || !strings.Contains(body, `value="1000"`) {
+		t.Error("Expected the form again with an error and the submitted values, got status: ", rr.Code)
+	}
+}
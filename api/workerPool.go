@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	sg "github.com/sebastianring/simulationgame"
+)
+
+// workerPool runs tasks on a fixed number of goroutines, Submit blocks until
+// a worker is free. waiting and busy are the tasks waiting in Submit and the
+// workers running a task, for the metrics.
+type workerPool struct {
+	tasks   chan func()
+	workers int
+	waiting atomic.Int64
+	busy    atomic.Int64
+}
+
+func newWorkerPool(workers int) *workerPool {
+	p := workerPool{tasks: make(chan func()), workers: max(1, workers)}
+
+	for w := 0; w < p.workers; w++ {
+		go func() {
+			for task := range p.tasks {
+				p.busy.Add(1)
+				task()
+				p.busy.Add(-1)
+			}
+		}()
+	}
+
+	return &p
+}
+
+func (p *workerPool) Submit(task func()) {
+	p.waiting.Add(1)
+	p.tasks <- task
+	p.waiting.Add(-1)
+}
+
+// simulationPool is shared by all requests running many simulations, so that
+// concurrent requests do not run more simulations at once than there are cpus.
+// A task must not submit to the pool itself.
+var simulationPool = newWorkerPool(runtime.NumCPU())
+
+// submitIterations function    Submits task to the shared pool once for every
+// iteration from a goroutine of its own, so that the caller can take the
+// results of the first iterations while the others wait for a worker. No more
+// iterations are submitted once ctx is done. The returned channel is closed
+// when every submitted iteration has returned.
+func submitIterations(ctx context.Context, iterations uint, task func()) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		wg := sync.WaitGroup{}
+
+		for i := uint(0); i < iterations && ctx.Err() == nil; i++ {
+			wg.Add(1)
+			simulationPool.Submit(func() {
+				defer wg.Done()
+				task()
+			})
+		}
+
+		wg.Wait()
+	}()
+
+	return done
+}
+
+// simulationJob is one run of a config, a seeded run goes through the result
+// cache.
+type simulationJob struct {
+	config *sg.SimulationConfig
+	seed   *int64
+}
+
+type simulationOutcome struct {
+	run *simulationRun
+	err error
+}
+
+// runJobs function    Runs the jobs on the shared pool and returns their
+// outcomes in the same order. A job without a config is skipped and has
+// neither a run nor an error.
+func runJobs(ctx context.Context, jobs []simulationJob) []simulationOutcome {
+	ctx, storeRuns := startStoreBatch(ctx)
+	defer storeRuns()
+
+	outcomes := make([]simulationOutcome, len(jobs))
+	wg := sync.WaitGroup{}
+
+	for i := range jobs {
+		if jobs[i].config == nil {
+			continue
+		}
+
+		i := i
+		wg.Add(1)
+		simulationPool.Submit(func() {
+			defer wg.Done()
+
+			if jobs[i].seed != nil {
+				outcomes[i].run, outcomes[i].err = getCachedRun(ctx, jobs[i].config, *jobs[i].seed)
+			} else {
+				outcomes[i].run, outcomes[i].err = runSimulation(ctx, jobs[i].config)
+			}
+		})
+	}
+
+	wg.Wait()
+
+	return outcomes
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+// Roles a caller can have in a workspace, they limit the scopes of its token
+// to the ones of the role within the workspace.
+const (
+	RoleViewer = "viewer"
+	RoleMember = "member"
+	RoleOwner  = "owner"
+)
+
+const defaultWorkspace = "default"
+
+var workspaceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// roleScopes are the scopes a role allows in its workspace.
+var roleScopes = map[string][]string{
+	RoleViewer: {ScopeRead},
+	RoleMember: {ScopeRead, ScopeRun},
+	RoleOwner:  {ScopeRead, ScopeRun, ScopeDelete, ScopeAdmin},
+}
+
+// globalRoutes are not part of any workspace, e.g. managing api keys.
+var globalRoutes = map[string]bool{
+	"/api/keys":       true,
+	"/api/keys/{id}":  true,
+	"/api/workspaces": true,
+	"/api/audit":      true,
+}
+
+type workspaceKey struct{}
+
+// getWorkspace function    Returns the workspace of a request context, the
+// default workspace outside of requests, e.g. for the command line.
+func getWorkspace(ctx context.Context) string {
+	if workspace, ok := ctx.Value(workspaceKey{}).(string); ok {
+		return workspace
+	}
+
+	return defaultWorkspace
+}
+
+// getMemberships function    Returns the roles of a caller by workspace, a
+// token without the workspaces claim is an owner of the default workspace.
+func (c *authClaims) getMemberships() map[string]string {
+	if c.Workspaces == nil {
+		return map[string]string{defaultWorkspace: RoleOwner}
+	}
+
+	return c.Workspaces
+}
+
+func roleAllows(role string, scope string) bool {
+	for _, s := range roleScopes[role] {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateMemberships function    Returns an error for an invalid workspace
+// name or an unknown role.
+func validateMemberships(memberships map[string]string) error {
+	for workspace, role := range memberships {
+		if !workspaceNamePattern.MatchString(workspace) {
+			return errors.New("Invalid workspace name " + workspace + ", should be 1-64 lowercase letters, digits, - or _.")
+		}
+
+		if _, ok := roleScopes[role]; !ok {
+			return errors.New("Unknown role " + role + " in workspace " + workspace + ", should be viewer, member or owner.")
+		}
+	}
+
+	return nil
+}
+
+// getOwnedWorkspaces function    Returns the workspaces the caller of a
+// request is an owner of, nil without auth where every caller owns every
+// workspace.
+func getOwnedWorkspaces(r *http.Request) map[string]bool {
+	claims := getClaims(r)
+
+	if claims == nil {
+		return nil
+	}
+
+	owned := map[string]bool{}
+
+	for workspace, role := range claims.getMemberships() {
+		if role == RoleOwner {
+			owned[workspace] = true
+		}
+	}
+
+	return owned
+}
+
+// ownsMemberships function    Returns whether every workspace of memberships
+// is owned, nil memberships are an owner of the default workspace like a key
+// or token without workspaces.
+func ownsMemberships(owned map[string]bool, memberships map[string]string) bool {
+	if owned == nil {
+		return true
+	}
+
+	if memberships == nil {
+		memberships = map[string]string{defaultWorkspace: RoleOwner}
+	}
+
+	for workspace := range memberships {
+		if !owned[workspace] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// selectWorkspace function    Returns the workspace a request is for, from
+// the X-Workspace header or the workspace parameter, and the role of the
+// caller in it. Without either the only workspace of the caller is used, or
+// the default one. Without auth every caller owns every workspace.
+func selectWorkspace(r *http.Request, claims *authClaims) (string, string, error) {
+	workspace := r.Header.Get("X-Workspace")
+
+	if workspace == "" {
+		workspace = r.URL.Query().Get("workspace")
+	}
+
+	if claims == nil {
+		if workspace == "" {
+			workspace = defaultWorkspace
+		}
+
+		if !workspaceNamePattern.MatchString(workspace) {
+			return "", "", errors.New("Invalid workspace name, should be 1-64 lowercase letters, digits, - or _.")
+		}
+
+		return workspace, RoleOwner, nil
+	}
+
+	memberships := claims.getMemberships()
+
+	if workspace == "" && len(memberships) == 1 {
+		for name := range memberships {
+			workspace = name
+		}
+	} else if workspace == "" {
+		workspace = defaultWorkspace
+	}
+
+	role, ok := memberships[workspace]
+
+	if !ok {
+		return "", "", errors.New("Not a member of workspace " + workspace + ", please choose one with the X-Workspace header.")
+	}
+
+	return workspace, role, nil
+}
+
+// WithWorkspace function    Middleware putting the workspace of every request
+// to a route of a workspace in its context, 403 is returned when the caller
+// is not a member of it or its role does not allow the scope of the route.
+func (s *APIServer) WithWorkspace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		template, _ := route.GetPathTemplate()
+		scopes, ok := routeScopes[template]
+
+		if !ok || globalRoutes[template] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		workspace, role, err := selectWorkspace(r, getClaims(r))
+
+		if err != nil {
+			WriteJSON(w, http.StatusForbidden, ApiError{Error: err.Error()})
+			return
+		}
+
+		if scope, ok := scopes[r.Method]; ok && !roleAllows(role, scope) {
+			WriteJSON(w, http.StatusForbidden, ApiError{Error: "The role " + role + " in workspace " + workspace + " does not allow " + scope + "."})
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), workspaceKey{}, workspace)))
+	})
+}
+
+type workspaceMembership struct {
+	Workspace string `json:"workspace"`
+	Role      string `json:"role"`
+}
+
+// getWorkspaces function    Returns the workspaces of the caller with its role
+// in each of them.
+func (s *APIServer) getWorkspaces(w http.ResponseWriter, r *http.Request) error {
+	memberships := map[string]string{defaultWorkspace: RoleOwner}
+
+	if claims := getClaims(r); claims != nil {
+		memberships = claims.getMemberships()
+	}
+
+	workspaces := []workspaceMembership{}
+
+	for workspace, role := range memberships {
+		workspaces = append(workspaces, workspaceMembership{Workspace: workspace, Role: role})
+	}
+
+	sort.Slice(workspaces, func(i, j int) bool { return workspaces[i].Workspace < workspaces[j].Workspace })
+
+	return WriteJSON(w, http.StatusOK, workspaces)
+}
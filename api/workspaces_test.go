@@ -0,0 +1,163 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func getWorkspaceToken(t *testing.T, scope string, workspaces map[string]string) map[string]string {
+	claims := getTestClaims(scope)
+	claims["workspaces"] = workspaces
+
+	return map[string]string{"Authorization": "Bearer " + getTestToken(t, claims)}
+}
+
+func TestWorkspaces_Presets(t *testing.T) {
+	router := getAuthRouter(t)
+	teamA := getWorkspaceToken(t, "admin", map[string]string{"team-a": "owner"})
+	teamB := getWorkspaceToken(t, "admin", map[string]string{"team-b": "owner"})
+	body := `{"name": "shared-name", "config": {"rows": 40}}`
+
+	if rr := serveAuthRequest(router, "POST", "/api/presets", body, teamA); rr.Code != http.StatusCreated {
+		t.Fatal("Expected the preset to be created, got: ", rr.Code, rr.Body.String())
+	}
+
+	if rr := serveAuthRequest(router, "GET", "/api/presets/shared-name", "", teamB); rr.Code == http.StatusOK {
+		t.Error("Expected the preset of another workspace to not be found")
+	}
+
+	if rr := serveAuthRequest(router, "POST", "/api/presets", body, teamB); rr.Code != http.StatusCreated {
+		t.Error("Expected the same name to be free in another workspace, got: ", rr.Code, rr.Body.String())
+	}
+
+	rr := serveAuthRequest(router, "GET", "/api/presets", "", teamA)
+	presets := []struct {
+		Workspace string `json:"workspace"`
+	}{}
+	json.NewDecoder(rr.Body).Decode(&presets)
+
+	if len(presets) != 1 || presets[0].Workspace != "team-a" {
+		t.Error("Expected only the preset of the workspace, got: ", presets)
+	}
+
+	if rr := serveAuthRequest(router, "DELETE", "/api/presets/shared-name", "", teamB); rr.Code != http.StatusNoContent {
+		t.Fatal("Expected the preset to be deleted, got: ", rr.Code, rr.Body.String())
+	}
+
+	if rr := serveAuthRequest(router, "GET", "/api/presets/shared-name", "", teamA); rr.Code != http.StatusOK {
+		t.Error("Expected the preset of the other workspace to be kept, got: ", rr.Code)
+	}
+}
+
+func TestWorkspaces_Membership(t *testing.T) {
+	router := getAuthRouter(t)
+	viewer := getWorkspaceToken(t, "admin", map[string]string{"team-a": "viewer"})
+	twoTeams := getWorkspaceToken(t, "admin", map[string]string{"team-a": "owner", "team-b": "member"})
+
+	tests := []struct {
+		name      string
+		method    string
+		headers   map[string]string
+		workspace string
+		status    int
+	}{
+		{"viewer reads", "GET", viewer, "", http.StatusOK},
+		{"viewer writes", "POST", viewer, "", http.StatusForbidden},
+		{"not a member", "GET", viewer, "team-b", http.StatusForbidden},
+		{"no workspace chosen", "GET", twoTeams, "", http.StatusForbidden},
+		{"workspace chosen", "GET", twoTeams, "team-b", http.StatusOK},
+		{"member writes", "POST", twoTeams, "team-b", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		headers := map[string]string{"X-Workspace": test.workspace}
+
+		for key, value := range test.headers {
+			headers[key] = value
+		}
+
+		if rr := serveAuthRequest(router, test.method, "/api/presets", "{}", headers); rr.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d: %s", test.name, test.status, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := serveAuthRequest(router, "GET", "/api/workspaces", "", twoTeams)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `{"workspace":"team-b","role":"member"}`) {
+		t.Error("Expected the workspaces of the caller, got: ", rr.Code, rr.Body.String())
+	}
+}
+
+func TestWorkspaces_APIKey(t *testing.T) {
+	router := getAuthRouter(t)
+	admin := getWorkspaceToken(t, "admin", map[string]string{"team-a": "owner"})
+
+	rr := serveAuthRequest(router, "POST", "/api/keys", `{"owner": "team-a", "scopes": ["sim:read"], "workspaces": {"team-a": "viewer"}}`, admin)
+	created := struct {
+		Key string `json:"key"`
+	}{}
+	json.NewDecoder(rr.Body).Decode(&created)
+
+	rr = serveAuthRequest(router, "POST", "/api/token", "", map[string]string{"X-API-Key": created.Key})
+	token := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	json.NewDecoder(rr.Body).Decode(&token)
+	bearer := map[string]string{"Authorization": "Bearer " + token.AccessToken}
+
+	if rr := serveAuthRequest(router, "GET", "/api/presets", "", bearer); rr.Code != http.StatusOK {
+		t.Error("Expected the key to read its workspace, got: ", rr.Code, rr.Body.String())
+	}
+
+	bearer["X-Workspace"] = "default"
+
+	if rr := serveAuthRequest(router, "GET", "/api/presets", "", bearer); rr.Code != http.StatusForbidden {
+		t.Error("Expected the key to not read the default workspace, got: ", rr.Code)
+	}
+
+	for _, workspaces := range []string{`{}`, `{"team-a": "boss"}`, `{"Team A": "owner"}`} {
+		body := `{"owner": "team-a", "scopes": ["sim:read"], "workspaces": ` + workspaces + `}`
+
+		if rr := serveAuthRequest(router, "POST", "/api/keys", body, admin); rr.Code != http.StatusBadRequest {
+			t.Error("Expected an error for workspaces: ", workspaces, rr.Code)
+		}
+	}
+}
+
+func TestWorkspaces_APIKeyOtherWorkspace(t *testing.T) {
+	router := getAuthRouter(t)
+	teamA := getWorkspaceToken(t, "admin", map[string]string{"team-a": "owner", "team-c": "member"})
+	teamB := getWorkspaceToken(t, "admin", map[string]string{"team-b": "owner"})
+
+	for _, workspaces := range []string{`{"team-b": "owner"}`, `{"team-a": "owner", "team-b": "viewer"}`, `{"team-c": "viewer"}`} {
+		body := `{"owner": "team-a", "scopes": ["admin"], "workspaces": ` + workspaces + `}`
+
+		if rr := serveAuthRequest(router, "POST", "/api/keys", body, teamA); rr.Code != http.StatusForbidden {
+			t.Error("Expected a key for a workspace the caller does not own to be refused: ", workspaces, rr.Code)
+		}
+	}
+
+	if rr := serveAuthRequest(router, "POST", "/api/keys", `{"owner": "team-a", "scopes": ["sim:read"]}`, teamA); rr.Code != http.StatusForbidden {
+		t.Error("Expected a key for the default workspace to be refused, got: ", rr.Code)
+	}
+
+	rr := serveAuthRequest(router, "POST", "/api/keys", `{"owner": "team-b", "scopes": ["sim:read"], "workspaces": {"team-b": "viewer"}}`, teamB)
+	created := struct {
+		Id string `json:"id"`
+	}{}
+	json.NewDecoder(rr.Body).Decode(&created)
+
+	if rr := serveAuthRequest(router, "GET", "/api/keys", "", teamA); strings.Contains(rr.Body.String(), created.Id) {
+		t.Error("Expected the keys of other workspaces to not be listed")
+	}
+
+	if rr := serveAuthRequest(router, "DELETE", "/api/keys/"+created.Id, "", teamA); rr.Code != http.StatusBadRequest {
+		t.Error("Expected the key of another workspace to not be found, got: ", rr.Code)
+	}
+
+	if rr := serveAuthRequest(router, "GET", "/api/keys", "", teamB); !strings.Contains(rr.Body.String(), created.Id) {
+		t.Error("Expected the key among the keys of its workspace")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sebastianring/simgameserver/api"
+)
+
+// runAPIKey function    Handles the apikey command, which creates a key in
+// the db, e.g. the first admin key:
+// simgameserver apikey -owner ops -scopes admin -days 30
+// and keys of a team's workspace:
+// simgameserver apikey -owner team-a -scopes sim:run,sim:read -workspaces team-a:member
+func runAPIKey(args []string) error {
+	fs := flag.NewFlagSet("apikey", flag.ExitOnError)
+	owner := fs.String("owner", "", "Team or job the key belongs to")
+	scopes := fs.String("scopes", "", "Comma separated scopes: "+strings.Join(api.Scopes, ", "))
+	workspaces := fs.String("workspaces", "", "Comma separated workspace:role pairs, roles are viewer, member and owner, empty for the default workspace")
+	days := fs.Int("days", 0, "Days until the key expires, 0 for a key that does not expire")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *days < 0 {
+		return errors.New("Invalid days, should be at least 0.")
+	}
+
+	var expiresAt *time.Time
+
+	if *days > 0 {
+		t := time.Now().AddDate(0, 0, *days)
+		expiresAt = &t
+	}
+
+	var memberships map[string]string
+
+	if *workspaces != "" {
+		memberships = map[string]string{}
+
+		for _, pair := range strings.Split(*workspaces, ",") {
+			workspace, role, ok := strings.Cut(pair, ":")
+
+			if !ok {
+				return errors.New("Invalid workspaces, should be workspace:role pairs, e.g. team-a:member.")
+			}
+
+			memberships[workspace] = role
+		}
+	}
+
+	key, err := api.CreateAPIKey(*owner, strings.Split(*scopes, ","), memberships, expiresAt)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(key)
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package chart
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+)
+
+// BarChart is a grouped bar chart, every series has one bar per category.
+type BarChart struct {
+	Title      string
+	YLabel     string
+	Width      int
+	Height     int
+	Theme      Theme
+	Categories []string
+	Series     []Series
+}
+
+func (c *BarChart) asLineChart() *LineChart {
+	return &LineChart{Width: c.Width, Height: c.Height, Theme: c.Theme, Series: c.Series}
+}
+
+func (c *BarChart) validate() error {
+	if err := c.asLineChart().validate(); err != nil {
+		return err
+	}
+
+	for _, s := range c.Series {
+		if len(s.Values) != len(c.Categories) {
+			return errors.New("Every bar chart series needs one value per category.")
+		}
+	}
+
+	return nil
+}
+
+// bar function    Returns the left and right x of bar s of category i.
+func (c *BarChart) bar(i int, s int) (float64, float64) {
+	x0, _, x1, _ := c.asLineChart().plotArea()
+	groupWidth := (x1 - x0) / float64(len(c.Categories))
+	barWidth := groupWidth * 0.8 / float64(len(c.Series))
+	left := x0 + float64(i)*groupWidth + groupWidth*0.1 + float64(s)*barWidth
+
+	return left, left + barWidth
+}
+
+func (c *BarChart) categoryX(i int) float64 {
+	x0, _, x1, _ := c.asLineChart().plotArea()
+
+	return x0 + (float64(i)+0.5)*(x1-x0)/float64(len(c.Categories))
+}
+
+// WriteSVG function    Renders the bar chart as an svg document, negative
+// values are drawn as empty bars.
+func (c *BarChart) WriteSVG(w io.Writer) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	lc := c.asLineChart()
+	bw := bufio.NewWriter(w)
+	maxY := lc.maxY()
+	x0, y0, x1, y1 := lc.plotArea()
+	fg := svgColor(c.Theme.Foreground)
+
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		c.Width, c.Height, c.Width, c.Height)
+	fmt.Fprintf(bw, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", svgColor(c.Theme.Background))
+	fmt.Fprintf(bw, `<text x="%d" y="24" fill="%s" font-size="16">%s</text>`+"\n", marginLeft, fg, html.EscapeString(c.Title))
+
+	for i := 0; i <= 5; i++ {
+		v := maxY * float64(i) / 5
+		y := lc.py(v, maxY)
+		fmt.Fprintf(bw, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`+"\n", x0, y, x1, y, svgColor(c.Theme.Grid))
+		fmt.Fprintf(bw, `<text x="%.1f" y="%.1f" fill="%s" text-anchor="end">%s</text>`+"\n", x0-6, y+4, fg, formatTick(v))
+	}
+
+	for i, category := range c.Categories {
+		fmt.Fprintf(bw, `<text x="%.1f" y="%.1f" fill="%s" text-anchor="middle">%s</text>`+"\n", c.categoryX(i), y1+16, fg, html.EscapeString(category))
+	}
+
+	fmt.Fprintf(bw, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`+"\n", x0, y1, x1, y1, fg)
+	fmt.Fprintf(bw, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`+"\n", x0, y0, x0, y1, fg)
+	fmt.Fprintf(bw, `<text x="%.1f" y="%.1f" fill="%s">%s</text>`+"\n", 8.0, y0-10, fg, html.EscapeString(c.YLabel))
+
+	for si, s := range c.Series {
+		col := svgColor(lc.color(si))
+
+		for i, v := range s.Values {
+			left, right := c.bar(i, si)
+			top := lc.py(v, maxY)
+			fmt.Fprintf(bw, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`+"\n", left, top, right-left, y1-top, col)
+		}
+
+		lx := x1 - 110
+		ly := y0 - 30 + float64(si)*16
+		fmt.Fprintf(bw, `<rect x="%.1f" y="%.1f" width="12" height="12" fill="%s"/>`+"\n", lx, ly-10, col)
+		fmt.Fprintf(bw, `<text x="%.1f" y="%.1f" fill="%s">%s</text>`+"\n", lx+18, ly, fg, html.EscapeString(s.Name))
+	}
+
+	fmt.Fprintln(bw, "</svg>")
+
+	return bw.Flush()
+}
+
+// WritePNG function    Renders the bar chart as a png image.
+func (c *BarChart) WritePNG(w io.Writer) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	lc := c.asLineChart()
+	cv := canvas{img: image.NewRGBA(image.Rect(0, 0, c.Width, c.Height))}
+	draw.Draw(cv.img, cv.img.Bounds(), image.NewUniform(c.Theme.Background), image.Point{}, draw.Src)
+
+	maxY := lc.maxY()
+	x0, y0, x1, y1 := lc.plotArea()
+	fg := c.Theme.Foreground
+
+	cv.text(marginLeft, 24, c.Title, fg, "start")
+
+	for i := 0; i <= 5; i++ {
+		v := maxY * float64(i) / 5
+		y := lc.py(v, maxY)
+		cv.line(x0, y, x1, y, c.Theme.Grid, 1)
+		cv.text(int(x0)-6, int(y)+4, formatTick(v), fg, "end")
+	}
+
+	for i, category := range c.Categories {
+		cv.text(int(c.categoryX(i)), int(y1)+16, category, fg, "middle")
+	}
+
+	cv.line(x0, y1, x1, y1, fg, 1)
+	cv.line(x0, y0, x0, y1, fg, 1)
+	cv.text(8, int(y0)-10, c.YLabel, fg, "start")
+
+	for si, s := range c.Series {
+		col := lc.color(si)
+
+		for i, v := range s.Values {
+			left, right := c.bar(i, si)
+			top := lc.py(v, maxY)
+			rect := image.Rect(int(math.Round(left)), int(math.Round(top)), int(math.Round(right)), int(y1))
+			draw.Draw(cv.img, rect, image.NewUniform(col), image.Point{}, draw.Src)
+		}
+
+		lx := int(x1) - 110
+		ly := int(y0) - 30 + si*16
+		draw.Draw(cv.img, image.Rect(lx, ly-10, lx+12, ly+2), image.NewUniform(col), image.Point{}, draw.Src)
+		cv.text(lx+18, ly, s.Name, fg, "start")
+	}
+
+	return png.Encode(w, cv.img)
+}
@@ -0,0 +1,179 @@
+package chart
+
+import (
+	"errors"
+	"image/color"
+	"math"
+	"strconv"
+)
+
+// Theme holds the colors of a chart, series are colored by their index in
+// the palette.
+type Theme struct {
+	Background color.RGBA
+	Foreground color.RGBA
+	Grid       color.RGBA
+	Palette    []color.RGBA
+}
+
+var Themes = map[string]Theme{
+	"light": {
+		Background: color.RGBA{255, 255, 255, 255},
+		Foreground: color.RGBA{33, 33, 33, 255},
+		Grid:       color.RGBA{224, 224, 224, 255},
+		Palette: []color.RGBA{
+			{23, 139, 163, 255},
+			{214, 39, 40, 255},
+			{44, 160, 44, 255},
+			{148, 103, 189, 255},
+		},
+	},
+	"dark": {
+		Background: color.RGBA{30, 30, 30, 255},
+		Foreground: color.RGBA{230, 230, 230, 255},
+		Grid:       color.RGBA{70, 70, 70, 255},
+		Palette: []color.RGBA{
+			{77, 208, 225, 255},
+			{255, 99, 99, 255},
+			{129, 199, 132, 255},
+			{186, 153, 255, 255},
+		},
+	},
+}
+
+const (
+	marginLeft   = 60
+	marginRight  = 20
+	marginTop    = 50
+	marginBottom = 45
+	bandOpacity  = 0.25
+)
+
+// Series is one line of a chart, Values[i] is the value at x = i+1. Lower and
+// Upper are optional and drawn as a band around the line.
+type Series struct {
+	Name   string
+	Values []float64
+	Lower  []float64
+	Upper  []float64
+}
+
+// LineChart is a chart of one or more series sharing the x axis.
+type LineChart struct {
+	Title  string
+	XLabel string
+	YLabel string
+	Width  int
+	Height int
+	Theme  Theme
+	Series []Series
+}
+
+func (s *Series) hasBand() bool {
+	return len(s.Lower) == len(s.Values) && len(s.Upper) == len(s.Values)
+}
+
+func (c *LineChart) validate() error {
+	if c.Width < marginLeft+marginRight+50 || c.Height < marginTop+marginBottom+50 {
+		return errors.New("Chart is too small to be drawn.")
+	}
+
+	if len(c.Theme.Palette) == 0 {
+		return errors.New("Chart theme has no palette.")
+	}
+
+	return nil
+}
+
+func (c *LineChart) color(i int) color.RGBA {
+	return c.Theme.Palette[i%len(c.Theme.Palette)]
+}
+
+// points function    Returns the number of x values, the longest series.
+func (c *LineChart) points() int {
+	n := 0
+
+	for _, s := range c.Series {
+		if len(s.Values) > n {
+			n = len(s.Values)
+		}
+	}
+
+	return n
+}
+
+// maxY function    Returns the top of the y axis, a rounded value above every
+// value and upper band of all series.
+func (c *LineChart) maxY() float64 {
+	max := 0.0
+
+	for _, s := range c.Series {
+		for i, v := range s.Values {
+			max = math.Max(max, v)
+
+			if s.hasBand() {
+				max = math.Max(max, s.Upper[i])
+			}
+		}
+	}
+
+	return niceCeil(max)
+}
+
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+
+	exp := math.Pow(10, math.Floor(math.Log10(v)))
+
+	for _, m := range []float64{1, 2, 2.5, 5, 10} {
+		if m*exp >= v {
+			return m * exp
+		}
+	}
+
+	return 10 * exp
+}
+
+func (c *LineChart) plotArea() (x0, y0, x1, y1 float64) {
+	return marginLeft, marginTop, float64(c.Width - marginRight), float64(c.Height - marginBottom)
+}
+
+func (c *LineChart) px(i int, n int) float64 {
+	x0, _, x1, _ := c.plotArea()
+
+	if n < 2 {
+		return (x0 + x1) / 2
+	}
+
+	return x0 + float64(i)/float64(n-1)*(x1-x0)
+}
+
+func (c *LineChart) py(v float64, maxY float64) float64 {
+	_, y0, _, y1 := c.plotArea()
+
+	return y1 - math.Max(0, v)/maxY*(y1-y0)
+}
+
+// xTicks function    Returns the indexes of the values to label on the x axis,
+// at most 10 of them.
+func xTicks(n int) []int {
+	step := int(math.Ceil(float64(n) / 10))
+
+	if step < 1 {
+		step = 1
+	}
+
+	ticks := []int{}
+
+	for i := 0; i < n; i += step {
+		ticks = append(ticks, i)
+	}
+
+	return ticks
+}
+
+func formatTick(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
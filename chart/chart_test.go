@@ -0,0 +1,110 @@
+package chart_test
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/sebastianring/simgameserver/chart"
+)
+
+func testChart() *chart.LineChart {
+	return &chart.LineChart{
+		Title:  "Population over time",
+		XLabel: "Round",
+		YLabel: "Creatures",
+		Width:  640,
+		Height: 360,
+		Theme:  chart.Themes["light"],
+		Series: []chart.Series{
+			{Name: "creature1", Values: []float64{10, 12, 15, 9}, Lower: []float64{8, 10, 12, 7}, Upper: []float64{12, 14, 18, 11}},
+			{Name: "creature2 <&>", Values: []float64{10, 8, 4, 0}},
+		},
+	}
+}
+
+func TestWriteSVG(t *testing.T) {
+	fmt.Println("Testing svg chart rendering.")
+	buf := bytes.Buffer{}
+
+	if err := testChart().WriteSVG(&buf); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	svg := buf.String()
+
+	if strings.Count(svg, "<polyline") != 2 || strings.Count(svg, "<polygon") != 1 {
+		t.Error("Expected two lines and one band in svg")
+	}
+
+	if !strings.Contains(svg, "creature2 &lt;&amp;&gt;") {
+		t.Error("Series name was not escaped")
+	}
+}
+
+func TestWritePNG(t *testing.T) {
+	fmt.Println("Testing png chart rendering.")
+	buf := bytes.Buffer{}
+
+	if err := testChart().WritePNG(&buf); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	img, err := png.Decode(&buf)
+
+	if err != nil {
+		t.Fatal("Issue decoding png: ", err.Error())
+	}
+
+	if img.Bounds().Dx() != 640 || img.Bounds().Dy() != 360 {
+		t.Error("Wrong image size: ", img.Bounds())
+	}
+}
+
+func TestTooSmallChart(t *testing.T) {
+	c := testChart()
+	c.Width = 10
+
+	if err := c.WriteSVG(&bytes.Buffer{}); err == nil {
+		t.Error("Expected an error for a too small chart")
+	}
+}
+
+func TestBarChart(t *testing.T) {
+	fmt.Println("Testing bar chart rendering.")
+	c := chart.BarChart{
+		Title:      "Sensitivity",
+		YLabel:     "Index",
+		Width:      640,
+		Height:     360,
+		Theme:      chart.Themes["dark"],
+		Categories: []string{"rows", "cols", "foods"},
+		Series: []chart.Series{
+			{Name: "first order", Values: []float64{0.5, -0.02, 0.2}},
+			{Name: "total", Values: []float64{0.6, 0.01, 0.3}},
+		},
+	}
+
+	buf := bytes.Buffer{}
+
+	if err := c.WriteSVG(&buf); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// One rect for the background and the legend of each series.
+	if strings.Count(buf.String(), "<rect") != 1+2*3+2 {
+		t.Error("Expected one bar per series and category in svg")
+	}
+
+	if err := c.WritePNG(&bytes.Buffer{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	c.Series[0].Values = c.Series[0].Values[:2]
+
+	if err := c.WriteSVG(&bytes.Buffer{}); err == nil {
+		t.Error("Expected an error for a series without a value per category")
+	}
+}
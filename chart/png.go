@@ -0,0 +1,136 @@
+package chart
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// canvas is the raster backend of the png output.
+type canvas struct {
+	img *image.RGBA
+}
+
+func (cv *canvas) blend(x, y int, c color.RGBA, alpha float64) {
+	if !(image.Point{x, y}.In(cv.img.Bounds())) {
+		return
+	}
+
+	dst := cv.img.RGBAAt(x, y)
+	mix := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a)*(1-alpha) + float64(b)*alpha))
+	}
+
+	cv.img.SetRGBA(x, y, color.RGBA{mix(dst.R, c.R), mix(dst.G, c.G), mix(dst.B, c.B), 255})
+}
+
+// line function    Draws a line of the given width by stamping squares along
+// it, good enough for chart lines.
+func (cv *canvas) line(xa, ya, xb, yb float64, c color.RGBA, width int) {
+	steps := int(math.Max(math.Abs(xb-xa), math.Abs(yb-ya))*2) + 1
+
+	for s := 0; s <= steps; s++ {
+		t := float64(s) / float64(steps)
+		x := int(math.Round(xa + (xb-xa)*t))
+		y := int(math.Round(ya + (yb-ya)*t))
+
+		for dx := 0; dx < width; dx++ {
+			for dy := 0; dy < width; dy++ {
+				cv.blend(x+dx-width/2, y+dy-width/2, c, 1)
+			}
+		}
+	}
+}
+
+func (cv *canvas) text(x, y int, s string, c color.RGBA, anchor string) {
+	d := font.Drawer{
+		Dst:  cv.img,
+		Src:  image.NewUniform(c),
+		Face: basicfont.Face7x13,
+	}
+
+	width := d.MeasureString(s).Round()
+
+	switch anchor {
+	case "middle":
+		x -= width / 2
+	case "end":
+		x -= width
+	}
+
+	d.Dot = fixed.P(x, y)
+	d.DrawString(s)
+}
+
+// WritePNG function    Renders the chart as a png image.
+func (c *LineChart) WritePNG(w io.Writer) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	cv := canvas{img: image.NewRGBA(image.Rect(0, 0, c.Width, c.Height))}
+	draw.Draw(cv.img, cv.img.Bounds(), image.NewUniform(c.Theme.Background), image.Point{}, draw.Src)
+
+	n := c.points()
+	maxY := c.maxY()
+	x0, y0, x1, y1 := c.plotArea()
+	fg := c.Theme.Foreground
+
+	cv.text(marginLeft, 24, c.Title, fg, "start")
+
+	for i := 0; i <= 5; i++ {
+		v := maxY * float64(i) / 5
+		y := c.py(v, maxY)
+		cv.line(x0, y, x1, y, c.Theme.Grid, 1)
+		cv.text(int(x0)-6, int(y)+4, formatTick(v), fg, "end")
+	}
+
+	for _, i := range xTicks(n) {
+		cv.text(int(c.px(i, n)), int(y1)+16, formatTick(float64(i+1)), fg, "middle")
+	}
+
+	cv.line(x0, y1, x1, y1, fg, 1)
+	cv.line(x0, y0, x0, y1, fg, 1)
+	cv.text(int((x0+x1)/2), c.Height-8, c.XLabel, fg, "middle")
+	cv.text(8, int(y0)-10, c.YLabel, fg, "start")
+
+	for si, s := range c.Series {
+		col := c.color(si)
+
+		// Bands are filled column by column between the interpolated lower
+		// and upper values, which is simpler than filling a polygon.
+		if s.hasBand() && n > 1 {
+			for i := 0; i < len(s.Values)-1; i++ {
+				xa, xb := c.px(i, n), c.px(i+1, n)
+
+				for x := int(math.Ceil(xa)); x < int(math.Ceil(xb)); x++ {
+					t := (float64(x) - xa) / (xb - xa)
+					top := c.py(s.Upper[i]+(s.Upper[i+1]-s.Upper[i])*t, maxY)
+					bottom := c.py(s.Lower[i]+(s.Lower[i+1]-s.Lower[i])*t, maxY)
+
+					for y := int(math.Round(top)); y <= int(math.Round(bottom)); y++ {
+						cv.blend(x, y, col, bandOpacity)
+					}
+				}
+			}
+		}
+
+		for i := 0; i < len(s.Values)-1; i++ {
+			cv.line(c.px(i, n), c.py(s.Values[i], maxY), c.px(i+1, n), c.py(s.Values[i+1], maxY), col, 2)
+		}
+
+		lx := int(x1) - 110
+		ly := int(y0) - 30 + si*16
+		draw.Draw(cv.img, image.Rect(lx, ly-10, lx+12, ly+2), image.NewUniform(col), image.Point{}, draw.Src)
+		cv.text(lx+18, ly, s.Name, fg, "start")
+	}
+
+	return png.Encode(w, cv.img)
+}
@@ -0,0 +1,86 @@
+package chart
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// WriteSVG function    Renders the chart as an svg document.
+func (c *LineChart) WriteSVG(w io.Writer) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	n := c.points()
+	maxY := c.maxY()
+	x0, y0, x1, y1 := c.plotArea()
+	fg := svgColor(c.Theme.Foreground)
+
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		c.Width, c.Height, c.Width, c.Height)
+	fmt.Fprintf(bw, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", svgColor(c.Theme.Background))
+	fmt.Fprintf(bw, `<text x="%d" y="24" fill="%s" font-size="16">%s</text>`+"\n", marginLeft, fg, html.EscapeString(c.Title))
+
+	for i := 0; i <= 5; i++ {
+		v := maxY * float64(i) / 5
+		y := c.py(v, maxY)
+		fmt.Fprintf(bw, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`+"\n", x0, y, x1, y, svgColor(c.Theme.Grid))
+		fmt.Fprintf(bw, `<text x="%.1f" y="%.1f" fill="%s" text-anchor="end">%s</text>`+"\n", x0-6, y+4, fg, formatTick(v))
+	}
+
+	for _, i := range xTicks(n) {
+		x := c.px(i, n)
+		fmt.Fprintf(bw, `<text x="%.1f" y="%.1f" fill="%s" text-anchor="middle">%d</text>`+"\n", x, y1+16, fg, i+1)
+	}
+
+	fmt.Fprintf(bw, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`+"\n", x0, y1, x1, y1, fg)
+	fmt.Fprintf(bw, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`+"\n", x0, y0, x0, y1, fg)
+	fmt.Fprintf(bw, `<text x="%.1f" y="%d" fill="%s" text-anchor="middle">%s</text>`+"\n", (x0+x1)/2, c.Height-8, fg, html.EscapeString(c.XLabel))
+	fmt.Fprintf(bw, `<text x="%.1f" y="%.1f" fill="%s">%s</text>`+"\n", 8.0, y0-10, fg, html.EscapeString(c.YLabel))
+
+	for si, s := range c.Series {
+		col := svgColor(c.color(si))
+
+		if s.hasBand() {
+			points := []string{}
+
+			for i := range s.Upper {
+				points = append(points, fmt.Sprintf("%.1f,%.1f", c.px(i, n), c.py(s.Upper[i], maxY)))
+			}
+
+			for i := len(s.Lower) - 1; i >= 0; i-- {
+				points = append(points, fmt.Sprintf("%.1f,%.1f", c.px(i, n), c.py(s.Lower[i], maxY)))
+			}
+
+			fmt.Fprintf(bw, `<polygon points="%s" fill="%s" fill-opacity="%s" stroke="none"/>`+"\n",
+				strings.Join(points, " "), col, strconv.FormatFloat(bandOpacity, 'f', -1, 64))
+		}
+
+		points := []string{}
+
+		for i, v := range s.Values {
+			points = append(points, fmt.Sprintf("%.1f,%.1f", c.px(i, n), c.py(v, maxY)))
+		}
+
+		fmt.Fprintf(bw, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`+"\n", strings.Join(points, " "), col)
+
+		lx := x1 - 110
+		ly := y0 - 30 + float64(si)*16
+		fmt.Fprintf(bw, `<rect x="%.1f" y="%.1f" width="12" height="12" fill="%s"/>`+"\n", lx, ly-10, col)
+		fmt.Fprintf(bw, `<text x="%.1f" y="%.1f" fill="%s">%s</text>`+"\n", lx+18, ly, fg, html.EscapeString(s.Name))
+	}
+
+	fmt.Fprintln(bw, "</svg>")
+
+	return bw.Flush()
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DBapiKey is an api key, see schema.sql. Only the sha256 hash of its secret
+// is stored, Workspaces are the roles of the key by workspace, nil for a key
+// of the default workspace only. ExpiresAt is nil for keys that do not expire
+// and RevokedAt is set once the key is revoked.
+type DBapiKey struct {
+	Id         uuid.UUID         `json:"id"`
+	Owner      string            `json:"owner"`
+	Scopes     []string          `json:"scopes"`
+	Workspaces map[string]string `json:"workspaces,omitempty"`
+	Hash       []byte            `json:"-"`
+	ExpiresAt  *time.Time        `json:"expires_at"`
+	CreatedAt  time.Time         `json:"created_at"`
+	RevokedAt  *time.Time        `json:"revoked_at,omitempty"`
+}
+
+// SaveAPIKey function    Stores a new api key and sets its creation time.
+func SaveAPIKey(db *sql.DB, key *DBapiKey) error {
+	var workspaces []byte
+
+	if key.Workspaces != nil {
+		var err error
+		workspaces, err = json.Marshal(key.Workspaces)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	query := "INSERT INTO simulation_game.api_keys (id, owner, scopes, workspaces, hash, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at"
+	err := db.QueryRow(query, key.Id, key.Owner, strings.Join(key.Scopes, " "), workspaces, key.Hash, key.ExpiresAt).Scan(&key.CreatedAt)
+
+	if err != nil {
+		return errors.New("Error writing api key to db: " + err.Error())
+	}
+
+	return nil
+}
+
+func scanAPIKey(row interface{ Scan(...any) error }) (*DBapiKey, error) {
+	key := DBapiKey{}
+	var scopes string
+	var workspaces []byte
+
+	if err := row.Scan(&key.Id, &key.Owner, &scopes, &workspaces, &key.Hash, &key.ExpiresAt, &key.CreatedAt, &key.RevokedAt); err != nil {
+		return nil, err
+	}
+
+	key.Scopes = strings.Fields(scopes)
+
+	if workspaces != nil {
+		if err := json.Unmarshal(workspaces, &key.Workspaces); err != nil {
+			return nil, errors.New("Invalid workspaces of api key " + key.Id.String() + ": " + err.Error())
+		}
+	}
+
+	return &key, nil
+}
+
+// GetAPIKey function    Returns an api key, revoked or not, sql.ErrNoRows is
+// returned if there is no key with the id.
+func GetAPIKey(db *sql.DB, id uuid.UUID) (*DBapiKey, error) {
+	query := "SELECT id, owner, scopes, workspaces, hash, expires_at, created_at, revoked_at FROM simulation_game.api_keys WHERE id = $1"
+
+	return scanAPIKey(db.QueryRow(query, id))
+}
+
+// ListActiveAPIKeys function    Returns the keys that are neither revoked nor
+// expired, newest first.
+func ListActiveAPIKeys(db *sql.DB) ([]*DBapiKey, error) {
+	query := "SELECT id, owner, scopes, workspaces, hash, expires_at, created_at, revoked_at FROM simulation_game.api_keys WHERE revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now()) ORDER BY created_at DESC"
+	rows, err := db.Query(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	keys := []*DBapiKey{}
+
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+
+		if err != nil {
+			return nil, errors.New("Database scan error: " + err.Error())
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey function    Revokes a key, sql.ErrNoRows is returned if there
+// is no key with the id that is not revoked already.
+func RevokeAPIKey(db *sql.DB, id uuid.UUID) error {
+	result, err := db.Exec("UPDATE simulation_game.api_keys SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL", id)
+
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return err
+}
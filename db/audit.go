@@ -0,0 +1,166 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DBauditEntry is one entry of the audit log, see schema.sql. Before and
+// After are json snapshots of the target, nil when it did not exist before or
+// does not exist after the action.
+type DBauditEntry struct {
+	Id        int64           `json:"id"`
+	Time      time.Time       `json:"time"`
+	Actor     string          `json:"actor"`
+	RequestID string          `json:"request_id,omitempty"`
+	Workspace string          `json:"workspace,omitempty"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditFilter selects audit entries, empty fields match every entry. Entries
+// of other workspaces than Workspaces are left out unless it is nil. BeforeID
+// pages back from the entry with that id.
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	Target     string
+	Workspace  string
+	Workspaces []string
+	Since      *time.Time
+	Until      *time.Time
+	BeforeID   int64
+	Limit      int
+}
+
+// SaveAuditEntry function    Appends an entry to the audit log and sets its
+// id and time.
+func SaveAuditEntry(db *sql.DB, entry *DBauditEntry) error {
+	return saveAuditEntry(db, entry)
+}
+
+// saveAuditEntry function    Same as SaveAuditEntry in the transaction of
+// the action it records, so that the action is undone when its entry can not
+// be stored.
+func saveAuditEntry(db interface {
+	QueryRow(query string, args ...any) *sql.Row
+}, entry *DBauditEntry) error {
+	query := "INSERT INTO simulation_game.audit_log (actor, request_id, workspace, action, target, before, after) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, time"
+	err := db.QueryRow(query, entry.Actor, entry.RequestID, entry.Workspace, entry.Action, entry.Target, nullJSON(entry.Before), nullJSON(entry.After)).Scan(&entry.Id, &entry.Time)
+
+	if err != nil {
+		return errors.New("Error writing audit entry to db: " + err.Error())
+	}
+
+	return nil
+}
+
+// saveAuditSnapshot function    Sets a snapshot of the entry to value, once
+// the action made it known, and stores the entry.
+func saveAuditSnapshot(tx *sql.Tx, entry *DBauditEntry, snapshot *json.RawMessage, value any) error {
+	data, err := json.Marshal(value)
+
+	if err != nil {
+		return err
+	}
+
+	*snapshot = data
+
+	return saveAuditEntry(tx, entry)
+}
+
+func nullJSON(value json.RawMessage) any {
+	if value == nil {
+		return nil
+	}
+
+	return []byte(value)
+}
+
+// ListAuditEntries function    Returns the entries selected by the filter,
+// newest first.
+func ListAuditEntries(db *sql.DB, filter *AuditFilter) ([]*DBauditEntry, error) {
+	conditions := []string{}
+	args := []any{}
+
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if filter.Actor != "" {
+		add("actor = ?", filter.Actor)
+	}
+
+	if strings.HasSuffix(filter.Action, ".") {
+		add("starts_with(action, ?)", filter.Action)
+	} else if filter.Action != "" {
+		add("action = ?", filter.Action)
+	}
+
+	if filter.Target != "" {
+		add("target = ?", filter.Target)
+	}
+
+	if filter.Workspace != "" {
+		add("workspace = ?", filter.Workspace)
+	}
+
+	if filter.Workspaces != nil {
+		add("workspace = ANY(?)", pq.Array(filter.Workspaces))
+	}
+
+	if filter.Since != nil {
+		add("time >= ?", *filter.Since)
+	}
+
+	if filter.Until != nil {
+		add("time < ?", *filter.Until)
+	}
+
+	if filter.BeforeID != 0 {
+		add("id < ?", filter.BeforeID)
+	}
+
+	query := "SELECT id, time, actor, request_id, workspace, action, target, before, after FROM simulation_game.audit_log"
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	args = append(args, filter.Limit)
+	query += " ORDER BY id DESC LIMIT $" + strconv.Itoa(len(args))
+	rows, err := db.Query(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	entries := []*DBauditEntry{}
+
+	for rows.Next() {
+		entry := DBauditEntry{}
+		var before, after []byte
+
+		err := rows.Scan(&entry.Id, &entry.Time, &entry.Actor, &entry.RequestID, &entry.Workspace, &entry.Action, &entry.Target, &before, &after)
+
+		if err != nil {
+			return nil, errors.New("Database scan error: " + err.Error())
+		}
+
+		entry.Before, entry.After = before, after
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
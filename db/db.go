@@ -2,60 +2,186 @@ package db
 
 import (
 	"database/sql"
-	"fmt"
+	"errors"
+	"log/slog"
+	"net"
+	"net/url"
 	"os"
+	"strings"
+	"sync"
 
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
+	"github.com/sebastianring/simgameserver/redact"
 )
 
+// dockerSecretFile is where a docker secret named sim_game_db_pw is mounted,
+// it is read when no password is set otherwise.
+const dockerSecretFile = "/run/secrets/sim_game_db_pw"
+
 type DBboard struct {
 	Id   uuid.UUID `json:"id"`
 	Rows int       `json:"rows"`
 	Cols int       `json:"cols"`
 }
 
+// passwordSource is what the db password is read from, it is resolved again
+// only when it changes.
+type passwordSource struct {
+	password string
+	file     string
+	fromEnv  bool
+}
+
+var (
+	passwordMu       sync.Mutex
+	resolvedSource   *passwordSource
+	resolvedPassword string
+	resolvedErr      error
+)
+
+func getPasswordSource() passwordSource {
+	file, fromEnv := os.LookupEnv("SIM_GAME_DB_PW_FILE")
+
+	return passwordSource{password: os.Getenv("SIM_GAME_DB_PW"), file: file, fromEnv: fromEnv}
+}
+
+// readPassword function    Returns the password of a source, empty when
+// there is none.
+func readPassword(source passwordSource) (string, error) {
+	file := source.file
+
+	if source.password != "" {
+		return source.password, nil
+	}
+
+	if !source.fromEnv {
+		file = dockerSecretFile
+	}
+
+	if file == "" {
+		return "", nil
+	}
+
+	data, err := os.ReadFile(file)
+
+	if errors.Is(err, os.ErrNotExist) && !source.fromEnv {
+		return "", nil
+	} else if err != nil {
+		return "", errors.New("Error reading the db password file: " + err.Error())
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// getPassword function    Returns the db password from SIM_GAME_DB_PW, the
+// file in SIM_GAME_DB_PW_FILE or the docker secret, in that order, empty
+// when there is none. It is read once and registered so that it is never
+// logged. A password from a file is exported as SIM_GAME_DB_PW, the only
+// place the simulation game reads it from when it stores boards, which puts
+// it in the environment of the process. One from SIM_GAME_DB_PW is left as
+// it is.
+func getPassword() (string, error) {
+	passwordMu.Lock()
+	defer passwordMu.Unlock()
+
+	source := getPasswordSource()
+
+	if resolvedSource != nil && *resolvedSource == source {
+		return resolvedPassword, resolvedErr
+	}
+
+	password, err := readPassword(source)
+
+	if err == nil && password != source.password {
+		if err := os.Setenv("SIM_GAME_DB_PW", password); err != nil {
+			return "", err
+		}
+
+		source.password = password
+	}
+
+	redact.Register(password)
+	resolvedSource, resolvedPassword, resolvedErr = &source, password, err
+
+	return password, err
+}
+
+// LoadPassword function    Reads the db password, see getPassword, so that
+// the simulation game has it before the first simulation.
+func LoadPassword() error {
+	_, err := getPassword()
+
+	return err
+}
+
+var (
+	poolMu sync.Mutex
+	pool   *sql.DB
+)
+
+// OpenDbConnection function    Returns the connection pool shared by every
+// caller, it is opened and pinged by the first call and must not be closed.
+// A failed open is tried again by the next call.
 func OpenDbConnection() (*sql.DB, error) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+
+	if pool != nil {
+		return pool, nil
+	}
+
+	password, err := getPassword()
+
+	if err != nil {
+		return nil, err
+	}
 
-	prefix := "postgres://"
-	user := "sim_game"
-	password := os.Getenv("SIM_GAME_DB_PW")
-	fmt.Println("Password:", password)
 	adress, hit := os.LookupEnv("SIM_GAME_DB_IP")
 
 	if !hit {
-		fmt.Println("No environment variable set:", adress)
+		slog.Warn("No SIM_GAME_DB_IP set, using the default db address")
 		adress = "5.150.233.156"
 	}
 
-	port := "5432"
-
-	database_url := prefix + user + ":" +
-		password + "@" + adress + ":" +
-		port + "/postgres"
+	databaseURL := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword("sim_game", password),
+		Host:   net.JoinHostPort(adress, "5432"),
+		Path:   "/postgres",
+	}
 
-	fmt.Println("Trying to connect to DB: ", database_url)
+	slog.Debug("Connecting to db", "url", databaseURL.Redacted())
 
-	db, err := sql.Open("postgres", database_url)
+	db, err := sql.Open("postgres", databaseURL.String())
 
 	if err != nil {
-		fmt.Println(err.Error())
-
+		slog.Error("Error opening db", "error", err)
 		return nil, err
-
-	} else {
-		fmt.Println("Database connection secured")
 	}
 
-	fmt.Println("Pinging database")
 	err = db.Ping()
 
 	if err != nil {
-		fmt.Println(err.Error())
+		slog.Error("Error pinging db", "url", databaseURL.Redacted(), "error", err)
+		db.Close()
 		return nil, err
 	}
 
-	fmt.Println("Database pinged!")
+	pool = db
 
 	return db, nil
 }
+
+// PoolStats function    Returns the stats of the connection pool, false if it
+// has not been opened.
+func PoolStats() (sql.DBStats, bool) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+
+	if pool == nil {
+		return sql.DBStats{}, false
+	}
+
+	return pool.Stats(), true
+}
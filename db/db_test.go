@@ -0,0 +1,80 @@
+package db_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ldb "github.com/sebastianring/simgameserver/db"
+	"github.com/sebastianring/simgameserver/redact"
+)
+
+func TestLoadPassword_File(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "db_pw")
+
+	if err := os.WriteFile(file, []byte("file-password-1234\n"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	t.Setenv("SIM_GAME_DB_PW", "")
+	t.Setenv("SIM_GAME_DB_PW_FILE", file)
+
+	if err := ldb.LoadPassword(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// The simulation game only reads the password from the environment.
+	if password := os.Getenv("SIM_GAME_DB_PW"); password != "file-password-1234" {
+		t.Error("Expected the password of the file to be exported, got: ", password)
+	}
+
+	if !ldb.IsConfigured() {
+		t.Error("Expected a db with the password of the file")
+	}
+
+	if line := redact.String("password file-password-1234"); strings.Contains(line, "file-password-1234") {
+		t.Error("Expected the password to be redacted, got: ", line)
+	}
+
+	// The password is read once, a file removed later does not change it.
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if !ldb.IsConfigured() || ldb.LoadPassword() != nil {
+		t.Error("Expected the password to be read once")
+	}
+}
+
+func TestLoadPassword_EnvBeforeFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "db_pw")
+
+	if err := os.WriteFile(file, []byte("file-password-5678\n"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	t.Setenv("SIM_GAME_DB_PW", "env-password-5678")
+	t.Setenv("SIM_GAME_DB_PW_FILE", file)
+
+	if err := ldb.LoadPassword(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if password := os.Getenv("SIM_GAME_DB_PW"); password != "env-password-5678" {
+		t.Error("Expected the password of the environment to be kept, got: ", password)
+	}
+}
+
+func TestLoadPassword_MissingFile(t *testing.T) {
+	t.Setenv("SIM_GAME_DB_PW", "")
+	t.Setenv("SIM_GAME_DB_PW_FILE", filepath.Join(t.TempDir(), "missing"))
+
+	if err := ldb.LoadPassword(); err == nil {
+		t.Error("Expected an error for a password file that does not exist")
+	}
+
+	if os.Getenv("SIM_GAME_DB_PW") != "" {
+		t.Error("Expected no password to be exported")
+	}
+}
@@ -0,0 +1,192 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/sebastianring/simgameserver/simconfig"
+	sg "github.com/sebastianring/simulationgame"
+)
+
+// ErrPresetExists is returned when a preset is created with a name in use.
+var ErrPresetExists = errors.New("A preset with this name already exists.")
+
+// DBpreset is one version of a named config of a workspace, see schema.sql.
+// Intervals are what random runs with the preset are drawn from, nil if it
+// has none.
+type DBpreset struct {
+	Workspace string                        `json:"workspace"`
+	Name      string                        `json:"name"`
+	Version   int                           `json:"version"`
+	Config    *sg.SimulationConfig          `json:"config"`
+	Intervals map[string]simconfig.Interval `json:"intervals,omitempty"`
+	CreatedAt time.Time                     `json:"created_at"`
+}
+
+// SavePreset function    Stores a new version of a preset and sets its
+// version and creation time. A new preset fails with ErrPresetExists if the
+// name is in use, a replaced one with sql.ErrNoRows if it does not exist. The
+// audit entry, if not nil, is stored with the saved version as its after
+// snapshot, and the version is only saved if it is.
+func SavePreset(db *sql.DB, preset *DBpreset, replace bool, audit *DBauditEntry) error {
+	config, err := json.Marshal(preset.Config)
+
+	if err != nil {
+		return err
+	}
+
+	var intervals []byte
+
+	if preset.Intervals != nil {
+		intervals, err = json.Marshal(preset.Intervals)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	latest := 0
+	query := "SELECT COALESCE(MAX(version), 0) FROM simulation_game.presets WHERE workspace = $1 AND name = $2"
+
+	if err := tx.QueryRow(query, preset.Workspace, preset.Name).Scan(&latest); err != nil {
+		return err
+	}
+
+	if !replace && latest > 0 {
+		return ErrPresetExists
+	} else if replace && latest == 0 {
+		return sql.ErrNoRows
+	}
+
+	// Two concurrent saves get the same version, the primary key makes the
+	// second one fail.
+	query = "INSERT INTO simulation_game.presets (workspace, name, version, config, intervals) VALUES ($1, $2, $3, $4, $5) RETURNING created_at"
+	err = tx.QueryRow(query, preset.Workspace, preset.Name, latest+1, config, intervals).Scan(&preset.CreatedAt)
+
+	if err != nil {
+		return errors.New("Error writing preset to db: " + err.Error())
+	}
+
+	preset.Version = latest + 1
+
+	if audit != nil {
+		if err := saveAuditSnapshot(tx, audit, &audit.After, preset); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func scanPreset(row interface{ Scan(...any) error }) (*DBpreset, error) {
+	preset := DBpreset{}
+	var config, intervals []byte
+
+	if err := row.Scan(&preset.Workspace, &preset.Name, &preset.Version, &config, &intervals, &preset.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(config, &preset.Config); err != nil {
+		return nil, errors.New("Invalid config of preset " + preset.Name + ": " + err.Error())
+	}
+
+	if intervals != nil {
+		if err := json.Unmarshal(intervals, &preset.Intervals); err != nil {
+			return nil, errors.New("Invalid intervals of preset " + preset.Name + ": " + err.Error())
+		}
+	}
+
+	return &preset, nil
+}
+
+// GetPreset function    Returns a version of a preset of a workspace, the
+// latest if version is 0. sql.ErrNoRows is returned if there is no such
+// version.
+func GetPreset(db *sql.DB, workspace string, name string, version int) (*DBpreset, error) {
+	query := "SELECT workspace, name, version, config, intervals, created_at FROM simulation_game.presets WHERE workspace = $1 AND name = $2 AND ($3 = 0 OR version = $3) ORDER BY version DESC LIMIT 1"
+
+	return scanPreset(db.QueryRow(query, workspace, name, version))
+}
+
+func queryPresets(db *sql.DB, query string, args ...any) ([]*DBpreset, error) {
+	rows, err := db.Query(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	presets := []*DBpreset{}
+
+	for rows.Next() {
+		preset, err := scanPreset(rows)
+
+		if err != nil {
+			return nil, errors.New("Database scan error: " + err.Error())
+		}
+
+		presets = append(presets, preset)
+	}
+
+	return presets, rows.Err()
+}
+
+// ListPresets function    Returns the latest version of every preset of a
+// workspace by name.
+func ListPresets(db *sql.DB, workspace string) ([]*DBpreset, error) {
+	query := "SELECT DISTINCT ON (name) workspace, name, version, config, intervals, created_at FROM simulation_game.presets WHERE workspace = $1 ORDER BY name, version DESC"
+
+	return queryPresets(db, query, workspace)
+}
+
+// GetPresetVersions function    Returns every version of a preset of a
+// workspace, oldest first.
+func GetPresetVersions(db *sql.DB, workspace string, name string) ([]*DBpreset, error) {
+	query := "SELECT workspace, name, version, config, intervals, created_at FROM simulation_game.presets WHERE workspace = $1 AND name = $2 ORDER BY version"
+
+	return queryPresets(db, query, workspace, name)
+}
+
+// DeletePreset function    Deletes a preset of a workspace with all its
+// versions, sql.ErrNoRows is returned if there is no preset with the name.
+// The audit entry, if not nil, is stored in the same transaction.
+func DeletePreset(db *sql.DB, workspace string, name string, audit *DBauditEntry) error {
+	tx, err := db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM simulation_game.presets WHERE workspace = $1 AND name = $2", workspace, name)
+
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	if audit != nil {
+		if err := saveAuditEntry(tx, audit); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
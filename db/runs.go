@@ -0,0 +1,278 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	sg "github.com/sebastianring/simulationgame"
+)
+
+// DBrun is the config a stored run was simulated with, see schema.sql.
+// RoundsPlayed is 0 for runs stored before it was recorded.
+type DBrun struct {
+	Id           uuid.UUID            `json:"id"`
+	Workspace    string               `json:"workspace"`
+	Config       *sg.SimulationConfig `json:"config"`
+	RoundsPlayed int                  `json:"rounds_played"`
+	CreatedAt    time.Time            `json:"created_at"`
+}
+
+// DBroundSummary is the summary of one creature type in one round of a run.
+type DBroundSummary struct {
+	Round        int                `json:"round"`
+	CreatureType sg.BoardObjectType `json:"creature_type"`
+	Summary      sg.CreatureSummary `json:"summary"`
+}
+
+// IsConfigured function    Returns true if there is a db password available,
+// used to skip storing results when running without a db. A password file
+// that can not be read counts as configured, so the error shows up when
+// connecting.
+func IsConfigured() bool {
+	password, err := getPassword()
+
+	return password != "" || err != nil
+}
+
+// SaveRun function    Stores the config and the round summaries of a run in
+// a single transaction.
+func SaveRun(db *sql.DB, run *DBrun, rounds []DBroundSummary) error {
+	return SaveRuns(db, []*DBrun{run}, [][]DBroundSummary{rounds})
+}
+
+// SaveRuns function    Stores the configs of runs and their round summaries,
+// rounds[i] are the ones of runs[i], in a single transaction with one copy per
+// table, so that many runs are not a round trip per row.
+func SaveRuns(db *sql.DB, runs []*DBrun, rounds [][]DBroundSummary) error {
+	tx, err := db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(pq.CopyInSchema("simulation_game", "runs", "id", "workspace", "rows", "cols", "foods", "creature1", "creature2", "max_rounds", "gamelog_size", "rounds_played"))
+
+	if err != nil {
+		return errors.New("Error writing runs to db: " + err.Error())
+	}
+
+	for _, run := range runs {
+		_, err = stmt.Exec(run.Id, run.Workspace, run.Config.Rows, run.Config.Cols, run.Config.Foods,
+			run.Config.Creature1, run.Config.Creature2, run.Config.MaxRounds, run.Config.GamelogSize, run.RoundsPlayed)
+
+		if err != nil {
+			stmt.Close()
+			return errors.New("Error writing run to db: " + err.Error())
+		}
+	}
+
+	if err := closeCopy(stmt); err != nil {
+		return errors.New("Error writing runs to db: " + err.Error())
+	}
+
+	stmt, err = tx.Prepare(pq.CopyInSchema("simulation_game", "run_rounds", "run_id", "round", "creature_type", "creature_name", "total_creatures", "total_speed", "average_speed", "total_scan_chance", "average_scan_chance"))
+
+	if err != nil {
+		return errors.New("Error writing rounds to db: " + err.Error())
+	}
+
+	for i, run := range runs {
+		for _, r := range rounds[i] {
+			_, err = stmt.Exec(run.Id, r.Round, int(r.CreatureType), r.Summary.CreatureType,
+				r.Summary.TotalCreatures, r.Summary.TotalSpeed, r.Summary.AverageSpeed,
+				r.Summary.TotalScanChance, r.Summary.AverageScanChance)
+
+			if err != nil {
+				stmt.Close()
+				return errors.New("Error writing round to db: " + err.Error())
+			}
+		}
+	}
+
+	if err := closeCopy(stmt); err != nil {
+		return errors.New("Error writing rounds to db: " + err.Error())
+	}
+
+	return tx.Commit()
+}
+
+// closeCopy function    Sends the rows buffered by a copy statement and
+// closes it.
+func closeCopy(stmt *sql.Stmt) error {
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return err
+	}
+
+	return stmt.Close()
+}
+
+// GetRun function    Returns a stored run of a workspace and its round
+// summaries ordered by round, sql.ErrNoRows is returned if the workspace has
+// no run with the id.
+func GetRun(db *sql.DB, workspace string, id string) (*DBrun, []DBroundSummary, error) {
+	run := DBrun{Config: &sg.SimulationConfig{}}
+
+	query := "SELECT id, workspace, rows, cols, foods, creature1, creature2, max_rounds, gamelog_size, COALESCE(rounds_played, 0), created_at FROM simulation_game.runs WHERE id = $1 AND workspace = $2"
+	err := db.QueryRow(query, id, workspace).Scan(
+		&run.Id,
+		&run.Workspace,
+		&run.Config.Rows,
+		&run.Config.Cols,
+		&run.Config.Foods,
+		&run.Config.Creature1,
+		&run.Config.Creature2,
+		&run.Config.MaxRounds,
+		&run.Config.GamelogSize,
+		&run.RoundsPlayed,
+		&run.CreatedAt)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query = "SELECT round, creature_type, creature_name, total_creatures, total_speed, average_speed, total_scan_chance, average_scan_chance FROM simulation_game.run_rounds WHERE run_id = $1 ORDER BY round, creature_type"
+	rows, err := db.Query(query, id)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rows.Close()
+
+	rounds := []DBroundSummary{}
+
+	for rows.Next() {
+		r := DBroundSummary{}
+		var creatureType int
+
+		err := rows.Scan(
+			&r.Round,
+			&creatureType,
+			&r.Summary.CreatureType,
+			&r.Summary.TotalCreatures,
+			&r.Summary.TotalSpeed,
+			&r.Summary.AverageSpeed,
+			&r.Summary.TotalScanChance,
+			&r.Summary.AverageScanChance)
+
+		if err != nil {
+			return nil, nil, errors.New("Database scan error: " + err.Error())
+		}
+
+		r.CreatureType = sg.BoardObjectType(creatureType)
+		rounds = append(rounds, r)
+	}
+
+	return &run, rounds, rows.Err()
+}
+
+// ListRuns function    Returns the stored runs of a workspace, newest first.
+func ListRuns(db *sql.DB, workspace string, limit int, offset int) ([]DBrun, error) {
+	query := "SELECT id, workspace, rows, cols, foods, creature1, creature2, max_rounds, gamelog_size, COALESCE(rounds_played, 0), created_at FROM simulation_game.runs WHERE workspace = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3"
+	rows, err := db.Query(query, workspace, limit, offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	runs := []DBrun{}
+
+	for rows.Next() {
+		run := DBrun{Config: &sg.SimulationConfig{}}
+
+		err := rows.Scan(
+			&run.Id,
+			&run.Workspace,
+			&run.Config.Rows,
+			&run.Config.Cols,
+			&run.Config.Foods,
+			&run.Config.Creature1,
+			&run.Config.Creature2,
+			&run.Config.MaxRounds,
+			&run.Config.GamelogSize,
+			&run.RoundsPlayed,
+			&run.CreatedAt)
+
+		if err != nil {
+			return nil, errors.New("Database scan error: " + err.Error())
+		}
+
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+// DeleteRun function    Deletes a run of a workspace with its rounds and the
+// board the simulation game stored for it and returns the deleted run,
+// sql.ErrNoRows is returned if the workspace has no run with the id. The
+// audit entry, if not nil, is stored with the deleted run as its before
+// snapshot, and the run is only deleted if it is.
+func DeleteRun(db *sql.DB, workspace string, id string, audit *DBauditEntry) (*DBrun, error) {
+	tx, err := db.Begin()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	run := DBrun{Config: &sg.SimulationConfig{}}
+	query := "DELETE FROM simulation_game.runs WHERE id = $1 AND workspace = $2 RETURNING id, workspace, rows, cols, foods, creature1, creature2, max_rounds, gamelog_size, COALESCE(rounds_played, 0), created_at"
+	err = tx.QueryRow(query, id, workspace).Scan(
+		&run.Id,
+		&run.Workspace,
+		&run.Config.Rows,
+		&run.Config.Cols,
+		&run.Config.Foods,
+		&run.Config.Creature1,
+		&run.Config.Creature2,
+		&run.Config.MaxRounds,
+		&run.Config.GamelogSize,
+		&run.RoundsPlayed,
+		&run.CreatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM simulation_game.boards WHERE id = $1", id); err != nil {
+		return nil, err
+	}
+
+	if audit != nil {
+		if err := saveAuditSnapshot(tx, audit, &audit.Before, &run); err != nil {
+			return nil, err
+		}
+	}
+
+	return &run, tx.Commit()
+}
+
+// SaveCachedRun function    Stores which run holds the result of a cache key,
+// a key that is already stored keeps its run.
+func SaveCachedRun(db *sql.DB, key string, runID uuid.UUID) error {
+	query := "INSERT INTO simulation_game.result_cache (key, run_id) VALUES ($1, $2) ON CONFLICT (key) DO NOTHING"
+	_, err := db.Exec(query, key, runID)
+
+	return err
+}
+
+// GetCachedRunID function    Returns the id of the run stored for a cache key,
+// sql.ErrNoRows is returned if there is none.
+func GetCachedRunID(db *sql.DB, key string) (string, error) {
+	var id string
+
+	query := "SELECT run_id FROM simulation_game.result_cache WHERE key = $1"
+	err := db.QueryRow(query, key).Scan(&id)
+
+	return id, err
+}
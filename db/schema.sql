@@ -0,0 +1,98 @@
+-- Tables written by simgameserver, the boards and messages tables are
+-- created and written by the simulation game itself.
+
+CREATE TABLE IF NOT EXISTS simulation_game.runs (
+	id           uuid PRIMARY KEY,
+	workspace    text NOT NULL DEFAULT 'default',
+	rows         integer NOT NULL,
+	cols         integer NOT NULL,
+	foods        integer NOT NULL,
+	creature1    integer NOT NULL,
+	creature2    integer NOT NULL,
+	max_rounds   integer NOT NULL,
+	gamelog_size integer NOT NULL,
+	rounds_played integer,
+	created_at   timestamptz NOT NULL DEFAULT now()
+);
+
+-- Added after the first release, runs stored before have no rounds_played.
+ALTER TABLE simulation_game.runs ADD COLUMN IF NOT EXISTS rounds_played integer;
+
+-- Added with workspaces, runs stored before belong to the default workspace.
+ALTER TABLE simulation_game.runs ADD COLUMN IF NOT EXISTS workspace text NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS runs_workspace_created_at ON simulation_game.runs (workspace, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS simulation_game.run_rounds (
+	run_id              uuid NOT NULL REFERENCES simulation_game.runs (id) ON DELETE CASCADE,
+	round               integer NOT NULL,
+	creature_type       integer NOT NULL,
+	creature_name       text NOT NULL,
+	total_creatures     integer NOT NULL,
+	total_speed         double precision NOT NULL,
+	average_speed       double precision NOT NULL,
+	total_scan_chance   double precision NOT NULL,
+	average_scan_chance double precision NOT NULL,
+	PRIMARY KEY (run_id, round, creature_type)
+);
+
+-- Seeded runs by the hash of their config, seed and engine version, see
+-- api/resultCache.go.
+CREATE TABLE IF NOT EXISTS simulation_game.result_cache (
+	key        text PRIMARY KEY,
+	run_id     uuid NOT NULL REFERENCES simulation_game.runs (id) ON DELETE CASCADE,
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- Every version of a named config of a workspace, the latest version is the
+-- current one.
+CREATE TABLE IF NOT EXISTS simulation_game.presets (
+	workspace  text NOT NULL DEFAULT 'default',
+	name       text NOT NULL,
+	version    integer NOT NULL,
+	config     jsonb NOT NULL,
+	intervals  jsonb,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY (workspace, name, version)
+);
+
+-- Api keys exchanged for tokens at /api/token, only the sha256 hash of the
+-- secret part of a key is stored.
+CREATE TABLE IF NOT EXISTS simulation_game.api_keys (
+	id         uuid PRIMARY KEY,
+	owner      text NOT NULL,
+	scopes     text NOT NULL,
+	workspaces jsonb,
+	hash       bytea NOT NULL,
+	expires_at timestamptz,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	revoked_at timestamptz
+);
+
+-- Append-only log of deletes, preset changes and api key issuance, before and
+-- after are json snapshots of the target. The trigger rejects changes to
+-- entries, so the log can only grow.
+CREATE TABLE IF NOT EXISTS simulation_game.audit_log (
+	id         bigserial PRIMARY KEY,
+	time       timestamptz NOT NULL DEFAULT now(),
+	actor      text NOT NULL,
+	request_id text NOT NULL DEFAULT '',
+	workspace  text NOT NULL DEFAULT '',
+	action     text NOT NULL,
+	target     text NOT NULL,
+	before     jsonb,
+	after      jsonb
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_time ON simulation_game.audit_log (time DESC);
+CREATE INDEX IF NOT EXISTS audit_log_target ON simulation_game.audit_log (target, id DESC);
+
+CREATE OR REPLACE FUNCTION simulation_game.audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'simulation_game.audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON simulation_game.audit_log;
+CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE OR TRUNCATE ON simulation_game.audit_log
+	FOR EACH STATEMENT EXECUTE FUNCTION simulation_game.audit_log_append_only();
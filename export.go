@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sebastianring/simgameserver/api"
+)
+
+// runExport function    Handles the export command, e.g.
+// simgameserver export -format parquet -out runs.parquet -iterations 100
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "parquet", "Output format: json, csv, ndjson, arrow or parquet")
+	out := fs.String("out", "", "Output file")
+	ids := fs.String("ids", "", "Comma separated ids of stored runs to export")
+	iterations := fs.Int("iterations", 0, "Number of new random simulations to run and export")
+	workspace := fs.String("workspace", "default", "Workspace the runs are read from and stored in")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var storedIds []string
+
+	if *ids != "" {
+		storedIds = strings.Split(*ids, ",")
+	}
+
+	if len(storedIds) == 0 && *iterations < 1 {
+		return errors.New("Nothing to export, please give -ids and/or -iterations.")
+	}
+
+	// The simulation game prints to stdout, so results are only written to files.
+	if *out == "" {
+		return errors.New("No output file given, please give -out.")
+	}
+
+	// The export is written next to the output file and only replaces it once
+	// it is complete, so a failed export leaves no file behind.
+	f, err := os.CreateTemp(filepath.Dir(*out), "."+filepath.Base(*out)+"-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := api.ExportRuns(f, api.ResultFormat(*format), *workspace, storedIds, *iterations); err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), *out)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"net/url"
+	"os"
+
+	"github.com/sebastianring/simgameserver/api"
+	sc "github.com/sebastianring/simgameserver/simconfig"
+)
+
+// runGIF function    Handles the gif command, e.g.
+// simgameserver gif -out run.gif -rows 30 -cols 60 -cellsize 10
+// Config flags left out get their standard value.
+func runGIF(args []string) error {
+	fs := flag.NewFlagSet("gif", flag.ExitOnError)
+	out := fs.String("out", "", "Output file")
+	cellSize := fs.Int("cellsize", api.DefaultGIFCellSize, "Size of a board cell in pixels, 1-20")
+	delay := fs.Int("delay", api.DefaultGIFDelay, "Delay between frames in milliseconds, 20-5000")
+
+	parameters := []string{"rows", "cols", "foods", "creature1", "creature2"}
+	configFlags := map[string]*string{}
+
+	for _, p := range parameters {
+		configFlags[p] = fs.String(p, "", "Simulation parameter "+p)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *out == "" {
+		return errors.New("No output file given, please give -out.")
+	}
+
+	values := url.Values{}
+
+	for p, v := range configFlags {
+		if *v != "" {
+			values.Set(p, *v)
+		}
+	}
+
+	sc.InitRules()
+
+	// The gif is made in memory, so the file is only created once the flags
+	// are valid and the simulation has run.
+	anim := bytes.Buffer{}
+
+	if err := api.WriteSimulationGIF(context.Background(), &anim, values, *cellSize, *delay); err != nil {
+		return err
+	}
+
+	return os.WriteFile(*out, anim.Bytes(), 0644)
+}
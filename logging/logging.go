@@ -0,0 +1,103 @@
+// Package logging sets up the structured logger of the server. Every line
+// logged with a context carries the id of the request and the trace and span
+// ids of the context.
+package logging
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID function    Returns a context carrying a request id, added to
+// every line logged with it.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID function    Returns the request id of a context, empty outside of
+// requests.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+
+	return id
+}
+
+// contextHandler adds the request id and the span of the context to a
+// record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("trace_id", span.TraceID().String()), slog.String("span_id", span.SpanID().String()))
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// NewHandler function    Returns a handler writing records of at least level,
+// debug, info, warn or error, to w as text or json lines.
+func NewHandler(w io.Writer, level string, format string) (slog.Handler, error) {
+	var l slog.Level
+
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, errors.New("Invalid log level: " + level + ", should be debug, info, warn or error.")
+	}
+
+	options := slog.HandlerOptions{Level: l}
+
+	switch strings.ToLower(format) {
+	case "text":
+		return contextHandler{slog.NewTextHandler(w, &options)}, nil
+	case "json":
+		return contextHandler{slog.NewJSONHandler(w, &options)}, nil
+	}
+
+	return nil, errors.New("Invalid log format: " + format + ", should be text or json.")
+}
+
+// Setup function    Makes the handler of SIM_GAME_LOG_LEVEL (default info) and
+// SIM_GAME_LOG_FORMAT (default text) writing to w the default logger, which
+// the log package writes to as well.
+func Setup(w io.Writer) error {
+	level, format := os.Getenv("SIM_GAME_LOG_LEVEL"), os.Getenv("SIM_GAME_LOG_FORMAT")
+
+	if level == "" {
+		level = "info"
+	}
+
+	if format == "" {
+		format = "text"
+	}
+
+	handler, err := NewHandler(w, level, format)
+
+	if err != nil {
+		return err
+	}
+
+	slog.SetDefault(slog.New(handler))
+
+	return nil
+}
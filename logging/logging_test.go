@@ -0,0 +1,59 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/sebastianring/simgameserver/logging"
+)
+
+func TestHandler_RequestID(t *testing.T) {
+	out := bytes.Buffer{}
+	handler, err := logging.NewHandler(&out, "info", "json")
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	logger := slog.New(handler).With("component", "test")
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+	logger.InfoContext(ctx, "simulation", "rounds", 3)
+	logger.DebugContext(ctx, "hidden")
+
+	line := map[string]any{}
+
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatal("Expected a single json line, got: ", out.String())
+	}
+
+	if line["request_id"] != "req-1" || line["component"] != "test" || line["msg"] != "simulation" {
+		t.Error("Unexpected line: ", out.String())
+	}
+}
+
+func TestHandler_Config(t *testing.T) {
+	out := bytes.Buffer{}
+	handler, err := logging.NewHandler(&out, "WARN", "text")
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	logger := slog.New(handler)
+	logger.Info("hidden")
+	logger.Warn("shown")
+
+	if strings.Contains(out.String(), "hidden") || !strings.Contains(out.String(), "level=WARN msg=shown") {
+		t.Error("Expected only warnings, got: ", out.String())
+	}
+
+	for _, config := range [][2]string{{"verbose", "text"}, {"info", "xml"}} {
+		if _, err := logging.NewHandler(&out, config[0], config[1]); err == nil {
+			t.Error("Expected an error for: ", config)
+		}
+	}
+}
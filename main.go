@@ -1,8 +1,40 @@
 package main
 
-import "github.com/sebastianring/simgameserver/api"
+import (
+	"log"
+	"os"
+
+	"github.com/sebastianring/simgameserver/api"
+	ldb "github.com/sebastianring/simgameserver/db"
+	"github.com/sebastianring/simgameserver/logging"
+	"github.com/sebastianring/simgameserver/redact"
+)
 
 func main() {
+	if err := logging.Setup(redact.NewWriter(os.Stderr)); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ldb.LoadPassword(); err != nil {
+		log.Fatal(err)
+	}
+
+	commands := map[string]func([]string) error{
+		"export": runExport,
+		"gif":    runGIF,
+		"apikey": runAPIKey,
+	}
+
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+
+			return
+		}
+	}
+
 	server := api.NewAPIServer(":8081")
 	server.Run()
 }
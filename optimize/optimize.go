@@ -0,0 +1,252 @@
+package optimize
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Optimizer searches the unit hypercube for the point with the lowest value.
+// Ask returns the next batch of points to evaluate, Tell gets their values in
+// the same order. A batch can be evaluated concurrently, and given the same
+// seed and values an optimizer always asks for the same points.
+type Optimizer interface {
+	Ask() [][]float64
+	Tell(points [][]float64, values []float64)
+}
+
+// Optimizers are the optimizers by name, dimensions is the number of
+// coordinates of a point and batch the preferred batch size, which only the
+// random search follows.
+var Optimizers = map[string]func(dimensions int, batch int, rng *rand.Rand) Optimizer{
+	"random":  NewRandomSearch,
+	"genetic": NewGenetic,
+	"cmaes":   NewCMAES,
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// RandomSearch draws every point uniformly, a baseline for the others.
+type RandomSearch struct {
+	dimensions int
+	batch      int
+	rng        *rand.Rand
+}
+
+func NewRandomSearch(dimensions int, batch int, rng *rand.Rand) Optimizer {
+	return &RandomSearch{dimensions: dimensions, batch: max(1, batch), rng: rng}
+}
+
+func (rs *RandomSearch) Ask() [][]float64 {
+	points := make([][]float64, rs.batch)
+
+	for i := range points {
+		points[i] = make([]float64, rs.dimensions)
+
+		for d := range points[i] {
+			points[i][d] = rs.rng.Float64()
+		}
+	}
+
+	return points
+}
+
+func (rs *RandomSearch) Tell(points [][]float64, values []float64) {}
+
+// Genetic is a genetic algorithm with tournament selection, uniform crossover,
+// gaussian mutation and the best individual kept in every generation.
+type Genetic struct {
+	dimensions int
+	size       int
+	rng        *rand.Rand
+	population [][]float64
+}
+
+func NewGenetic(dimensions int, batch int, rng *rand.Rand) Optimizer {
+	g := Genetic{dimensions: dimensions, size: max(10, 4*dimensions), rng: rng}
+
+	for i := 0; i < g.size; i++ {
+		individual := make([]float64, dimensions)
+
+		for d := range individual {
+			individual[d] = rng.Float64()
+		}
+
+		g.population = append(g.population, individual)
+	}
+
+	return &g
+}
+
+func (g *Genetic) Ask() [][]float64 {
+	return g.population
+}
+
+func (g *Genetic) tournament(points [][]float64, values []float64) []float64 {
+	a, b := g.rng.Intn(len(points)), g.rng.Intn(len(points))
+
+	if values[b] < values[a] {
+		a = b
+	}
+
+	return points[a]
+}
+
+// Tell function    Breeds the next generation from the evaluated one.
+func (g *Genetic) Tell(points [][]float64, values []float64) {
+	if len(points) == 0 {
+		return
+	}
+
+	best := 0
+
+	for i := range values {
+		if values[i] < values[best] {
+			best = i
+		}
+	}
+
+	next := [][]float64{append([]float64{}, points[best]...)}
+	mutation := 1 / float64(g.dimensions)
+
+	for len(next) < g.size {
+		a, b := g.tournament(points, values), g.tournament(points, values)
+		child := make([]float64, g.dimensions)
+
+		for d := range child {
+			if g.rng.Float64() < 0.5 {
+				child[d] = a[d]
+			} else {
+				child[d] = b[d]
+			}
+
+			if g.rng.Float64() < mutation {
+				child[d] = clamp(child[d] + g.rng.NormFloat64()*0.1)
+			}
+		}
+
+		next = append(next, child)
+	}
+
+	g.population = next
+}
+
+// CMAES is a light CMA-ES with a diagonal covariance matrix, updated with the
+// rank-mu update only, and cumulative step size adaptation. Points outside
+// the hypercube are clamped.
+type CMAES struct {
+	dimensions int
+	lambda     int
+	rng        *rand.Rand
+	weights    []float64
+	mueff      float64
+	mean       []float64
+	sigma      float64
+	variances  []float64
+	path       []float64
+	csigma     float64
+	dsigma     float64
+	cmu        float64
+	chiN       float64
+}
+
+func NewCMAES(dimensions int, batch int, rng *rand.Rand) Optimizer {
+	n := float64(dimensions)
+	c := CMAES{
+		dimensions: dimensions,
+		lambda:     4 + int(3*math.Log(n)),
+		rng:        rng,
+		sigma:      0.3,
+		mean:       make([]float64, dimensions),
+		variances:  make([]float64, dimensions),
+		path:       make([]float64, dimensions),
+		chiN:       math.Sqrt(n) * (1 - 1/(4*n) + 1/(21*n*n)),
+	}
+
+	for d := range c.mean {
+		c.mean[d] = 0.5
+		c.variances[d] = 1
+	}
+
+	mu := c.lambda / 2
+	sum, sumSquares := 0.0, 0.0
+
+	for i := 0; i < mu; i++ {
+		w := math.Log(float64(mu)+0.5) - math.Log(float64(i+1))
+		c.weights = append(c.weights, w)
+		sum += w
+	}
+
+	for i := range c.weights {
+		c.weights[i] /= sum
+		sumSquares += c.weights[i] * c.weights[i]
+	}
+
+	c.mueff = 1 / sumSquares
+	c.csigma = (c.mueff + 2) / (n + c.mueff + 5)
+	c.dsigma = 1 + c.csigma + 2*math.Max(0, math.Sqrt((c.mueff-1)/(n+1))-1)
+	c.cmu = math.Min(1, 2*(c.mueff-2+1/c.mueff)/((n+2)*(n+2)+c.mueff))
+
+	return &c
+}
+
+func (c *CMAES) Ask() [][]float64 {
+	points := make([][]float64, c.lambda)
+
+	for i := range points {
+		points[i] = make([]float64, c.dimensions)
+
+		for d := range points[i] {
+			points[i][d] = clamp(c.mean[d] + c.sigma*math.Sqrt(c.variances[d])*c.rng.NormFloat64())
+		}
+	}
+
+	return points
+}
+
+// Tell function    Moves the mean towards the best half of the points and
+// adapts the step size and variances.
+func (c *CMAES) Tell(points [][]float64, values []float64) {
+	order := make([]int, len(points))
+
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(a, b int) bool { return values[order[a]] < values[order[b]] })
+
+	if len(order) < len(c.weights) {
+		return
+	}
+
+	step := make([]float64, c.dimensions)
+	zmean := make([]float64, c.dimensions)
+	variances := make([]float64, c.dimensions)
+
+	for k, w := range c.weights {
+		p := points[order[k]]
+
+		for d := range p {
+			// The step is taken from the clamped point so that the mean
+			// follows the points that were evaluated.
+			y := (p[d] - c.mean[d]) / c.sigma
+			step[d] += w * y
+			zmean[d] += w * y / math.Sqrt(math.Max(c.variances[d], 1e-12))
+			variances[d] += w * y * y
+		}
+	}
+
+	norm := 0.0
+
+	for d := range c.mean {
+		c.mean[d] = clamp(c.mean[d] + c.sigma*step[d])
+		c.path[d] = (1-c.csigma)*c.path[d] + math.Sqrt(c.csigma*(2-c.csigma)*c.mueff)*zmean[d]
+		norm += c.path[d] * c.path[d]
+		c.variances[d] = (1-c.cmu)*c.variances[d] + c.cmu*variances[d]
+	}
+
+	c.sigma *= math.Exp(c.csigma / c.dsigma * (math.Sqrt(norm)/c.chiN - 1))
+	c.sigma = math.Max(1e-6, math.Min(c.sigma, 1))
+}
@@ -0,0 +1,63 @@
+package optimize_test
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/sebastianring/simgameserver/optimize"
+)
+
+// sphere has its minimum 0 at (0.3, 0.7, 0.5).
+func sphere(x []float64) float64 {
+	target := []float64{0.3, 0.7, 0.5}
+	sum := 0.0
+
+	for d := range x {
+		sum += (x[d] - target[d]) * (x[d] - target[d])
+	}
+
+	return sum
+}
+
+func minimize(o optimize.Optimizer, evaluations int) float64 {
+	best := math.Inf(1)
+
+	for evaluations > 0 {
+		points := o.Ask()
+		values := []float64{}
+
+		for _, p := range points {
+			values = append(values, sphere(p))
+			best = math.Min(best, values[len(values)-1])
+		}
+
+		o.Tell(points, values)
+		evaluations -= len(points)
+	}
+
+	return best
+}
+
+func TestOptimizers(t *testing.T) {
+	for name, newOptimizer := range optimize.Optimizers {
+		fmt.Println("Testing optimizer", name)
+		best := minimize(newOptimizer(3, 8, rand.New(rand.NewSource(1))), 600)
+
+		if best > 0.01 {
+			t.Error("Optimizer ", name, " did not get close to the minimum: ", best)
+		}
+	}
+}
+
+func TestOptimizersAreDeterministic(t *testing.T) {
+	for name, newOptimizer := range optimize.Optimizers {
+		a := minimize(newOptimizer(3, 8, rand.New(rand.NewSource(7))), 100)
+		b := minimize(newOptimizer(3, 8, rand.New(rand.NewSource(7))), 100)
+
+		if a != b {
+			t.Error("Optimizer ", name, " is not deterministic: ", a, b)
+		}
+	}
+}
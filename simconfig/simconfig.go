@@ -2,19 +2,34 @@ package simconfig
 
 import (
 	"errors"
-	"fmt"
-	"github.com/gorilla/mux"
 	sg "github.com/sebastianring/simulationgame"
-	"log"
+	"log/slog"
 	"math/rand"
 	"net/http"
 	"net/url"
 	"reflect"
 	"strconv"
+	"sync"
+	"time"
 )
 
 var parameterRules map[string]*Rule
 
+// random is the source random configs are drawn from. It is not the global
+// source of math/rand, which seeded simulations reseed and draw from while
+// random configs are drawn concurrently.
+var random = rand.New(rand.NewSource(time.Now().UnixNano()))
+var randomMu sync.Mutex
+
+// OnValidationFailure is called with the parameter of every value that fails
+// conversion or validation, and with creatures or foods when they do not fit
+// the board. The api counts them in its metrics.
+var OnValidationFailure = func(parameter string) {}
+
+// ParameterNames are the names of all parameters with a rule, in the order
+// they are presented to users.
+var ParameterNames = []string{"rows", "cols", "foods", "creature1", "creature2", "maxrounds", "gamelogsize", "draw"}
+
 type Rule struct {
 	StandardValue any
 	MinVal        any
@@ -123,18 +138,26 @@ func InitRules() {
 
 }
 
+// GetRule function    Returns the rule of a parameter, InitRules has to be
+// called first.
+func GetRule(name string) (*Rule, bool) {
+	rule, ok := parameterRules[name]
+
+	return rule, ok
+}
+
 func GetSimulationConfigFromUrlValues(urlvalues url.Values) (*sg.SimulationConfig, error) {
 	finalValue, err := CleanUrlParametersToMap(urlvalues)
 
 	if err != nil {
-		log.Println("Issue cleaning parameters from url values: " + err.Error())
+		slog.Debug("Invalid url parameters", "error", err)
 		return nil, err
 	}
 
 	sc, err := GetValidatedConfigFromMap(finalValue)
 
 	if err != nil {
-		log.Println("Issue validating configuration from map: " + err.Error())
+		slog.Debug("Invalid config", "error", err)
 		return nil, err
 	}
 
@@ -146,9 +169,6 @@ func GetRandomSimulationConfigFromUrl(r *http.Request) (*sg.SimulationConfig, er
 	// Different from specific values as in other singe simulations
 	// Consumer need to be able to add intervals which are relevant, e.g. rows: 100-120
 
-	parameters := mux.Vars(r)
-	fmt.Println(parameters)
-
 	sc, err := GetRandomSimulationConfig()
 
 	if err != nil {
@@ -181,6 +201,71 @@ func GetStandardIntervalMap() map[string]valueInterval {
 	return standardInterval
 }
 
+// GetStandardInterval function    Returns the interval random simulations
+// draw a parameter from, false if the parameter is not drawn at random.
+func GetStandardInterval(name string) (int, int, bool) {
+	interval, ok := GetStandardIntervalMap()[name]
+
+	if !ok {
+		return 0, 0, false
+	}
+
+	return interval.getMin(), interval.getMax(), true
+}
+
+// Interval is the range a random simulation draws a parameter from, both
+// ends included.
+type Interval struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// GetIntervalMap function    Returns the standard interval map with the given
+// intervals in place of the standard ones. Only parameters drawn at random can
+// be given and their intervals have to be inside their rules.
+func GetIntervalMap(intervals map[string]Interval) (map[string]valueInterval, error) {
+	intervalMap := GetStandardIntervalMap()
+
+	for key, interval := range intervals {
+		standard, ok := intervalMap[key]
+
+		if !ok {
+			return nil, errors.New("Parameter " + key + " is not drawn at random and can not have an interval.")
+		}
+
+		rule := parameterRules[key]
+
+		if interval.Min > interval.Max || interval.Min < 0 {
+			return nil, errors.New("Invalid interval for " + key + ", min should be at least 0 and at most max.")
+		}
+
+		if _, ok := standard.(*uintInterval); ok {
+			if _, ok := rule.validateGenericValue(uint(interval.Min)); !ok {
+				return nil, errors.New(rule.ErrorMsg)
+			}
+
+			if _, ok := rule.validateGenericValue(uint(interval.Max)); !ok {
+				return nil, errors.New(rule.ErrorMsg)
+			}
+
+			intervalMap[key] = &uintInterval{min: uint(interval.Min), max: uint(interval.Max)}
+			continue
+		}
+
+		if _, ok := rule.validateGenericValue(interval.Min); !ok {
+			return nil, errors.New(rule.ErrorMsg)
+		}
+
+		if _, ok := rule.validateGenericValue(interval.Max); !ok {
+			return nil, errors.New(rule.ErrorMsg)
+		}
+
+		intervalMap[key] = &intInterval{min: interval.Min, max: interval.Max}
+	}
+
+	return intervalMap, nil
+}
+
 func GetRandomSimulationConfigFromInterval(intervalMap map[string]valueInterval) (*sg.SimulationConfig, error) {
 	valueMap := make(map[string]any)
 
@@ -206,7 +291,10 @@ func GetRandomSimulationConfigFromInterval(intervalMap map[string]valueInterval)
 }
 
 func randomValueInInterval(interval valueInterval) int {
-	value := rand.Intn(interval.getMax()-interval.getMin()+1) + interval.getMin()
+	randomMu.Lock()
+	defer randomMu.Unlock()
+
+	value := random.Intn(interval.getMax()-interval.getMin()+1) + interval.getMin()
 
 	return value
 }
@@ -216,8 +304,6 @@ func (r *Rule) validateGenericValue(value any) (any, bool) {
 		return nil, false
 	}
 
-	fmt.Println(reflect.TypeOf(r.StandardValue), reflect.TypeOf(value))
-
 	if reflect.TypeOf(value) == reflect.TypeOf(r.StandardValue) {
 		switch v := value.(type) {
 		case int:
@@ -323,11 +409,11 @@ func CleanUrlParametersToMap(input url.Values) (map[string]any, error) {
 				returnMap[key] = false
 			}
 
-		case "rows", "cols", "foods":
+		case "rows", "cols", "foods", "maxrounds", "gamelogsize":
 			intV, err := strconv.Atoi(value[0])
 
 			if err != nil {
-				fmt.Println("Issue with converting url parameter - not a string")
+				OnValidationFailure(key)
 				return nil, errors.New("Issue with converting url parameter - not a string")
 			}
 
@@ -336,7 +422,7 @@ func CleanUrlParametersToMap(input url.Values) (map[string]any, error) {
 			intV, err := strconv.Atoi(value[0])
 
 			if err != nil {
-				fmt.Println("Issue with converting url parameter - not a string")
+				OnValidationFailure(key)
 				return nil, errors.New("Issue with converting url parameter - not a string")
 			}
 
@@ -356,9 +442,10 @@ func GetValidatedConfigFromMap(valueMap map[string]any) (*sg.SimulationConfig, e
 
 		if err != nil {
 			if v == nil {
+				OnValidationFailure(key)
 				return nil, errors.New(err.Error())
 			} else {
-				log.Printf("No value for parameter: %v, resorting to standard value.", key)
+				slog.Debug("No value for parameter, using the standard value", "parameter", key)
 				finalValue[key] = v
 			}
 			// Currently, if there is an issue with a validation,
@@ -435,6 +522,36 @@ func GetValidatedConfigFromMap(valueMap map[string]any) (*sg.SimulationConfig, e
 		return nil, errors.New("Error, the value of gamelog size was not an int.")
 	}
 
+	if err := checkBoardCapacity(&sc); err != nil {
+		return nil, err
+	}
+
 	return &sc, nil
 
 }
+
+// checkBoardCapacity function    The simulation game places creatures on the
+// edge of the board, corners excluded, and foods at least 3 cells from the
+// edge. It keeps looking for a free cell forever if they do not fit, so such
+// configs are rejected up front.
+func checkBoardCapacity(sc *sg.SimulationConfig) error {
+	edge := 2*(sc.Rows+sc.Cols) - 8
+
+	if int(sc.Creature1+sc.Creature2) > edge {
+		OnValidationFailure("creatures")
+		return errors.New("Too many creatures for the board, at most " + strconv.Itoa(edge) + " fit on its edge.")
+	}
+
+	inside := 0
+
+	if sc.Rows > 6 && sc.Cols > 6 {
+		inside = (sc.Rows - 6) * (sc.Cols - 6)
+	}
+
+	if sc.Foods > inside {
+		OnValidationFailure("foods")
+		return errors.New("Too many foods for the board, at most " + strconv.Itoa(inside) + " fit inside it.")
+	}
+
+	return nil
+}
@@ -73,3 +73,50 @@ func TestParsingUrl(t *testing.T) {
 
 	fmt.Println(finalMap)
 }
+
+func TestBoardCapacity(t *testing.T) {
+	fmt.Println("Testing configs that do not fit on the board")
+	sc.InitRules()
+
+	for _, query := range []string{"rows=5&cols=5&foods=1", "rows=10&cols=10&creature1=30&creature2=10&foods=5"} {
+		values, _ := url.ParseQuery(query)
+
+		if _, err := sc.GetSimulationConfigFromUrlValues(values); err == nil {
+			t.Error("Expected an error for a board too small: ", query)
+		}
+	}
+}
+
+func TestIntervalMap(t *testing.T) {
+	sc.InitRules()
+	intervalMap, err := sc.GetIntervalMap(map[string]sc.Interval{"rows": {Min: 20, Max: 25}, "creature1": {Min: 3, Max: 3}})
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for i := 0; i < 10; i++ {
+		config, err := sc.GetRandomSimulationConfigFromInterval(intervalMap)
+
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if config.Rows < 20 || config.Rows > 25 || config.Creature1 != 3 {
+			t.Error("Expected the config to be drawn from the intervals, got: ", config)
+		}
+	}
+
+	invalid := []map[string]sc.Interval{
+		{"maxrounds": {Min: 1, Max: 10}},
+		{"rows": {Min: 30, Max: 20}},
+		{"cols": {Min: 50, Max: 500}},
+		{"creature2": {Min: 0, Max: 51}},
+	}
+
+	for _, intervals := range invalid {
+		if _, err := sc.GetIntervalMap(intervals); err == nil {
+			t.Error("Expected an error for intervals: ", intervals)
+		}
+	}
+}
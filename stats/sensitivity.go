@@ -0,0 +1,99 @@
+package stats
+
+import (
+	"errors"
+	"math/rand"
+)
+
+// LatinHypercube function    Returns n points in the unit hypercube of the
+// given dimensions, every dimension has exactly one point in each of its n
+// equally sized intervals.
+func LatinHypercube(n int, dimensions int, rng *rand.Rand) [][]float64 {
+	points := make([][]float64, n)
+
+	for i := range points {
+		points[i] = make([]float64, dimensions)
+	}
+
+	for d := 0; d < dimensions; d++ {
+		for i, interval := range rng.Perm(n) {
+			points[i][d] = (float64(interval) + rng.Float64()) / float64(n)
+		}
+	}
+
+	return points
+}
+
+// SaltelliDesign function    Returns the sample matrices A and B and for
+// every dimension i the matrix AB_i, which is A with column i taken from B.
+// The model has to be evaluated at n*(dimensions+2) points.
+func SaltelliDesign(n int, dimensions int, rng *rand.Rand) (a [][]float64, b [][]float64, ab [][][]float64) {
+	points := LatinHypercube(n, 2*dimensions, rng)
+	a = make([][]float64, n)
+	b = make([][]float64, n)
+
+	for j, p := range points {
+		a[j] = p[:dimensions]
+		b[j] = p[dimensions:]
+	}
+
+	ab = make([][][]float64, dimensions)
+
+	for i := range ab {
+		ab[i] = make([][]float64, n)
+
+		for j := range a {
+			ab[i][j] = append([]float64{}, a[j]...)
+			ab[i][j][i] = b[j][i]
+		}
+	}
+
+	return a, b, ab
+}
+
+// SobolIndices function    Returns the first order and total Sobol indices of
+// every dimension from the model outputs of a Saltelli design, using the
+// estimators of Saltelli (2010) for first order and Jansen (1999) for total
+// indices. With few samples the estimates are noisy and can fall slightly
+// outside 0-1.
+func SobolIndices(fa []float64, fb []float64, fab [][]float64) (first []float64, total []float64, err error) {
+	n := len(fa)
+
+	if n < 2 || len(fb) != n {
+		return nil, nil, errors.New("Sobol indices need at least two outputs of both A and B.")
+	}
+
+	r := Running{}
+
+	for j := 0; j < n; j++ {
+		r.Add(fa[j])
+		r.Add(fb[j])
+	}
+
+	variance := r.Variance()
+
+	if variance == 0 {
+		return nil, nil, errors.New("The output never changed, sensitivity indices are undefined.")
+	}
+
+	first = make([]float64, len(fab))
+	total = make([]float64, len(fab))
+
+	for i, fi := range fab {
+		if len(fi) != n {
+			return nil, nil, errors.New("Every AB matrix needs as many outputs as A.")
+		}
+
+		sumFirst, sumTotal := 0.0, 0.0
+
+		for j := 0; j < n; j++ {
+			sumFirst += fb[j] * (fi[j] - fa[j])
+			sumTotal += (fa[j] - fi[j]) * (fa[j] - fi[j])
+		}
+
+		first[i] = sumFirst / float64(n) / variance
+		total[i] = sumTotal / float64(2*n) / variance
+	}
+
+	return first, total, nil
+}
@@ -0,0 +1,88 @@
+package stats
+
+import (
+	"math"
+)
+
+// Running keeps the count, mean and variance of a series of values without
+// storing them, using Welford's algorithm. The zero value is ready to use.
+type Running struct {
+	n    int
+	mean float64
+	m2   float64
+	min  float64
+	max  float64
+}
+
+// Summary is a snapshot of a Running, used in api responses.
+type Summary struct {
+	N      int     `json:"n"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"std_dev"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+}
+
+func (r *Running) Add(x float64) {
+	r.n++
+
+	if r.n == 1 {
+		r.min = x
+		r.max = x
+	} else {
+		r.min = math.Min(r.min, x)
+		r.max = math.Max(r.max, x)
+	}
+
+	delta := x - r.mean
+	r.mean += delta / float64(r.n)
+	r.m2 += delta * (x - r.mean)
+}
+
+func (r *Running) N() int {
+	return r.n
+}
+
+func (r *Running) Mean() float64 {
+	return r.mean
+}
+
+// Variance function    Returns the sample variance, 0 for less than two values.
+func (r *Running) Variance() float64 {
+	if r.n < 2 {
+		return 0
+	}
+
+	return r.m2 / float64(r.n-1)
+}
+
+func (r *Running) StdDev() float64 {
+	return math.Sqrt(r.Variance())
+}
+
+// StdErr function    Returns the standard error of the mean.
+func (r *Running) StdErr() float64 {
+	if r.n < 1 {
+		return 0
+	}
+
+	return r.StdDev() / math.Sqrt(float64(r.n))
+}
+
+func (r *Running) Min() float64 {
+	return r.min
+}
+
+func (r *Running) Max() float64 {
+	return r.max
+}
+
+func (r *Running) Summary() Summary {
+	return Summary{
+		N:      r.n,
+		Mean:   r.mean,
+		StdDev: r.StdDev(),
+		Min:    r.min,
+		Max:    r.max,
+	}
+}
@@ -0,0 +1,190 @@
+package stats_test
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/sebastianring/simgameserver/stats"
+)
+
+func TestRunning(t *testing.T) {
+	fmt.Println("Testing running mean and variance.")
+	r := stats.Running{}
+
+	for _, v := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		r.Add(v)
+	}
+
+	if r.N() != 8 {
+		t.Error("Wrong count: ", r.N())
+	}
+
+	if r.Mean() != 5 {
+		t.Error("Wrong mean: ", r.Mean())
+	}
+
+	if math.Abs(r.Variance()-32.0/7.0) > 1e-9 {
+		t.Error("Wrong variance: ", r.Variance())
+	}
+
+	if r.Min() != 2 || r.Max() != 9 {
+		t.Error("Wrong min or max: ", r.Min(), r.Max())
+	}
+}
+
+func TestWelchTTest(t *testing.T) {
+	fmt.Println("Testing Welch t-test.")
+	a := []float64{19.8, 20.4, 19.6, 17.8, 18.5, 18.9, 18.3, 18.9, 19.5, 22.0}
+	b := []float64{28.2, 26.6, 20.1, 23.3, 25.2, 22.1, 17.7, 27.6, 20.6, 13.7, 23.2, 17.5, 20.6, 18.0, 23.9, 21.6, 24.3, 20.4, 23.9, 13.3}
+
+	result, err := stats.WelchTTest(a, b)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// Reference values computed by hand, the p-value by numerical integration.
+	if math.Abs(result.Statistic-(-2.2255)) > 1e-3 {
+		t.Error("Wrong t statistic: ", result.Statistic)
+	}
+
+	if math.Abs(result.DF-24.5) > 0.1 {
+		t.Error("Wrong degrees of freedom: ", result.DF)
+	}
+
+	if math.Abs(result.PValue-0.03548) > 1e-4 {
+		t.Error("Wrong p-value: ", result.PValue)
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	fmt.Println("Testing Mann-Whitney U test.")
+	a := []float64{19.8, 20.4, 19.6, 17.8, 18.5, 18.9, 18.3, 18.9, 19.5, 22.0}
+	b := []float64{28.2, 26.6, 20.1, 23.3, 25.2, 22.1, 17.7, 27.6, 20.6, 13.7, 23.2, 17.5, 20.6, 18.0, 23.9, 21.6, 24.3, 20.4, 23.9, 13.3}
+
+	result, err := stats.MannWhitneyU(a, b)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if result.Statistic != 55.5 {
+		t.Error("Wrong U statistic: ", result.Statistic)
+	}
+
+	if math.Abs(result.PValue-0.05279) > 1e-4 {
+		t.Error("Wrong p-value: ", result.PValue)
+	}
+
+	if math.Abs(result.EffectSize-(-0.445)) > 1e-9 {
+		t.Error("Wrong rank-biserial correlation: ", result.EffectSize)
+	}
+}
+
+func TestChiSquareTest(t *testing.T) {
+	fmt.Println("Testing chi-square test.")
+
+	// With 2 degrees of freedom the p-value is exp(-x/2), with 1 it is
+	// erfc(sqrt(x/2)), which makes both easy to check.
+	result, err := stats.ChiSquareTest([][]float64{{10, 20, 30}, {6, 9, 17}})
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if result.DF != 2 || math.Abs(result.PValue-math.Exp(-result.Statistic/2)) > 1e-9 {
+		t.Error("Wrong p-value with 2 degrees of freedom: ", result.PValue, result.DF)
+	}
+
+	// The empty column is left out.
+	result, err = stats.ChiSquareTest([][]float64{{30, 10, 0}, {10, 30, 0}})
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if result.DF != 1 || result.Statistic != 20 || math.Abs(result.PValue-math.Erfc(math.Sqrt(10))) > 1e-12 {
+		t.Error("Wrong result with 1 degree of freedom: ", result.Statistic, result.PValue, result.DF)
+	}
+
+	if math.Abs(result.EffectSize-0.5) > 1e-9 {
+		t.Error("Wrong Cramér's V: ", result.EffectSize)
+	}
+}
+
+func TestHolmCorrection(t *testing.T) {
+	fmt.Println("Testing Holm correction.")
+	adjusted := stats.HolmCorrection([]float64{0.01, 0.04, 0.03, 0.005})
+	expected := []float64{0.03, 0.06, 0.06, 0.02}
+
+	for i := range expected {
+		if math.Abs(adjusted[i]-expected[i]) > 1e-12 {
+			t.Error("Wrong adjusted p-values: ", adjusted)
+			break
+		}
+	}
+}
+
+func TestLatinHypercube(t *testing.T) {
+	fmt.Println("Testing Latin hypercube sampling.")
+	points := stats.LatinHypercube(10, 3, rand.New(rand.NewSource(1)))
+
+	for d := 0; d < 3; d++ {
+		intervals := map[int]bool{}
+
+		for _, p := range points {
+			intervals[int(p[d]*10)] = true
+		}
+
+		if len(intervals) != 10 {
+			t.Error("Expected one point in every interval of dimension ", d)
+		}
+	}
+}
+
+func TestSobolIndices(t *testing.T) {
+	fmt.Println("Testing Sobol indices of an additive model.")
+
+	// f = 4*x0 + x1 and x2 unused, the variance of 4*x0 is 16 times the one of
+	// x1 so the indices of x0, x1 and x2 are 16/17, 1/17 and 0.
+	model := func(x []float64) float64 { return 4*x[0] + x[1] }
+	a, b, ab := stats.SaltelliDesign(2000, 3, rand.New(rand.NewSource(1)))
+	fa, fb := []float64{}, []float64{}
+	fab := make([][]float64, 3)
+
+	for j := range a {
+		fa = append(fa, model(a[j]))
+		fb = append(fb, model(b[j]))
+
+		for i := range ab {
+			fab[i] = append(fab[i], model(ab[i][j]))
+		}
+	}
+
+	first, total, err := stats.SobolIndices(fa, fb, fab)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := []float64{16.0 / 17, 1.0 / 17, 0}
+
+	for i := range expected {
+		if math.Abs(first[i]-expected[i]) > 0.05 || math.Abs(total[i]-expected[i]) > 0.05 {
+			t.Error("Wrong indices of dimension ", i, ": ", first[i], total[i])
+		}
+	}
+}
+
+func TestStudentTCritical(t *testing.T) {
+	fmt.Println("Testing critical values of Student's t.")
+
+	// Values from a t table.
+	for _, c := range []struct{ df, t float64 }{{1, 12.706}, {9, 2.262}, {30, 2.042}} {
+		if v := stats.StudentTCritical(0.05, c.df); math.Abs(v-c.t) > 1e-3 {
+			t.Error("Wrong critical value for df ", c.df, ": ", v)
+		}
+	}
+}
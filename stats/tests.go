@@ -0,0 +1,437 @@
+package stats
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// TestResult is the outcome of a hypothesis test, PValue is two-sided. The
+// effect size is Cohen's d for the t-test, the rank-biserial correlation for
+// Mann-Whitney U and Cramér's V for chi-square.
+type TestResult struct {
+	Test       string  `json:"test"`
+	Statistic  float64 `json:"statistic"`
+	DF         float64 `json:"df,omitempty"`
+	PValue     float64 `json:"p_value"`
+	EffectSize float64 `json:"effect_size"`
+	Effect     string  `json:"effect"`
+}
+
+// WelchTTest function    Tests if the means of two samples differ without
+// assuming equal variances. Both samples need at least two values.
+func WelchTTest(a []float64, b []float64) (*TestResult, error) {
+	if len(a) < 2 || len(b) < 2 {
+		return nil, errors.New("Welch t-test needs at least two values in each sample.")
+	}
+
+	ra, rb := Running{}, Running{}
+
+	for _, v := range a {
+		ra.Add(v)
+	}
+
+	for _, v := range b {
+		rb.Add(v)
+	}
+
+	va := ra.Variance() / float64(ra.N())
+	vb := rb.Variance() / float64(rb.N())
+
+	if va+vb == 0 {
+		// Both samples are constant, they either differ for sure or not at all.
+		p := 1.0
+
+		if ra.Mean() != rb.Mean() {
+			p = 0
+		}
+
+		return &TestResult{Test: "welch_t", Statistic: 0, PValue: p, Effect: "cohens_d"}, nil
+	}
+
+	t := (ra.Mean() - rb.Mean()) / math.Sqrt(va+vb)
+	df := (va + vb) * (va + vb) / (va*va/float64(ra.N()-1) + vb*vb/float64(rb.N()-1))
+
+	return &TestResult{
+		Test:       "welch_t",
+		Statistic:  t,
+		DF:         df,
+		PValue:     StudentTTwoSided(t, df),
+		EffectSize: CohensD(&ra, &rb),
+		Effect:     "cohens_d",
+	}, nil
+}
+
+// CohensD function    Returns the difference of the means in pooled standard
+// deviations, 0 if both samples are constant.
+func CohensD(a *Running, b *Running) float64 {
+	df := float64(a.N() + b.N() - 2)
+
+	if df <= 0 {
+		return 0
+	}
+
+	pooled := math.Sqrt((float64(a.N()-1)*a.Variance() + float64(b.N()-1)*b.Variance()) / df)
+
+	if pooled == 0 {
+		return 0
+	}
+
+	return (a.Mean() - b.Mean()) / pooled
+}
+
+// MannWhitneyU function    Tests if values of one sample tend to be larger
+// than the other without assuming a distribution. The statistic is U of a,
+// the p-value uses the normal approximation with tie and continuity
+// correction, which is fair from about 8 values per sample.
+func MannWhitneyU(a []float64, b []float64) (*TestResult, error) {
+	if len(a) == 0 || len(b) == 0 {
+		return nil, errors.New("Mann-Whitney U test needs at least one value in each sample.")
+	}
+
+	type value struct {
+		v     float64
+		fromA bool
+	}
+
+	values := make([]value, 0, len(a)+len(b))
+
+	for _, v := range a {
+		values = append(values, value{v, true})
+	}
+
+	for _, v := range b {
+		values = append(values, value{v, false})
+	}
+
+	sort.Slice(values, func(i, j int) bool { return values[i].v < values[j].v })
+
+	n := float64(len(values))
+	rankSumA := 0.0
+	ties := 0.0
+
+	// Tied values share the mean of their ranks.
+	for i := 0; i < len(values); {
+		j := i
+
+		for j < len(values) && values[j].v == values[i].v {
+			j++
+		}
+
+		rank := float64(i+j+1) / 2
+		count := float64(j - i)
+		ties += count*count*count - count
+
+		for k := i; k < j; k++ {
+			if values[k].fromA {
+				rankSumA += rank
+			}
+		}
+
+		i = j
+	}
+
+	na, nb := float64(len(a)), float64(len(b))
+	u := rankSumA - na*(na+1)/2
+	mu := na * nb / 2
+	sigma := math.Sqrt(na * nb / 12 * ((n + 1) - ties/(n*(n-1))))
+	p := 1.0
+
+	if sigma > 0 {
+		z := math.Max(0, math.Abs(u-mu)-0.5) / sigma
+		p = math.Erfc(z / math.Sqrt2)
+	}
+
+	return &TestResult{
+		Test:       "mann_whitney_u",
+		Statistic:  u,
+		PValue:     p,
+		EffectSize: 2*u/(na*nb) - 1,
+		Effect:     "rank_biserial",
+	}, nil
+}
+
+// ChiSquareTest function    Tests if the rows of a contingency table of counts
+// have the same distribution over the columns. Columns without counts are
+// left out, a table with less than two rows or columns left has p-value 1.
+func ChiSquareTest(table [][]float64) (*TestResult, error) {
+	if len(table) < 2 {
+		return nil, errors.New("Chi-square test needs at least two rows.")
+	}
+
+	cols := len(table[0])
+	rowSums := make([]float64, len(table))
+	colSums := make([]float64, cols)
+	total := 0.0
+
+	for i, row := range table {
+		if len(row) != cols {
+			return nil, errors.New("Chi-square test needs rows of the same length.")
+		}
+
+		for j, v := range row {
+			if v < 0 {
+				return nil, errors.New("Chi-square test needs counts of at least 0.")
+			}
+
+			rowSums[i] += v
+			colSums[j] += v
+			total += v
+		}
+	}
+
+	usedRows, usedCols := 0, 0
+
+	for _, sum := range rowSums {
+		if sum > 0 {
+			usedRows++
+		}
+	}
+
+	for _, sum := range colSums {
+		if sum > 0 {
+			usedCols++
+		}
+	}
+
+	result := TestResult{Test: "chi_square", PValue: 1, Effect: "cramers_v"}
+
+	if usedRows < 2 || usedCols < 2 {
+		return &result, nil
+	}
+
+	for i, row := range table {
+		for j, v := range row {
+			if rowSums[i] == 0 || colSums[j] == 0 {
+				continue
+			}
+
+			expected := rowSums[i] * colSums[j] / total
+			result.Statistic += (v - expected) * (v - expected) / expected
+		}
+	}
+
+	result.DF = float64((usedRows - 1) * (usedCols - 1))
+	result.PValue = RegularizedGammaQ(result.DF/2, result.Statistic/2)
+	result.EffectSize = math.Sqrt(result.Statistic / (total * float64(min(usedRows, usedCols)-1)))
+
+	return &result, nil
+}
+
+// RegularizedGammaQ function    Returns the upper regularized incomplete gamma
+// function Q(a, x), with a series below a+1 and a continued fraction above as
+// described in Numerical Recipes.
+func RegularizedGammaQ(a float64, x float64) float64 {
+	const (
+		maxIterations = 300
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+
+	if x <= 0 {
+		return 1
+	}
+
+	lga, _ := math.Lgamma(a)
+	front := math.Exp(-x + a*math.Log(x) - lga)
+
+	if x < a+1 {
+		sum := 1 / a
+		term := sum
+
+		for n := 1; n <= maxIterations; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+
+			if math.Abs(term) < math.Abs(sum)*epsilon {
+				break
+			}
+		}
+
+		return 1 - front*sum
+	}
+
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+
+	for n := 1; n <= maxIterations; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+
+		c = b + an/c
+
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+
+		d = 1 / d
+		delta := d * c
+		h *= delta
+
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+
+	return front * h
+}
+
+// BonferroniCorrection function    Returns the p-values multiplied by their
+// count, capped at 1.
+func BonferroniCorrection(pValues []float64) []float64 {
+	adjusted := make([]float64, len(pValues))
+
+	for i, p := range pValues {
+		adjusted[i] = math.Min(1, p*float64(len(pValues)))
+	}
+
+	return adjusted
+}
+
+// HolmCorrection function    Returns the p-values adjusted with the
+// Holm-Bonferroni step-down method, in the order they were given.
+func HolmCorrection(pValues []float64) []float64 {
+	m := len(pValues)
+	order := make([]int, m)
+
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool { return pValues[order[i]] < pValues[order[j]] })
+
+	adjusted := make([]float64, m)
+	previous := 0.0
+
+	for rank, i := range order {
+		p := math.Min(1, pValues[i]*float64(m-rank))
+		previous = math.Max(previous, p)
+		adjusted[i] = previous
+	}
+
+	return adjusted
+}
+
+// StudentTTwoSided function    Returns P(|T| >= |t|) for a Student's t
+// distribution with df degrees of freedom.
+func StudentTTwoSided(t float64, df float64) float64 {
+	return RegularizedIncompleteBeta(df/(df+t*t), df/2, 0.5)
+}
+
+// StudentTCritical function    Returns the t above which a Student's t
+// distribution with df degrees of freedom has a two-sided tail of alpha, e.g.
+// 2.262 for alpha 0.05 and df 9. Found by bisection.
+func StudentTCritical(alpha float64, df float64) float64 {
+	low, high := 0.0, 1.0
+
+	for StudentTTwoSided(high, df) > alpha && high < 1e6 {
+		high *= 2
+	}
+
+	for i := 0; i < 100; i++ {
+		mid := (low + high) / 2
+
+		if StudentTTwoSided(mid, df) > alpha {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	return (low + high) / 2
+}
+
+// RegularizedIncompleteBeta function    Returns I_x(a, b), evaluated with a
+// continued fraction as described in Numerical Recipes.
+func RegularizedIncompleteBeta(x float64, a float64, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+
+	if x >= 1 {
+		return 1
+	}
+
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+
+	// The continued fraction converges fast for x below the mean of the
+	// distribution, otherwise the symmetry I_x(a, b) = 1 - I_1-x(b, a) is used.
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(x, a, b) / a
+	}
+
+	return 1 - front*betaContinuedFraction(1-x, b, a)/b
+}
+
+func betaContinuedFraction(x float64, a float64, b float64) float64 {
+	const (
+		maxIterations = 300
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+
+	d = 1 / d
+	h := d
+
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+
+		// Even step
+		num := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 + num*d
+
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+
+		c = 1 + num/c
+
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+
+		d = 1 / d
+		h *= d * c
+
+		// Odd step
+		num = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 + num*d
+
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+
+		c = 1 + num/c
+
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+
+		d = 1 / d
+		delta := d * c
+		h *= delta
+
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+
+	return h
+}